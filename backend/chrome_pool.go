@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"html/template"
+	"sync/atomic"
+	"time"
+
+	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/chromedp"
+)
+
+var (
+	errRendererBusy    = errors.New("chrome renderer is busy")
+	errRendererTimeout = errors.New("chrome renderer timed out")
+)
+
+type chromeTab struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// ChromeRenderMetrics is a point-in-time view of the chrome renderer pool.
+type ChromeRenderMetrics struct {
+	Tabs            int     `json:"tabs"`
+	Busy            int64   `json:"busy"`
+	Queued          int64   `json:"queued"`
+	Renders         int64   `json:"renders"`
+	Failures        int64   `json:"failures"`
+	Timeouts        int64   `json:"timeouts"`
+	Rejected        int64   `json:"rejected"`
+	Recycled        int64   `json:"recycled"`
+	AverageRenderMs float64 `json:"average_render_ms"`
+}
+
+// ChromeRenderPool renders the image templates on a fixed number of
+// reusable chrome tabs. renders wait in a bounded queue for a free tab and
+// are rejected once the queue is full so that callers can fall back to the
+// gg-based renderer instead of piling up.
+type ChromeRenderPool struct {
+	Timeout time.Duration
+
+	parent context.Context
+	size   int
+	tabs   chan *chromeTab
+	slots  chan struct{}
+
+	busy          int64
+	renders       int64
+	failures      int64
+	timeouts      int64
+	rejected      int64
+	recycled      int64
+	totalDuration int64
+
+	// replaced in tests
+	newTab     func(parent context.Context, timeout time.Duration) (context.Context, context.CancelFunc, error)
+	renderPage func(ctx context.Context, rctx RendererContext, html string) ([]byte, error)
+}
+
+func newChromeRenderPool(parent context.Context, size int, queueSize int, timeout time.Duration) *ChromeRenderPool {
+	pool := &ChromeRenderPool{
+		Timeout:    timeout,
+		parent:     parent,
+		size:       size,
+		tabs:       make(chan *chromeTab, size),
+		slots:      make(chan struct{}, size+queueSize),
+		newTab:     openChromeTab,
+		renderPage: renderChromePage,
+	}
+
+	pool.openTabs()
+	return pool
+}
+
+func (pool *ChromeRenderPool) openTabs() {
+	for i := 0; i < pool.size; i++ {
+		pool.tabs <- pool.openTab()
+	}
+}
+
+// openTab opens a tab in the browser of the pool, giving up after the
+// render timeout. a tab that failed to open is still added so that its
+// first render fails and replaces it.
+func (pool *ChromeRenderPool) openTab() *chromeTab {
+	ctx, cancel, err := pool.newTab(pool.parent, pool.Timeout)
+	passivePrintError(err)
+	return &chromeTab{ctx: ctx, cancel: cancel}
+}
+
+// recycle closes a tab that failed or took too long and puts a fresh one
+// in its place. the fresh tab is opened in the background since chrome
+// may not be responding at all, which is usually why the tab is recycled.
+func (pool *ChromeRenderPool) recycle(tab *chromeTab) {
+	tab.cancel()
+	atomic.AddInt64(&pool.recycled, 1)
+	go func() {
+		pool.tabs <- pool.openTab()
+	}()
+}
+
+// Render renders the template into an image in the encoding of the
+// context. the deadline covers both the wait for a free tab and the render
+// itself.
+func (pool *ChromeRenderPool) Render(tmpl *template.Template, rctx RendererContext) ([]byte, error) {
+	output := &bytes.Buffer{}
+	if err := tmpl.Execute(output, rctx); err != nil {
+		return nil, err
+	}
+
+	select {
+	case pool.slots <- struct{}{}:
+		defer func() { <-pool.slots }()
+	default:
+		atomic.AddInt64(&pool.rejected, 1)
+		return nil, errRendererBusy
+	}
+
+	deadline := time.Now().Add(pool.Timeout)
+	waitCtx, cancelWait := context.WithDeadline(context.Background(), deadline)
+	defer cancelWait()
+
+	var tab *chromeTab
+	select {
+	case tab = <-pool.tabs:
+	case <-waitCtx.Done():
+		atomic.AddInt64(&pool.timeouts, 1)
+		return nil, errRendererTimeout
+	}
+
+	atomic.AddInt64(&pool.busy, 1)
+	defer atomic.AddInt64(&pool.busy, -1)
+
+	startedAt := time.Now()
+
+	// the tab is already open so the deadline of the job only stops its
+	// actions instead of closing the tab
+	jobCtx, cancelJob := context.WithDeadline(tab.ctx, deadline)
+	defer cancelJob()
+
+	type result struct {
+		buf []byte
+		err error
+	}
+
+	// the page is rendered in its own goroutine so that a tab which stops
+	// responding can not hold the caller past the deadline
+	results := make(chan result, 1)
+	go func() {
+		buf, err := pool.renderPage(jobCtx, rctx, output.String())
+		results <- result{buf, err}
+	}()
+
+	select {
+	case res := <-results:
+		if res.err != nil && jobCtx.Err() != nil {
+			atomic.AddInt64(&pool.timeouts, 1)
+			pool.recycle(tab)
+			return nil, errRendererTimeout
+		} else if res.err != nil || len(res.buf) == 0 {
+			atomic.AddInt64(&pool.failures, 1)
+			pool.recycle(tab)
+			if res.err == nil {
+				res.err = errors.New("chrome renderer returned an empty image")
+			}
+			return nil, res.err
+		}
+
+		atomic.AddInt64(&pool.renders, 1)
+		atomic.AddInt64(&pool.totalDuration, int64(time.Since(startedAt)))
+		pool.tabs <- tab
+		return res.buf, nil
+	case <-jobCtx.Done():
+		atomic.AddInt64(&pool.timeouts, 1)
+		pool.recycle(tab)
+		return nil, errRendererTimeout
+	}
+}
+
+func (pool *ChromeRenderPool) Metrics() ChromeRenderMetrics {
+	metrics := ChromeRenderMetrics{
+		Tabs:     pool.size,
+		Busy:     atomic.LoadInt64(&pool.busy),
+		Renders:  atomic.LoadInt64(&pool.renders),
+		Failures: atomic.LoadInt64(&pool.failures),
+		Timeouts: atomic.LoadInt64(&pool.timeouts),
+		Rejected: atomic.LoadInt64(&pool.rejected),
+		Recycled: atomic.LoadInt64(&pool.recycled),
+	}
+
+	metrics.Queued = int64(len(pool.slots)) - metrics.Busy
+	if metrics.Queued < 0 {
+		metrics.Queued = 0
+	}
+
+	if metrics.Renders != 0 {
+		metrics.AverageRenderMs = float64(atomic.LoadInt64(&pool.totalDuration)) / float64(metrics.Renders) / float64(time.Millisecond)
+	}
+
+	return metrics
+}
+
+// newChromeBrowser connects to the browser of the allocator once so that
+// the tabs of the pool share it instead of each allocating their own.
+func newChromeBrowser(allocCtx context.Context) (context.Context, context.CancelFunc, error) {
+	ctx, cancel := chromedp.NewContext(allocCtx)
+	if err := chromedp.Run(ctx); err != nil {
+		cancel()
+		return nil, nil, err
+	}
+	return ctx, cancel, nil
+}
+
+// openChromeTab opens a new tab in the browser. the first run ties the tab
+// to its context so it can not be given a deadline. the tab is closed
+// instead if it does not open in time.
+func openChromeTab(parent context.Context, timeout time.Duration) (context.Context, context.CancelFunc, error) {
+	ctx, cancel := chromedp.NewContext(parent)
+	timer := time.AfterFunc(timeout, cancel)
+	err := chromedp.Run(ctx)
+	if !timer.Stop() {
+		err = errRendererTimeout
+	}
+	return ctx, cancel, err
+}
+
+// renderChromePage writes the compiled template into the tab and takes a
+// screenshot once its fonts and images have loaded.
+func renderChromePage(ctx context.Context, rctx RendererContext, html string) ([]byte, error) {
+	var buf []byte
+	err := chromedp.Run(ctx,
+		chromedp.EmulateViewport(int64(rctx.Width), int64(rctx.Height)),
+		chromedp.Navigate("about:blank"),
+		chromedp.PollFunction(`
+		async (html) => {
+			document.open();
+			document.write(html);
+			document.close();
+			await document.fonts.ready;
+			await Promise.all(Array.from(document.images).map((img) => img.complete ? null : new Promise((resolve) => {
+				img.onload = img.onerror = resolve;
+			})));
+			return true;
+		}
+		`, nil, chromedp.WithPollingArgs(html)),
+		chromedp.ActionFunc(func(ctx context.Context) error {
+			// the image fills the whole viewport
+			var err error
+			buf, err = chromeScreenshotParams(rctx).Do(ctx)
+			return err
+		}),
+	)
+	return buf, err
+}
+
+// chromeScreenshotParams captures the viewport in the requested encoding.
+// chrome's own encoders are used for jpeg and webp so that the images are
+// lossy unlike the webp images of the gg-based renderer.
+func chromeScreenshotParams(rctx RendererContext) *page.CaptureScreenshotParams {
+	params := page.CaptureScreenshot().WithClip(&page.Viewport{
+		Width:  float64(rctx.Width),
+		Height: float64(rctx.Height),
+		Scale:  1,
+	})
+
+	switch rctx.Encoding.Format {
+	case imageFormatJPEG:
+		return params.WithFormat(page.CaptureScreenshotFormatJpeg).WithQuality(int64(rctx.Encoding.Quality))
+	case imageFormatWebP:
+		return params.WithFormat(page.CaptureScreenshotFormatWebp).WithQuality(int64(rctx.Encoding.Quality))
+	default:
+		return params.WithFormat(page.CaptureScreenshotFormatPng)
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"html/template"
+	"image/png"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/chromedp/chromedp"
+)
+
+func newTestChromeRenderPool(size int, queueSize int, render func(ctx context.Context) ([]byte, error)) *ChromeRenderPool {
+	pool := &ChromeRenderPool{
+		Timeout: 100 * time.Millisecond,
+		parent:  context.Background(),
+		size:    size,
+		tabs:    make(chan *chromeTab, size),
+		slots:   make(chan struct{}, size+queueSize),
+		newTab: func(parent context.Context, timeout time.Duration) (context.Context, context.CancelFunc, error) {
+			ctx, cancel := context.WithCancel(parent)
+			return ctx, cancel, nil
+		},
+		renderPage: func(ctx context.Context, rctx RendererContext, html string) ([]byte, error) {
+			return render(ctx)
+		},
+	}
+	pool.openTabs()
+	return pool
+}
+
+// waitForTab waits until the tab recycled in the background is back in the
+// pool
+func waitForTab(t *testing.T, pool *ChromeRenderPool) {
+	t.Helper()
+
+	for i := 0; i < 100 && len(pool.tabs) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if len(pool.tabs) == 0 {
+		t.Fatal("Expected a fresh tab in the pool")
+	}
+}
+
+var testRendererTemplate = template.Must(template.New("").Parse(`{{ .Type }}`))
+
+func TestChromeRenderPool_Render(t *testing.T) {
+	pool := newTestChromeRenderPool(2, 0, func(ctx context.Context) ([]byte, error) {
+		return []byte("png"), nil
+	})
+
+	for i := 0; i < 3; i++ {
+		if buf, err := pool.Render(testRendererTemplate, RendererContext{}); err != nil || string(buf) != "png" {
+			t.Fatalf("Expected rendered image, got %q (err: %v)", buf, err)
+		}
+	}
+
+	metrics := pool.Metrics()
+	if metrics.Renders != 3 || metrics.Recycled != 0 || metrics.Busy != 0 || metrics.Queued != 0 {
+		t.Errorf("Unexpected metrics: %+v", metrics)
+	}
+
+	if len(pool.tabs) != 2 {
+		t.Errorf("Expected tabs to be reused, got %d free tabs", len(pool.tabs))
+	}
+}
+
+func TestChromeRenderPool_RecyclesFailedTab(t *testing.T) {
+	pool := newTestChromeRenderPool(1, 0, func(ctx context.Context) ([]byte, error) {
+		return nil, errors.New("target crashed")
+	})
+
+	if _, err := pool.Render(testRendererTemplate, RendererContext{}); err == nil {
+		t.Fatal("Expected render error, got nil")
+	}
+
+	if metrics := pool.Metrics(); metrics.Failures != 1 || metrics.Recycled != 1 {
+		t.Errorf("Expected failed tab to be recycled, got %+v", metrics)
+	}
+
+	// the fresh tab is opened in the background
+	waitForTab(t, pool)
+}
+
+func TestChromeRenderPool_RecyclesInBackground(t *testing.T) {
+	pool := newTestChromeRenderPool(1, 0, func(ctx context.Context) ([]byte, error) {
+		return nil, errors.New("target crashed")
+	})
+
+	// chrome stops responding so the fresh tab does not open until released
+	release := make(chan struct{})
+	pool.newTab = func(parent context.Context, timeout time.Duration) (context.Context, context.CancelFunc, error) {
+		<-release
+		ctx, cancel := context.WithCancel(parent)
+		return ctx, cancel, nil
+	}
+
+	startedAt := time.Now()
+	if _, err := pool.Render(testRendererTemplate, RendererContext{}); err == nil {
+		t.Fatal("Expected render error, got nil")
+	}
+
+	if elapsed := time.Since(startedAt); elapsed > pool.Timeout {
+		t.Errorf("Expected the render not to wait for the fresh tab, took %s", elapsed)
+	}
+
+	// renders wait for the fresh tab until their own deadline
+	if _, err := pool.Render(testRendererTemplate, RendererContext{}); err != errRendererTimeout {
+		t.Errorf("Expected timeout error while the tab opens, got %v", err)
+	}
+
+	close(release)
+	select {
+	case <-pool.tabs:
+	case <-time.After(time.Second):
+		t.Error("Expected the fresh tab to be added once it opened")
+	}
+}
+
+func TestChromeRenderPool_Timeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	// a tab that never responds, not even to its context
+	pool := newTestChromeRenderPool(1, 0, func(ctx context.Context) ([]byte, error) {
+		<-release
+		return nil, nil
+	})
+
+	startedAt := time.Now()
+	if _, err := pool.Render(testRendererTemplate, RendererContext{}); err != errRendererTimeout {
+		t.Fatalf("Expected timeout error, got %v", err)
+	}
+
+	if elapsed := time.Since(startedAt); elapsed > time.Second {
+		t.Errorf("Expected render to stop at the deadline, took %s", elapsed)
+	}
+
+	if metrics := pool.Metrics(); metrics.Timeouts != 1 || metrics.Recycled != 1 {
+		t.Errorf("Expected timed out tab to be recycled, got %+v", metrics)
+	}
+}
+
+func TestChromeRenderPool_BackPressure(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	pool := newTestChromeRenderPool(1, 0, func(ctx context.Context) ([]byte, error) {
+		started <- struct{}{}
+		<-release
+		return []byte("png"), nil
+	})
+	pool.Timeout = time.Second
+
+	done := make(chan error)
+	go func() {
+		_, err := pool.Render(testRendererTemplate, RendererContext{})
+		done <- err
+	}()
+	<-started
+
+	if _, err := pool.Render(testRendererTemplate, RendererContext{}); err != errRendererBusy {
+		t.Errorf("Expected busy error while the queue is full, got %v", err)
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Errorf("Expected first render to succeed, got %v", err)
+	}
+
+	if metrics := pool.Metrics(); metrics.Rejected != 1 || metrics.Renders != 1 {
+		t.Errorf("Unexpected metrics: %+v", metrics)
+	}
+}
+
+// chromeTestExecPath finds a chrome binary for the tests that need a real
+// browser. CHROME_PATH takes precedence over the binaries in PATH.
+func chromeTestExecPath(t *testing.T) string {
+	if path := os.Getenv("CHROME_PATH"); len(path) != 0 {
+		return path
+	}
+
+	for _, name := range []string{"headless-shell", "chromium", "chromium-browser", "google-chrome"} {
+		if path, err := exec.LookPath(name); err == nil {
+			return path
+		}
+	}
+
+	t.Skip("chrome not found, set CHROME_PATH to run this test")
+	return ""
+}
+
+func TestChromeRenderPool_ReusesRealTab(t *testing.T) {
+	opts := append(chromedp.DefaultExecAllocatorOptions[:], chromedp.ExecPath(chromeTestExecPath(t)), chromedp.NoSandbox)
+	allocCtx, cancelAlloc := chromedp.NewExecAllocator(context.Background(), opts...)
+	defer cancelAlloc()
+
+	browserCtx, cancelBrowser, err := newChromeBrowser(allocCtx)
+	if err != nil {
+		t.Fatalf("Failed to start chrome: %v", err)
+	}
+	defer cancelBrowser()
+
+	pool := newChromeRenderPool(browserCtx, 1, 0, 15*time.Second)
+	tmpl := template.Must(template.New("").Parse(`<html><body style="margin: 0; background: #f00;">{{ .Type }}</body></html>`))
+	rctx := RendererContext{Type: "twitter", Width: 120, Height: 60, Encoding: imageEncodingFor(imageFormatPNG)}
+
+	// both renders go through the only tab of the pool
+	for i := 0; i < 2; i++ {
+		buf, err := pool.Render(tmpl, rctx)
+		if err != nil {
+			t.Fatalf("Render %d failed: %v (metrics: %+v)", i+1, err, pool.Metrics())
+		}
+
+		img, err := png.Decode(bytes.NewReader(buf))
+		if err != nil {
+			t.Fatalf("Render %d: failed to decode image: %v", i+1, err)
+		}
+
+		if bounds := img.Bounds(); bounds.Dx() != 120 || bounds.Dy() != 60 {
+			t.Errorf("Render %d: expected 120x60, got %dx%d", i+1, bounds.Dx(), bounds.Dy())
+		}
+	}
+
+	if metrics := pool.Metrics(); metrics.Renders != 2 || metrics.Recycled != 0 || metrics.Failures != 0 || metrics.Timeouts != 0 {
+		t.Errorf("Expected the tab to be reused, got %+v", metrics)
+	}
+}
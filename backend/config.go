@@ -7,6 +7,8 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
+	"time"
 
 	goaway "github.com/TwiN/go-away"
 )
@@ -15,15 +17,37 @@ type CustomProfanityDictionary struct {
 	Profanities    []string
 	FalsePositives []string
 	FalseNegatives []string
+
+	// Categories groups the dictionary terms (e.g. "political", "slur")
+	// so that moderation verdicts can tell the user why a term was flagged.
+	Categories map[string][]string
 }
 
 // uninit'ed variables
 var baseUrl string
 var chromeDevtoolsURL string
+
+// font used to draw the emoji that have no icon in the emojis folder. the
+// default is the one installed by the fonts-symbola package. can be set
+// with EMOJI_FONT_PATH.
+var emojiFontPath = "/usr/share/fonts/truetype/ancient-scripts/Symbola_hint.ttf"
 var frontendUrl = "http://localhost:3000"
 
 // TODO: add custom dictionary for bisaya and tagalog
 var profanityDetector *goaway.ProfanityDetector
+var profanityCategories = map[string]string{}
+
+// what to do with personal information found in submissions. can be
+// overridden with PII_POLICY (e.g. "phone=reject,url=mask")
+var piiPolicies = map[string]string{
+	piiPhone:        piiPolicyReject,
+	piiEmail:        piiPolicyReject,
+	piiSocialHandle: piiPolicyMask,
+	piiURL:          piiPolicyMask,
+}
+
+// categories whose matched terms are not echoed back to the client
+var moderationHiddenCategories = map[string]bool{}
 
 // init'ed variables
 var serverPort = 4000
@@ -32,6 +56,85 @@ var dataDirPath = filepath.Join(".", "_data")
 
 var sendPrice = float64(150.0)
 
+// near-duplicate detection. messages from the same sender whose similarity
+// hashes differ by at most spamMaxDistance bits within spamWindow are
+// considered duplicates.
+var spamMaxDistance = 6
+var spamWindow = 1 * time.Hour
+var spamMaxRecipients = 3
+
+// leaderboard buckets are split by day in philippine time
+var leaderboardTimezone = time.FixedZone("PHT", 8*60*60)
+
+// how often stored ranking totals are compared against the messages.
+// set RANKINGS_DRIFT_CHECK_INTERVAL to 0 to disable.
+var rankingsDriftCheckInterval = 1 * time.Hour
+
+// tenant used when a request does not match any tenant. can be set with
+// DEFAULT_TENANT.
+var defaultTenant = "uic"
+
+// name of the site used when the tenant has no site name in its branding.
+// can be set with SITE_NAME.
+var defaultSiteName = "UIC Valentine Wall"
+
+// season used before any season has been created. can be set with SEASON.
+var currentSeason = "2023"
+
+// how often the leaderboard is snapshotted and how many entries are kept.
+// set RANKING_SNAPSHOT_INTERVAL to 0 to disable.
+var rankingSnapshotInterval = 24 * time.Hour
+var rankingSnapshotSize = 100
+
+// ranking scoring options. can be overridden with RANKING_SENDER_CAP,
+// RANKING_UNIQUE_SENDER_BONUS and RANKING_EXCLUDE_SELF_SENDS.
+var rankingScoring = RankingScoring{ExcludeSelfSends: true}
+
+// rankings with at least rankingSuspiciousMinCoins where up to
+// rankingSuspiciousMaxSenders senders make up rankingSuspiciousShare of
+// the coins are flagged for review.
+var rankingSuspiciousMinCoins = 1000.0
+var rankingSuspiciousMaxSenders = 3
+var rankingSuspiciousShare = 0.8
+
+// number of chrome tabs used for rendering images, how many renders may
+// wait for a free tab and how long a render may take before falling back
+// to the gg-based renderer. can be set with CHROME_TABS, CHROME_QUEUE_SIZE
+// and CHROME_RENDER_TIMEOUT.
+var chromeTabs = 4
+var chromeQueueSize = 16
+var chromeRenderTimeout = 15 * time.Second
+
+// maximum size in bytes of the rendered images kept in the data dir. set
+// with IMAGE_DISK_CACHE_SIZE in megabytes, disabled if 0.
+var imageDiskCacheSize int64 = 0
+
+// quality (1-100) of the jpeg and webp images. can be set with
+// IMAGE_JPEG_QUALITY and IMAGE_WEBP_QUALITY. IMAGE_WEBP_QUALITY only
+// applies to webp images rendered by chrome, the ones rendered without it
+// are always lossless.
+var imageJPEGQuality = 85
+var imageWebPQuality = 80
+
+// number of new messages waiting for their share images to be rendered in
+// the background. set with IMAGE_PRERENDER_QUEUE_SIZE, disabled if 0.
+var imagePrerenderQueueSize = 100
+
+// secret used to sign the share links of message images and how long the
+// links last. can be set with IMAGE_SHARE_SECRET and IMAGE_SHARE_TTL. a key
+// derived from the auth token secret of pocketbase is used if no secret is
+// set.
+var imageShareSecret string
+var imageShareTTL = 24 * time.Hour
+
+// per-route rate limits for write endpoints. can be overridden with
+// RATE_LIMITS (e.g. "messages=5/1m,message_replies=10/1m,archive=2/10m")
+var rateLimits = map[string]RateLimit{
+	"messages":        {Rate: 5.0 / 60, Burst: 5},
+	"message_replies": {Rate: 10.0 / 60, Burst: 10},
+	"archive":         {Rate: 2.0 / 600, Burst: 2},
+}
+
 func loadCustomProfanityDetector(customDictionary *CustomProfanityDictionary) *goaway.ProfanityDetector {
 	return goaway.NewProfanityDetector().WithCustomDictionary(
 		append(goaway.DefaultProfanities, customDictionary.Profanities...),
@@ -63,6 +166,10 @@ func init() {
 		frontendUrl = gotFrontendUrl
 	}
 
+	if gotEmojiFontPath, exists := os.LookupEnv("EMOJI_FONT_PATH"); exists {
+		emojiFontPath = gotEmojiFontPath
+	}
+
 	if gotTargetEnv, exists := os.LookupEnv("ENV"); exists {
 		switch gotTargetEnv {
 		case "development", "production", "staging":
@@ -87,10 +194,210 @@ func init() {
 
 		log.Println("loading custom profanity detector...")
 		profanityDetector = loadCustomProfanityDetector(customDictionary)
+
+		for category, terms := range customDictionary.Categories {
+			for _, term := range terms {
+				profanityCategories[strings.ToLower(term)] = category
+			}
+		}
 	} else {
 		profanityDetector = goaway.NewProfanityDetector()
 	}
 
+	if gotSpamMaxDistance, exists := os.LookupEnv("SPAM_MAX_DISTANCE"); exists {
+		var err error
+		spamMaxDistance, err = strconv.Atoi(gotSpamMaxDistance)
+		if err != nil {
+			log.Panicln(err)
+		}
+	}
+
+	if gotSpamWindow, exists := os.LookupEnv("SPAM_WINDOW"); exists {
+		var err error
+		spamWindow, err = time.ParseDuration(gotSpamWindow)
+		if err != nil {
+			log.Panicln(err)
+		}
+	}
+
+	if gotSpamMaxRecipients, exists := os.LookupEnv("SPAM_MAX_RECIPIENTS"); exists {
+		var err error
+		spamMaxRecipients, err = strconv.Atoi(gotSpamMaxRecipients)
+		if err != nil {
+			log.Panicln(err)
+		}
+	}
+
+	if gotDriftCheckInterval, exists := os.LookupEnv("RANKINGS_DRIFT_CHECK_INTERVAL"); exists {
+		var err error
+		rankingsDriftCheckInterval, err = time.ParseDuration(gotDriftCheckInterval)
+		if err != nil {
+			log.Panicln(err)
+		}
+	}
+
+	if gotDefaultTenant, exists := os.LookupEnv("DEFAULT_TENANT"); exists {
+		defaultTenant = gotDefaultTenant
+	}
+
+	if gotSiteName, exists := os.LookupEnv("SITE_NAME"); exists {
+		defaultSiteName = gotSiteName
+	}
+
+	if gotSeason, exists := os.LookupEnv("SEASON"); exists {
+		currentSeason = gotSeason
+	}
+
+	if gotSnapshotInterval, exists := os.LookupEnv("RANKING_SNAPSHOT_INTERVAL"); exists {
+		var err error
+		rankingSnapshotInterval, err = time.ParseDuration(gotSnapshotInterval)
+		if err != nil {
+			log.Panicln(err)
+		}
+	}
+
+	if gotSnapshotSize, exists := os.LookupEnv("RANKING_SNAPSHOT_SIZE"); exists {
+		var err error
+		rankingSnapshotSize, err = strconv.Atoi(gotSnapshotSize)
+		if err != nil {
+			log.Panicln(err)
+		}
+	}
+
+	if gotSenderCap, exists := os.LookupEnv("RANKING_SENDER_CAP"); exists {
+		var err error
+		rankingScoring.SenderCap, err = strconv.ParseFloat(gotSenderCap, 64)
+		if err != nil {
+			log.Panicln(err)
+		}
+	}
+
+	if gotUniqueSenderBonus, exists := os.LookupEnv("RANKING_UNIQUE_SENDER_BONUS"); exists {
+		var err error
+		rankingScoring.UniqueSenderBonus, err = strconv.ParseFloat(gotUniqueSenderBonus, 64)
+		if err != nil {
+			log.Panicln(err)
+		}
+	}
+
+	if gotExcludeSelfSends, exists := os.LookupEnv("RANKING_EXCLUDE_SELF_SENDS"); exists {
+		var err error
+		rankingScoring.ExcludeSelfSends, err = strconv.ParseBool(gotExcludeSelfSends)
+		if err != nil {
+			log.Panicln(err)
+		}
+	}
+
+	if gotChromeTabs, exists := os.LookupEnv("CHROME_TABS"); exists {
+		var err error
+		chromeTabs, err = strconv.Atoi(gotChromeTabs)
+		if err != nil {
+			log.Panicln(err)
+		} else if chromeTabs <= 0 {
+			log.Panicf("invalid chrome tabs '%s'\n", gotChromeTabs)
+		}
+	}
+
+	if gotChromeQueueSize, exists := os.LookupEnv("CHROME_QUEUE_SIZE"); exists {
+		var err error
+		chromeQueueSize, err = strconv.Atoi(gotChromeQueueSize)
+		if err != nil {
+			log.Panicln(err)
+		}
+	}
+
+	if gotChromeRenderTimeout, exists := os.LookupEnv("CHROME_RENDER_TIMEOUT"); exists {
+		var err error
+		chromeRenderTimeout, err = time.ParseDuration(gotChromeRenderTimeout)
+		if err != nil {
+			log.Panicln(err)
+		}
+	}
+
+	if gotImageDiskCacheSize, exists := os.LookupEnv("IMAGE_DISK_CACHE_SIZE"); exists {
+		sizeInMb, err := strconv.ParseInt(gotImageDiskCacheSize, 10, 64)
+		if err != nil {
+			log.Panicln(err)
+		}
+		imageDiskCacheSize = sizeInMb * 1024 * 1024
+	}
+
+	if gotImageJPEGQuality, exists := os.LookupEnv("IMAGE_JPEG_QUALITY"); exists {
+		var err error
+		imageJPEGQuality, err = strconv.Atoi(gotImageJPEGQuality)
+		if err != nil {
+			log.Panicln(err)
+		}
+	}
+
+	if gotImageWebPQuality, exists := os.LookupEnv("IMAGE_WEBP_QUALITY"); exists {
+		var err error
+		imageWebPQuality, err = strconv.Atoi(gotImageWebPQuality)
+		if err != nil {
+			log.Panicln(err)
+		}
+	}
+
+	if gotImagePrerenderQueueSize, exists := os.LookupEnv("IMAGE_PRERENDER_QUEUE_SIZE"); exists {
+		var err error
+		imagePrerenderQueueSize, err = strconv.Atoi(gotImagePrerenderQueueSize)
+		if err != nil {
+			log.Panicln(err)
+		}
+	}
+
+	if gotImageShareSecret, exists := os.LookupEnv("IMAGE_SHARE_SECRET"); exists {
+		imageShareSecret = gotImageShareSecret
+	}
+
+	if gotImageShareTTL, exists := os.LookupEnv("IMAGE_SHARE_TTL"); exists {
+		var err error
+		imageShareTTL, err = time.ParseDuration(gotImageShareTTL)
+		if err != nil {
+			log.Panicln(err)
+		}
+	}
+
+	if gotRateLimits, exists := os.LookupEnv("RATE_LIMITS"); exists {
+		for _, rawLimit := range strings.Split(gotRateLimits, ",") {
+			route, rawRate, found := strings.Cut(strings.TrimSpace(rawLimit), "=")
+			if !found {
+				log.Panicf("invalid rate limit '%s'\n", rawLimit)
+			}
+
+			limit, err := parseRateLimit(rawRate)
+			if err != nil {
+				log.Panicln(err)
+			}
+
+			rateLimits[route] = limit
+		}
+	}
+
+	if gotPiiPolicy, exists := os.LookupEnv("PII_POLICY"); exists {
+		for _, rawPolicy := range strings.Split(gotPiiPolicy, ",") {
+			kind, policy, _ := strings.Cut(strings.TrimSpace(rawPolicy), "=")
+			if _, known := piiPolicies[kind]; !known {
+				log.Panicf("unknown personal information kind '%s'\n", kind)
+			}
+
+			switch policy {
+			case piiPolicyReject, piiPolicyMask:
+				piiPolicies[kind] = policy
+			default:
+				log.Panicf("invalid personal information policy '%s'\n", rawPolicy)
+			}
+		}
+	}
+
+	if gotHiddenCategories, exists := os.LookupEnv("MODERATION_HIDDEN_CATEGORIES"); exists {
+		for _, category := range strings.Split(gotHiddenCategories, ",") {
+			if category = strings.TrimSpace(category); len(category) != 0 {
+				moderationHiddenCategories[category] = true
+			}
+		}
+	}
+
 	if gotChromeDevtoolsURL, exists := os.LookupEnv("CHROME_DEVTOOLS_URL"); exists {
 		chromeDevtoolsURL = gotChromeDevtoolsURL
 	}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"sort"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+)
+
+// the leaderboard of each tenant is cached under its uid
+var departmentLeaderboardCache = cache.New(10*time.Minute, 5*time.Minute)
+
+// invalidateDepartmentLeaderboard should be called whenever messages or
+// registered students change.
+func invalidateDepartmentLeaderboard() {
+	departmentLeaderboardCache.Flush()
+}
+
+// queryDepartmentLeaderboard aggregates the coins, messages and recipients
+// of each college department of the tenant in the current season. the
+// totals are normalized by the number of registered students of the
+// department so that bigger departments do not win by headcount alone.
+func queryDepartmentLeaderboard(dao *daos.Dao, tenantId string) (DepartmentStatsList, error) {
+	stats := DepartmentStatsList{}
+	err := dao.DB().NewQuery(`
+		SELECT d.id AS department_id, d.uid AS uid, d.label AS label,
+			COALESCE(SUM(CAST(r.total_coins AS REAL)), 0) AS total_coins,
+			COALESCE(SUM(mc.messages_count), 0) AS messages_count,
+			COUNT(DISTINCT r.recipient) AS unique_recipients,
+			(SELECT COUNT(*) FROM user_details ud WHERE ud.college_department = d.id) AS registered_students
+		FROM college_departments d
+		LEFT JOIN rankings r ON r.college_department = d.id AND r.tenant = d.tenant
+			AND r.season = {:season} AND CAST(r.total_coins AS REAL) > 0
+		LEFT JOIN (
+			SELECT recipient, COUNT(*) AS messages_count FROM messages
+			WHERE tenant = {:tenant} AND season = {:season} AND COALESCE(hidden, FALSE) = FALSE GROUP BY recipient
+		) mc ON mc.recipient = r.recipient
+		WHERE d.tenant = {:tenant}
+		GROUP BY d.id
+	`).Bind(dbx.Params{"tenant": tenantId, "season": currentSeasonId(dao)}).All(&stats)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, dept := range stats {
+		if dept.RegisteredStudents != 0 {
+			dept.NormalizedCoins = dept.TotalCoins / float64(dept.RegisteredStudents)
+		}
+	}
+
+	sort.Stable(stats)
+	return stats, nil
+}
+
+func getDepartmentLeaderboard(dao *daos.Dao, tenantId string) (DepartmentStatsList, error) {
+	if cached, found := departmentLeaderboardCache.Get(tenantId); found {
+		return cached.(DepartmentStatsList), nil
+	}
+
+	stats, err := queryDepartmentLeaderboard(dao, tenantId)
+	if err != nil {
+		return nil, err
+	}
+
+	departmentLeaderboardCache.Set(tenantId, stats, cache.DefaultExpiration)
+	return stats, nil
+}
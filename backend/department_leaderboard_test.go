@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/tests"
+)
+
+func saveTestDepartment(t *testing.T, app *tests.TestApp, uid string) *models.Record {
+	t.Helper()
+
+	collection, _ := app.Dao().FindCollectionByNameOrId("college_departments")
+	dept := models.NewRecord(collection)
+	dept.Set("uid", uid)
+	dept.Set("label", uid)
+	dept.Set("tenant", defaultTenant)
+	if err := app.Dao().SaveRecord(dept); err != nil {
+		t.Fatalf("Failed to save department: %v", err)
+	}
+
+	return dept
+}
+
+func TestQueryDepartmentLeaderboard(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Cleanup()
+
+	dao := app.Dao()
+	ccs := saveTestDepartment(t, app, "ccs")
+	cba := saveTestDepartment(t, app, "cba")
+	saveTestDepartment(t, app, "cea")
+
+	// ccs: 1 registered student, cba: 2 registered students
+	detailsCollection, _ := dao.FindCollectionByNameOrId("user_details")
+	for i, deptId := range []string{ccs.Id, cba.Id, cba.Id} {
+		details := models.NewRecord(detailsCollection)
+		details.Set("student_id", fmt.Sprintf("20200000000%d", i+1))
+		details.Set("college_department", deptId)
+		details.Set("tenant", defaultTenant)
+		if err := dao.SaveRecord(details); err != nil {
+			t.Fatalf("Failed to save user details: %v", err)
+		}
+	}
+
+	for _, ranking := range []struct {
+		recipient string
+		dept      string
+		coins     float64
+	}{
+		{"202000000001", ccs.Id, 300},
+		{"202000000002", cba.Id, 150},
+		{"202000000003", cba.Id, 300},
+	} {
+		r := saveTestRanking(t, app, ranking.recipient, ranking.coins)
+		r.Set("college_department", ranking.dept)
+		dao.SaveRecord(r)
+		saveTestMessage(t, app, "sender1", ranking.recipient, "Hello "+ranking.recipient)
+	}
+
+	stats, err := queryDepartmentLeaderboard(dao, defaultTenant)
+	if err != nil {
+		t.Fatalf("queryDepartmentLeaderboard failed: %v", err)
+	}
+
+	if len(stats) != 3 {
+		t.Fatalf("Expected 3 departments, got %d", len(stats))
+	}
+
+	top := stats[0]
+	if top.UID != "ccs" || top.TotalCoins != 300 || top.NormalizedCoins != 300 || top.RegisteredStudents != 1 {
+		t.Errorf("Unexpected top department: %+v", top)
+	}
+
+	second := stats[1]
+	if second.UID != "cba" || second.TotalCoins != 450 || second.NormalizedCoins != 225 || second.UniqueRecipients != 2 || second.MessagesCount != 2 {
+		t.Errorf("Unexpected second department: %+v", second)
+	}
+
+	if last := stats[2]; last.UID != "cea" || last.TotalCoins != 0 || last.NormalizedCoins != 0 {
+		t.Errorf("Unexpected last department: %+v", last)
+	}
+}
+
+func TestGetDepartmentLeaderboard_Cache(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Cleanup()
+	defer invalidateDepartmentLeaderboard()
+
+	saveTestDepartment(t, app, "ccs")
+	invalidateDepartmentLeaderboard()
+
+	if stats, err := getDepartmentLeaderboard(app.Dao(), defaultTenant); err != nil || len(stats) != 1 {
+		t.Fatalf("Expected 1 department, got %v (err: %v)", stats, err)
+	}
+
+	saveTestDepartment(t, app, "cba")
+	if stats, _ := getDepartmentLeaderboard(app.Dao(), defaultTenant); len(stats) != 1 {
+		t.Errorf("Expected cached result with 1 department, got %d", len(stats))
+	}
+
+	invalidateDepartmentLeaderboard()
+	if stats, _ := getDepartmentLeaderboard(app.Dao(), defaultTenant); len(stats) != 2 {
+		t.Errorf("Expected 2 departments after invalidation, got %d", len(stats))
+	}
+}
@@ -7,9 +7,10 @@ import (
 )
 
 type ResponseError struct {
-	StatusCode int    `json:"-"`
-	WError     error  `json:"-"`
-	Message    string `json:"error_message"`
+	StatusCode int            `json:"-"`
+	WError     error          `json:"-"`
+	Message    string         `json:"error_message"`
+	Data       map[string]any `json:"data,omitempty"`
 }
 
 func (re *ResponseError) Error() string {
@@ -23,5 +24,9 @@ func (re *ResponseError) Error() string {
 }
 
 func (re *ResponseError) ToApiError() error {
-	return apis.NewApiError(re.StatusCode, re.Message, re.WError)
+	apiErr := apis.NewApiError(re.StatusCode, re.Message, re.WError)
+	if len(re.Data) != 0 {
+		apiErr.Data = re.Data
+	}
+	return apiErr
 }
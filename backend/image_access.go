@@ -0,0 +1,105 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/daos"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/resolvers"
+	"github.com/pocketbase/pocketbase/tools/search"
+)
+
+// findViewableRecord finds a record the same way the collection API does
+// by applying the view rule of the collection for the requester. admins
+// can view every record.
+func findViewableRecord(dao *daos.Dao, collectionNameOrId string, id string, requestData *models.RequestData) (*models.Record, error) {
+	collection, err := dao.FindCollectionByNameOrId(collectionNameOrId)
+	if err != nil {
+		return nil, apis.NewNotFoundError("", err)
+	}
+
+	if requestData.Admin == nil && collection.ViewRule == nil {
+		// only admins can access if the rule is nil
+		return nil, apis.NewForbiddenError("Only admins can perform this action.", nil)
+	}
+
+	record, err := dao.FindRecordById(collection.Id, id, func(q *dbx.SelectQuery) error {
+		if requestData.Admin != nil || len(*collection.ViewRule) == 0 {
+			return nil
+		}
+
+		resolver := resolvers.NewRecordFieldResolver(dao, collection, requestData, true)
+		expr, err := search.FilterData(*collection.ViewRule).BuildExpr(resolver)
+		if err != nil {
+			return err
+		}
+		resolver.UpdateQuery(q)
+		q.AndWhere(expr)
+		return nil
+	})
+	if err != nil {
+		return nil, apis.NewNotFoundError("", err)
+	}
+
+	return record, nil
+}
+
+// imageShareSecretFor returns the secret for signing share links. without
+// IMAGE_SHARE_SECRET a key is derived from the auth token secret so that
+// the links are never signed with the secret of the auth tokens itself.
+func imageShareSecretFor(app core.App) string {
+	if len(imageShareSecret) != 0 {
+		return imageShareSecret
+	}
+
+	authSecret := app.Settings().RecordAuthToken.Secret
+	if len(authSecret) == 0 {
+		return ""
+	}
+
+	mac := hmac.New(sha256.New, []byte(authSecret))
+	mac.Write([]byte("image-share"))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// signImageShare signs the message id along with the expiry so that the
+// link can not be reused for other messages or after it has expired.
+func signImageShare(secret string, messageId string, expires time.Time) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%s:%d", messageId, expires.Unix())
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verifyImageShare checks the expires and signature query params of a
+// share link.
+func verifyImageShare(secret string, messageId string, rawExpires string, signature string, now time.Time) bool {
+	if len(secret) == 0 || len(signature) == 0 {
+		return false
+	}
+
+	expiresUnix, err := strconv.ParseInt(rawExpires, 10, 64)
+	if err != nil {
+		return false
+	}
+
+	expires := time.Unix(expiresUnix, 0)
+	if !now.Before(expires) {
+		return false
+	}
+
+	return hmac.Equal([]byte(signature), []byte(signImageShare(secret, messageId, expires)))
+}
+
+// imageShareURL returns the link to the image of the message that can be
+// opened by anyone until it expires.
+func imageShareURL(secret string, messageId string, expires time.Time) string {
+	return fmt.Sprintf("%s/messages/%s/image?expires=%d&signature=%s", baseUrl, messageId, expires.Unix(), signImageShare(secret, messageId, expires))
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func TestFindViewableRecord(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Cleanup()
+
+	collection, _ := app.Dao().FindCollectionByNameOrId("messages")
+	private := saveTestMessage(t, app, "user1", "202012345678", "Private")
+
+	// only admins can view records of collections without a view rule
+	_, err := findViewableRecord(app.Dao(), "messages", private.Id, &models.RequestData{})
+	if apiErr, ok := err.(*apis.ApiError); !ok || apiErr.Code != http.StatusForbidden {
+		t.Errorf("Expected forbidden error, got %v", err)
+	}
+
+	if _, err := findViewableRecord(app.Dao(), "messages", private.Id, &models.RequestData{Admin: &models.Admin{}}); err != nil {
+		t.Errorf("Expected admin to view the message, got %v", err)
+	}
+
+	collection.ViewRule = types.Pointer(`recipient = "everyone" || @request.auth.id = user`)
+	if err := app.Dao().SaveCollection(collection); err != nil {
+		t.Fatalf("Failed to update messages collection: %v", err)
+	}
+
+	users, _ := app.Dao().FindCollectionByNameOrId("users")
+	sender := models.NewRecord(users)
+	sender.Id = "user1"
+	stranger := models.NewRecord(users)
+	stranger.Id = "user2"
+
+	if _, err := findViewableRecord(app.Dao(), "messages", private.Id, &models.RequestData{}); err == nil {
+		t.Error("Expected guests to not view the private message")
+	}
+
+	if _, err := findViewableRecord(app.Dao(), "messages", private.Id, &models.RequestData{AuthRecord: stranger}); err == nil {
+		t.Error("Expected other users to not view the private message")
+	}
+
+	if _, err := findViewableRecord(app.Dao(), "messages", private.Id, &models.RequestData{AuthRecord: sender}); err != nil {
+		t.Errorf("Expected sender to view the private message, got %v", err)
+	}
+
+	public := saveTestMessage(t, app, "user1", "everyone", "Public")
+	if _, err := findViewableRecord(app.Dao(), "messages", public.Id, &models.RequestData{}); err != nil {
+		t.Errorf("Expected guests to view the public message, got %v", err)
+	}
+}
+
+func TestVerifyImageShare(t *testing.T) {
+	now := time.Date(2023, time.February, 14, 8, 0, 0, 0, time.UTC)
+	expires := now.Add(time.Hour)
+	rawExpires := "1676365200"
+	signature := signImageShare("secret", "msg1", expires)
+
+	if !verifyImageShare("secret", "msg1", rawExpires, signature, now) {
+		t.Error("Expected valid share link")
+	}
+
+	cases := map[string][]string{
+		"expired":           {"secret", "msg1", rawExpires, signature},
+		"other message":     {"secret", "msg2", rawExpires, signature},
+		"other secret":      {"other", "msg1", rawExpires, signature},
+		"extended expiry":   {"secret", "msg1", "1676368800", signature},
+		"missing secret":    {"", "msg1", rawExpires, signImageShare("", "msg1", expires)},
+		"missing signature": {"secret", "msg1", rawExpires, ""},
+	}
+
+	for name, args := range cases {
+		verifyAt := now
+		if name == "expired" {
+			verifyAt = expires
+		}
+
+		if verifyImageShare(args[0], args[1], args[2], args[3], verifyAt) {
+			t.Errorf("%s: expected share link to be rejected", name)
+		}
+	}
+}
+
+func TestImageShareSecretFor(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Cleanup()
+
+	authSecret := app.Settings().RecordAuthToken.Secret
+	derived := imageShareSecretFor(app)
+	if len(derived) == 0 || derived == authSecret {
+		t.Errorf("Expected a key derived from the auth token secret, got %q", derived)
+	}
+
+	if again := imageShareSecretFor(app); again != derived {
+		t.Errorf("Expected the derived key to be stable, got %q and %q", derived, again)
+	}
+
+	imageShareSecret = "share-secret"
+	defer func() { imageShareSecret = "" }()
+
+	if secret := imageShareSecretFor(app); secret != "share-secret" {
+		t.Errorf("Expected IMAGE_SHARE_SECRET to be used, got %q", secret)
+	}
+}
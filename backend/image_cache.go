@@ -0,0 +1,190 @@
+package main
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pocketbase/pocketbase/models"
+)
+
+// imageCacheKey changes whenever the message is updated (e.g. a reply has
+// been added) so that stale renders are never served.
+func imageCacheKey(itype ImageType, theme string, enc ImageEncoding, message *models.Record) string {
+	return fmt.Sprintf("image/%s/%s/%s/%s/%d", message.Id, itype, theme, enc, message.Updated.Time().UnixNano())
+}
+
+type diskImageCacheEntry struct {
+	name string
+	size int64
+}
+
+// DiskImageCache keeps rendered images in a directory so that they survive
+// restarts. the least recently used images are removed once the total size
+// goes over MaxSize.
+type DiskImageCache struct {
+	Dir     string
+	MaxSize int64
+
+	mu      sync.Mutex
+	size    int64
+	entries *list.List
+	index   map[string]*list.Element
+}
+
+// newDiskImageCache creates the cache directory and picks up the images
+// left by a previous run, oldest first.
+func newDiskImageCache(dir string, maxSize int64) (*DiskImageCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]os.FileInfo, 0, len(files))
+	for _, file := range files {
+		// leftovers of interrupted writes
+		if strings.HasPrefix(file.Name(), ".tmp-") {
+			passivePrintError(os.Remove(filepath.Join(dir, file.Name())))
+			continue
+		}
+
+		if info, err := file.Info(); err == nil && info.Mode().IsRegular() {
+			infos = append(infos, info)
+		}
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ModTime().Before(infos[j].ModTime())
+	})
+
+	dc := &DiskImageCache{
+		Dir:     dir,
+		MaxSize: maxSize,
+		entries: list.New(),
+		index:   map[string]*list.Element{},
+	}
+
+	for _, info := range infos {
+		dc.index[info.Name()] = dc.entries.PushFront(&diskImageCacheEntry{name: info.Name(), size: info.Size()})
+		dc.size += info.Size()
+	}
+
+	dc.evict()
+	return dc, nil
+}
+
+// fileName hashes the cache key since it contains slashes
+func (dc *DiskImageCache) fileName(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func (dc *DiskImageCache) Get(key string) ([]byte, bool) {
+	name := dc.fileName(key)
+
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+
+	elem, exists := dc.index[name]
+	data, err := os.ReadFile(filepath.Join(dc.Dir, name))
+	if err != nil {
+		if exists {
+			dc.remove(elem)
+		}
+		return nil, false
+	} else if !exists {
+		// written by another process sharing the directory, e.g. the
+		// `images warmup` command
+		elem = dc.entries.PushFront(&diskImageCacheEntry{name: name, size: int64(len(data))})
+		dc.index[name] = elem
+		dc.size += int64(len(data))
+		dc.evict()
+		if _, kept := dc.index[name]; !kept {
+			return data, true
+		}
+	}
+
+	// keep the modification time in sync with the order so that it is
+	// restored after a restart
+	now := time.Now()
+	passivePrintError(os.Chtimes(filepath.Join(dc.Dir, name), now, now))
+	dc.entries.MoveToFront(elem)
+	return data, true
+}
+
+func (dc *DiskImageCache) Set(key string, data []byte) error {
+	name := dc.fileName(key)
+
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+
+	// write to a temporary file first so that a crash never leaves a
+	// partial image behind
+	tmpFile, err := os.CreateTemp(dc.Dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmpFile.Write(data); err != nil {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+		return err
+	}
+
+	if err := tmpFile.Close(); err != nil {
+		os.Remove(tmpFile.Name())
+		return err
+	}
+
+	if err := os.Rename(tmpFile.Name(), filepath.Join(dc.Dir, name)); err != nil {
+		os.Remove(tmpFile.Name())
+		return err
+	}
+
+	if elem, exists := dc.index[name]; exists {
+		entry := elem.Value.(*diskImageCacheEntry)
+		dc.size += int64(len(data)) - entry.size
+		entry.size = int64(len(data))
+		dc.entries.MoveToFront(elem)
+	} else {
+		dc.index[name] = dc.entries.PushFront(&diskImageCacheEntry{name: name, size: int64(len(data))})
+		dc.size += int64(len(data))
+	}
+
+	dc.evict()
+	return nil
+}
+
+// Size returns the total size of the cached images in bytes
+func (dc *DiskImageCache) Size() int64 {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	return dc.size
+}
+
+func (dc *DiskImageCache) evict() {
+	for dc.size > dc.MaxSize && dc.entries.Len() != 0 {
+		dc.remove(dc.entries.Back())
+	}
+}
+
+func (dc *DiskImageCache) remove(elem *list.Element) {
+	entry := dc.entries.Remove(elem).(*diskImageCacheEntry)
+	delete(dc.index, entry.name)
+	dc.size -= entry.size
+
+	if err := os.Remove(filepath.Join(dc.Dir, entry.name)); err != nil && !os.IsNotExist(err) {
+		passivePrintError(err)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func TestImageCacheKey(t *testing.T) {
+	message := &models.Record{}
+	message.Id = "msg1"
+	message.Updated, _ = types.ParseDateTime(time.Date(2023, time.February, 14, 0, 0, 0, 0, time.UTC))
+
+	png := ImageEncoding{Format: imageFormatPNG}
+	key := imageCacheKey(imageTypeTwitter, defaultImageTheme, png, message)
+	if key == imageCacheKey(imageTypeFacebook, defaultImageTheme, png, message) {
+		t.Error("Expected image types to have different cache keys")
+	}
+
+	if key == imageCacheKey(imageTypeTwitter, "midnight", png, message) {
+		t.Error("Expected themes to have different cache keys")
+	}
+
+	webp := ImageEncoding{Format: imageFormatWebP, Quality: 80}
+	if key == imageCacheKey(imageTypeTwitter, defaultImageTheme, webp, message) {
+		t.Error("Expected formats to have different cache keys")
+	}
+
+	if imageCacheKey(imageTypeTwitter, defaultImageTheme, webp, message) == imageCacheKey(imageTypeTwitter, defaultImageTheme, ImageEncoding{Format: imageFormatWebP, Quality: 90}, message) {
+		t.Error("Expected qualities to have different cache keys")
+	}
+
+	message.Updated, _ = types.ParseDateTime(time.Date(2023, time.February, 14, 1, 0, 0, 0, time.UTC))
+	if key == imageCacheKey(imageTypeTwitter, defaultImageTheme, png, message) {
+		t.Error("Expected updated message to have a different cache key")
+	}
+}
+
+func TestDiskImageCache_Eviction(t *testing.T) {
+	dc, err := newDiskImageCache(t.TempDir(), 10)
+	if err != nil {
+		t.Fatalf("newDiskImageCache failed: %v", err)
+	}
+
+	dc.Set("a", []byte("aaaa"))
+	dc.Set("b", []byte("bbbb"))
+
+	// a becomes the most recently used so b gets evicted
+	if data, found := dc.Get("a"); !found || !bytes.Equal(data, []byte("aaaa")) {
+		t.Fatalf("Expected cached a, got %q (found: %v)", data, found)
+	}
+
+	dc.Set("c", []byte("cccc"))
+
+	if _, found := dc.Get("b"); found {
+		t.Error("Expected b to be evicted")
+	}
+
+	for _, key := range []string{"a", "c"} {
+		if _, found := dc.Get(key); !found {
+			t.Errorf("Expected %s to be cached", key)
+		}
+	}
+
+	if dc.Size() != 8 {
+		t.Errorf("Expected size of 8, got %d", dc.Size())
+	}
+}
+
+func TestDiskImageCache_Reload(t *testing.T) {
+	dir := t.TempDir()
+	dc, err := newDiskImageCache(dir, 100)
+	if err != nil {
+		t.Fatalf("newDiskImageCache failed: %v", err)
+	}
+
+	dc.Set("a", []byte("aaaa"))
+	dc.Set("b", []byte("bbbb"))
+
+	// make a the oldest file on disk
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(dir+"/"+dc.fileName("a"), old, old)
+	os.WriteFile(dir+"/.tmp-123", []byte("partial"), 0644)
+
+	reloaded, err := newDiskImageCache(dir, 4)
+	if err != nil {
+		t.Fatalf("newDiskImageCache failed: %v", err)
+	}
+
+	if _, found := reloaded.Get("a"); found {
+		t.Error("Expected oldest image to be evicted after reload")
+	}
+
+	if data, found := reloaded.Get("b"); !found || !bytes.Equal(data, []byte("bbbb")) {
+		t.Errorf("Expected cached b after reload, got %q (found: %v)", data, found)
+	}
+
+	if _, err := os.Stat(dir + "/.tmp-123"); !os.IsNotExist(err) {
+		t.Error("Expected temporary file to be removed")
+	}
+}
+
+func TestDiskImageCache_SharedDir(t *testing.T) {
+	dir := t.TempDir()
+	server, _ := newDiskImageCache(dir, 100)
+	warmup, _ := newDiskImageCache(dir, 100)
+
+	warmup.Set("a", []byte("aaaa"))
+
+	if data, found := server.Get("a"); !found || !bytes.Equal(data, []byte("aaaa")) {
+		t.Fatalf("Expected image written by another cache, got %q (found: %v)", data, found)
+	}
+
+	if server.Size() != 4 {
+		t.Errorf("Expected size of 4, got %d", server.Size())
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/fogleman/gg"
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font"
+)
+
+// imageCanvas is what the gg-based layout of the message image is drawn
+// on. the gg canvas rasterizes right away while the svg canvas keeps
+// everything as vectors so that both end up with the same layout.
+type imageCanvas interface {
+	SetColor(hex string)
+	SetFont(font ImageFont, size float64)
+	FontHeight() float64
+	MeasureString(s string) float64
+
+	// FillRectangle fills a rectangle with rounded corners if radius > 0
+	FillRectangle(x, y, w, h, radius float64)
+	DrawLine(x1, y1, x2, y2, lineWidth float64)
+
+	// DrawString draws the text with its baseline at y
+	DrawString(s string, x, y float64)
+
+	// DrawIcon draws the icon from the emojis folder with its top left
+	// corner at (x, y)
+	DrawIcon(name string, x, y, size float64)
+
+	// DrawEmoji draws an emoji that has no icon with the emoji font,
+	// centered in the square of the given size at (x, y)
+	DrawEmoji(emoji string, x, y, size float64)
+}
+
+type ggCanvas struct {
+	dc   *gg.Context
+	face font.Face
+}
+
+func newGGCanvas(width, height int) *ggCanvas {
+	return &ggCanvas{dc: gg.NewContext(width, height)}
+}
+
+func (c *ggCanvas) SetColor(hex string) {
+	c.dc.SetColor(parseHexColor(hex))
+}
+
+func (c *ggCanvas) SetFont(font ImageFont, size float64) {
+	c.face = font.Face(size)
+	c.dc.SetFontFace(c.face)
+}
+
+func (c *ggCanvas) FontHeight() float64 {
+	return c.dc.FontHeight()
+}
+
+func (c *ggCanvas) MeasureString(s string) float64 {
+	w, _ := c.dc.MeasureString(s)
+	return w
+}
+
+func (c *ggCanvas) FillRectangle(x, y, w, h, radius float64) {
+	if radius > 0 {
+		c.dc.DrawRoundedRectangle(x, y, w, h, radius)
+	} else {
+		c.dc.DrawRectangle(x, y, w, h)
+	}
+	c.dc.Fill()
+}
+
+func (c *ggCanvas) DrawLine(x1, y1, x2, y2, lineWidth float64) {
+	c.dc.SetLineWidth(lineWidth)
+	c.dc.DrawLine(x1, y1, x2, y2)
+	c.dc.Stroke()
+}
+
+func (c *ggCanvas) DrawString(s string, x, y float64) {
+	c.dc.DrawString(s, x, y)
+}
+
+func (c *ggCanvas) DrawIcon(name string, x, y, size float64) {
+	if icon := loadEmojiIcon(name, int(size)); icon != nil {
+		c.dc.DrawImage(icon, int(x), int(y))
+	}
+}
+
+// DrawEmoji falls back to the current font if the emoji font is missing so
+// that the emoji still shows up as a box instead of being left out
+func (c *ggCanvas) DrawEmoji(emoji string, x, y, size float64) {
+	if emojiFontT := loadEmojiFont(); emojiFontT != nil {
+		c.dc.SetFontFace(truetype.NewFace(emojiFontT, &truetype.Options{Size: size * 0.8}))
+		defer c.dc.SetFontFace(c.face)
+	}
+
+	glyph := emojiGlyph(emoji)
+	w, _ := c.dc.MeasureString(glyph)
+	c.dc.DrawString(glyph, x+(size-w)/2, y+size*0.85)
+}
+
+// svgCanvas writes the drawing operations as svg elements. text is still
+// measured with the truetype fonts of the gg renderer and the fonts and
+// icons are embedded so that the svg looks the same when loaded through an
+// <img> tag, which can not fetch external resources.
+type svgCanvas struct {
+	width  int
+	height int
+
+	// only used for measuring text
+	measure *gg.Context
+
+	color    string
+	font     ImageFont
+	fontSize float64
+
+	fonts []ImageFont
+	icons []string
+	body  bytes.Buffer
+}
+
+func newSVGCanvas(width, height int) *svgCanvas {
+	return &svgCanvas{
+		width:   width,
+		height:  height,
+		measure: gg.NewContext(1, 1),
+		color:   "#000000",
+	}
+}
+
+// svgNumber formats coordinates with at most two decimal places
+func svgNumber(v float64) string {
+	return strconv.FormatFloat(math.Round(v*100)/100, 'f', -1, 64)
+}
+
+func (c *svgCanvas) SetColor(hex string) {
+	c.color = hex
+}
+
+func (c *svgCanvas) SetFont(font ImageFont, size float64) {
+	c.font = font
+	c.fontSize = size
+	c.measure.SetFontFace(font.Face(size))
+
+	for _, f := range c.fonts {
+		if f == font {
+			return
+		}
+	}
+	c.fonts = append(c.fonts, font)
+}
+
+func (c *svgCanvas) FontHeight() float64 {
+	return c.measure.FontHeight()
+}
+
+func (c *svgCanvas) MeasureString(s string) float64 {
+	w, _ := c.measure.MeasureString(s)
+	return w
+}
+
+func (c *svgCanvas) FillRectangle(x, y, w, h, radius float64) {
+	fmt.Fprintf(&c.body, `<rect x="%s" y="%s" width="%s" height="%s"`, svgNumber(x), svgNumber(y), svgNumber(w), svgNumber(h))
+	if radius > 0 {
+		fmt.Fprintf(&c.body, ` rx="%s"`, svgNumber(radius))
+	}
+	fmt.Fprintf(&c.body, ` fill="%s"/>`, c.color)
+}
+
+func (c *svgCanvas) DrawLine(x1, y1, x2, y2, lineWidth float64) {
+	fmt.Fprintf(&c.body, `<line x1="%s" y1="%s" x2="%s" y2="%s" stroke="%s" stroke-width="%s"/>`,
+		svgNumber(x1), svgNumber(y1), svgNumber(x2), svgNumber(y2), c.color, svgNumber(lineWidth))
+}
+
+func (c *svgCanvas) DrawString(s string, x, y float64) {
+	fmt.Fprintf(&c.body, `<text x="%s" y="%s" font-family="%s" font-size="%s" fill="%s" xml:space="preserve">`,
+		svgNumber(x), svgNumber(y), c.font.Family, svgNumber(c.fontSize), c.color)
+	xml.EscapeText(&c.body, []byte(s))
+	c.body.WriteString(`</text>`)
+}
+
+// DrawIcon references the icon defined once in <defs>. the icon is defined
+// as a 1x1 image so that it can be sized with a transform.
+func (c *svgCanvas) DrawIcon(name string, x, y, size float64) {
+	if !hasEmojiIcon(name) {
+		return
+	}
+
+	found := false
+	for _, icon := range c.icons {
+		found = found || icon == name
+	}
+	if !found {
+		c.icons = append(c.icons, name)
+	}
+
+	fmt.Fprintf(&c.body, `<use href="#icon-%s" transform="translate(%s %s) scale(%s)"/>`, name, svgNumber(x), svgNumber(y), svgNumber(size))
+}
+
+// DrawEmoji keeps the whole emoji sequence since the browser falls back to
+// the emoji font of the system
+func (c *svgCanvas) DrawEmoji(emoji string, x, y, size float64) {
+	fmt.Fprintf(&c.body, `<text x="%s" y="%s" font-family="%s" font-size="%s" fill="%s" text-anchor="middle">`,
+		svgNumber(x+size/2), svgNumber(y+size*0.85), c.font.Family, svgNumber(size*0.8), c.color)
+	xml.EscapeText(&c.body, []byte(emoji))
+	c.body.WriteString(`</text>`)
+}
+
+// Encode writes the svg document along with the fonts and icons used
+func (c *svgCanvas) Encode(wr io.Writer) error {
+	out := &bytes.Buffer{}
+	fmt.Fprintf(out, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`, c.width, c.height, c.width, c.height)
+	out.WriteString(`<defs><style>`)
+	for _, font := range c.fonts {
+		data, err := os.ReadFile(filepath.Join(".", "renderer_assets", "fonts", font.Path+".woff2"))
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(out, `@font-face{font-family:'%s';src:url(data:font/woff2;base64,%s) format('woff2');}`, font.Family, base64.StdEncoding.EncodeToString(data))
+	}
+	out.WriteString(`</style>`)
+
+	for _, name := range c.icons {
+		data, err := os.ReadFile(filepath.Join(emojiAssetsDir, name+".svg"))
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(out, `<image id="icon-%s" width="1" height="1" href="data:image/svg+xml;base64,%s"/>`, name, base64.StdEncoding.EncodeToString(data))
+	}
+	out.WriteString(`</defs>`)
+
+	out.Write(c.body.Bytes())
+	out.WriteString(`</svg>`)
+
+	_, err := wr.Write(out.Bytes())
+	return err
+}
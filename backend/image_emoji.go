@@ -0,0 +1,231 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/golang/freetype/truetype"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/srwiley/oksvg"
+	"github.com/srwiley/rasterx"
+)
+
+var emojiAssetsDir = filepath.Join(".", "renderer_assets", "emojis")
+
+// emojiAliases maps emoji to the gift icons bundled in the emojis folder.
+// other emoji are looked up by their codepoints (e.g. 1f600.svg) and drawn
+// with the emoji font if there is no such icon.
+var emojiAliases = map[string]string{
+	"❤": "heart",
+	"♥": "heart",
+	"💖": "heart",
+	"💕": "heart",
+	"🌹": "rose",
+	"🌻": "sunflower",
+	"🎈": "balloons",
+	"🍫": "chocolate",
+	"🍕": "pizza",
+	"💍": "ring",
+	"🧸": "teddy-bear",
+	"💰": "money",
+	"💵": "money",
+	"🧋": "milk-tea",
+}
+
+var emojiIcons = struct {
+	sync.Mutex
+	parsed   map[string]*oksvg.SvgIcon
+	rendered map[string]image.Image
+}{
+	parsed:   map[string]*oksvg.SvgIcon{},
+	rendered: map[string]image.Image{},
+}
+
+// parseEmojiIcon reads the svg icon of the given name. the emojiIcons
+// lock has to be held by the caller.
+func parseEmojiIcon(name string) *oksvg.SvgIcon {
+	icon, exists := emojiIcons.parsed[name]
+	if !exists {
+		if file, err := os.Open(filepath.Join(emojiAssetsDir, name+".svg")); err == nil {
+			icon, err = oksvg.ReadIconStream(file, oksvg.IgnoreErrorMode)
+			passivePrintError(err)
+			file.Close()
+		}
+
+		// missing icons are remembered as nil as well
+		emojiIcons.parsed[name] = icon
+	}
+	return icon
+}
+
+// hasEmojiIcon tells whether the icon of the given name exists
+func hasEmojiIcon(name string) bool {
+	emojiIcons.Lock()
+	defer emojiIcons.Unlock()
+	return parseEmojiIcon(name) != nil
+}
+
+// loadEmojiIcon rasterizes the svg icon of the given name into a square
+// image of the given size. nil is returned if the icon does not exist.
+func loadEmojiIcon(name string, size int) image.Image {
+	emojiIcons.Lock()
+	defer emojiIcons.Unlock()
+
+	key := fmt.Sprintf("%s@%d", name, size)
+	if img, exists := emojiIcons.rendered[key]; exists {
+		return img
+	}
+
+	var img image.Image
+	if icon := parseEmojiIcon(name); icon != nil {
+		rgba := image.NewRGBA(image.Rect(0, 0, size, size))
+		icon.SetTarget(0, 0, float64(size), float64(size))
+		scanner := rasterx.NewScannerGV(size, size, rgba, rgba.Bounds())
+		icon.Draw(rasterx.NewDasher(size, size, scanner), 1)
+		img = rgba
+	}
+
+	emojiIcons.rendered[key] = img
+	return img
+}
+
+var emojiFont = struct {
+	sync.Once
+	font *truetype.Font
+}{}
+
+// loadEmojiFont loads the font at emojiFontPath once. nil is returned if
+// the font is not available.
+func loadEmojiFont() *truetype.Font {
+	emojiFont.Do(func() {
+		fontData, err := os.ReadFile(emojiFontPath)
+		if err != nil {
+			log.Printf("emoji font not available, drawing emoji with the text font instead: %v\n", err)
+			return
+		}
+
+		emojiFont.font, err = truetype.Parse(fontData)
+		passivePrintError(err)
+	})
+	return emojiFont.font
+}
+
+// emojiGlyph returns the part of an emoji sequence that is drawn with a
+// font. fonts without color glyphs can not draw joined emoji or skin tones
+// so only the base emoji is kept.
+func emojiGlyph(emoji string) string {
+	for _, r := range emoji {
+		return string(r)
+	}
+	return emoji
+}
+
+// emojiIconName returns the icon name of an emoji sequence
+func emojiIconName(emoji string) string {
+	// variation selectors are not part of the file names
+	emoji = strings.ReplaceAll(emoji, "\ufe0f", "")
+	if alias, exists := emojiAliases[emoji]; exists {
+		return alias
+	}
+
+	codepoints := []string{}
+	for _, r := range emoji {
+		codepoints = append(codepoints, fmt.Sprintf("%x", r))
+	}
+	return strings.Join(codepoints, "-")
+}
+
+func isEmojiRune(r rune) bool {
+	return (r >= 0x1f000 && r <= 0x1faff) || (r >= 0x2600 && r <= 0x27bf) || r == 0x2b50
+}
+
+// isEmojiModifier tells whether the rune continues the previous emoji
+// (variation selectors, zero width joiners and skin tones)
+func isEmojiModifier(r rune) bool {
+	return r == 0xfe0f || r == 0x200d || (r >= 0x1f3fb && r <= 0x1f3ff)
+}
+
+// richTextSegment is either a run of text or a single emoji
+type richTextSegment struct {
+	text  string
+	emoji string
+}
+
+// splitRichText splits a word into its text and emoji segments
+func splitRichText(word string) []richTextSegment {
+	segments := []richTextSegment{}
+	text := &strings.Builder{}
+	runes := []rune(word)
+
+	for i := 0; i < len(runes); i++ {
+		if !isEmojiRune(runes[i]) {
+			text.WriteRune(runes[i])
+			continue
+		}
+
+		if text.Len() != 0 {
+			segments = append(segments, richTextSegment{text: text.String()})
+			text.Reset()
+		}
+
+		emoji := string(runes[i])
+		for i+1 < len(runes) && isEmojiModifier(runes[i+1]) {
+			i++
+			emoji += string(runes[i])
+
+			// joined emoji, e.g. 👩‍❤️‍👨
+			if runes[i] == 0x200d && i+1 < len(runes) {
+				i++
+				emoji += string(runes[i])
+			}
+		}
+
+		segments = append(segments, richTextSegment{emoji: emoji})
+	}
+
+	if text.Len() != 0 {
+		segments = append(segments, richTextSegment{text: text.String()})
+	}
+
+	return segments
+}
+
+// messageGiftIcons returns the icon names of the expanded gifts of the
+// message that have icons
+func messageGiftIcons(message *models.Record) []string {
+	gifts := []*models.Record{}
+	switch expanded := message.Expand()["gifts"].(type) {
+	case []*models.Record:
+		gifts = expanded
+	case *models.Record:
+		gifts = append(gifts, expanded)
+	}
+
+	icons := []string{}
+	for _, gift := range gifts {
+		if name := gift.GetString("uid"); hasEmojiIcon(name) {
+			icons = append(icons, name)
+		}
+	}
+	return icons
+}
+
+// drawGiftIcons draws the icons of the expanded gifts of the message in a
+// row centered at (x, y).
+func drawGiftIcons(canvas imageCanvas, message *models.Record, x, y, size float64) {
+	icons := messageGiftIcons(message)
+	if len(icons) == 0 {
+		return
+	}
+
+	gap := size * 0.25
+	startX := x - (float64(len(icons))*size+float64(len(icons)-1)*gap)/2
+	for i, name := range icons {
+		canvas.DrawIcon(name, startX+float64(i)*(size+gap), y-size/2, size)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/models"
+)
+
+func TestSplitRichText(t *testing.T) {
+	cases := map[string][]richTextSegment{
+		"hello":    {{text: "hello"}},
+		"hi🌹":      {{text: "hi"}, {emoji: "🌹"}},
+		"❤️love❤️": {{emoji: "❤️"}, {text: "love"}, {emoji: "❤️"}},
+		"👩‍❤️‍👨!":  {{emoji: "👩‍❤️‍👨"}, {text: "!"}},
+		"👍🏽":       {{emoji: "👍🏽"}},
+	}
+
+	for word, expected := range cases {
+		if got := splitRichText(word); !reflect.DeepEqual(got, expected) {
+			t.Errorf("%q: expected %+v, got %+v", word, expected, got)
+		}
+	}
+}
+
+func TestEmojiIconName(t *testing.T) {
+	cases := map[string]string{
+		"🌹":  "rose",
+		"❤️": "heart",
+		"💖":  "heart",
+		"😀":  "1f600",
+		"👍🏽": "1f44d-1f3fd",
+	}
+
+	for emoji, expected := range cases {
+		if got := emojiIconName(emoji); got != expected {
+			t.Errorf("%q: expected %q, got %q", emoji, expected, got)
+		}
+	}
+}
+
+func TestLoadEmojiIcon(t *testing.T) {
+	icon := loadEmojiIcon("rose", 32)
+	if icon == nil {
+		t.Fatal("Expected rose icon to be loaded")
+	}
+
+	if bounds := icon.Bounds(); bounds.Dx() != 32 || bounds.Dy() != 32 {
+		t.Errorf("Expected 32x32 icon, got %dx%d", bounds.Dx(), bounds.Dy())
+	}
+
+	if loadEmojiIcon("1f600", 32) != nil {
+		t.Error("Expected missing icon to be nil")
+	}
+}
+
+func TestDrawGiftIcons(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Cleanup()
+
+	collection, _ := app.Dao().FindCollectionByNameOrId("messages")
+	message := models.NewRecord(collection)
+	message.SetExpand(map[string]any{
+		"gifts": []*models.Record{saveTestGift(t, app, "rose", 10, false)},
+	})
+
+	canvas := newGGCanvas(100, 100)
+	drawGiftIcons(canvas, message, 50, 50, 40)
+
+	if _, _, _, alpha := canvas.dc.Image().At(50, 50).RGBA(); alpha == 0 {
+		t.Error("Expected gift icon to be drawn at the center")
+	}
+
+	// messages without gifts are left as is
+	empty := newGGCanvas(100, 100)
+	drawGiftIcons(empty, models.NewRecord(collection), 50, 50, 40)
+	if _, _, _, alpha := empty.dc.Image().At(50, 50).RGBA(); alpha != 0 {
+		t.Error("Expected nothing to be drawn without gifts")
+	}
+}
+
+func TestDrawTextLayout_Emoji(t *testing.T) {
+	// 💖 is drawn from the heart icon while 😀 has no icon and is drawn
+	// with the emoji font
+	for _, emoji := range []string{"\U0001F496", "\U0001F600"} {
+		canvas := newGGCanvas(100, 100)
+		canvas.SetFont(latoFont, 40)
+		canvas.SetColor("#000000")
+
+		layout := layoutRichText(canvas, latoFont, emoji, 100, 100, 40, 40, 1)
+		if width := richTextWidth(canvas, layout.Lines[0], layout.FontHeight); width != layout.FontHeight {
+			t.Errorf("%q: expected the emoji to be %f wide, got %f", emoji, layout.FontHeight, width)
+		}
+
+		drawTextLayout(canvas, layout, 50, 50)
+
+		drawn := false
+		img := canvas.dc.Image()
+		for y := 0; y < 100 && !drawn; y++ {
+			for x := 0; x < 100 && !drawn; x++ {
+				_, _, _, alpha := img.At(x, y).RGBA()
+				drawn = alpha != 0
+			}
+		}
+
+		if !drawn {
+			t.Errorf("%q: expected the emoji to be drawn", emoji)
+		}
+	}
+}
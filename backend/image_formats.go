@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"strconv"
+	"strings"
+)
+
+type ImageFormat int
+
+const (
+	imageFormatPNG  ImageFormat = 0
+	imageFormatJPEG ImageFormat = 1
+	imageFormatWebP ImageFormat = 2
+	imageFormatSVG  ImageFormat = 3
+)
+
+var imageFormats = []ImageFormat{imageFormatPNG, imageFormatJPEG, imageFormatWebP, imageFormatSVG}
+
+// String returns the name of the format used in the ?format= parameter of
+// the image endpoint.
+func (f ImageFormat) String() string {
+	switch f {
+	case imageFormatPNG:
+		return "png"
+	case imageFormatJPEG:
+		return "jpeg"
+	case imageFormatWebP:
+		return "webp"
+	case imageFormatSVG:
+		return "svg"
+	default:
+		return "unknown"
+	}
+}
+
+func (f ImageFormat) ContentType() string {
+	switch f {
+	case imageFormatJPEG:
+		return "image/jpeg"
+	case imageFormatWebP:
+		return "image/webp"
+	case imageFormatSVG:
+		return "image/svg+xml"
+	default:
+		return "image/png"
+	}
+}
+
+// parseImageFormat finds the image format by its name. png is used if no
+// format is given.
+func parseImageFormat(name string) (ImageFormat, error) {
+	if len(name) == 0 {
+		return imageFormatPNG, nil
+	}
+
+	for _, format := range imageFormats {
+		if format.String() == name || (format == imageFormatJPEG && name == "jpg") {
+			return format, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown image format '%s'", name)
+}
+
+// negotiateImageFormat picks the format from the Accept header of the
+// client. webp is only served to clients that explicitly accept it and svg
+// has to be requested through ?format=.
+func negotiateImageFormat(accept string) ImageFormat {
+	for _, mediaRange := range strings.Split(accept, ",") {
+		params := strings.Split(mediaRange, ";")
+		if strings.TrimSpace(params[0]) != "image/webp" {
+			continue
+		}
+
+		for _, param := range params[1:] {
+			name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if q, err := strconv.ParseFloat(value, 64); name == "q" && err == nil && q == 0 {
+				return imageFormatPNG
+			}
+		}
+
+		return imageFormatWebP
+	}
+
+	return imageFormatPNG
+}
+
+// ImageEncoding is the format of a rendered image along with its quality
+// setting. the quality is only used by the lossy formats.
+type ImageEncoding struct {
+	Format  ImageFormat
+	Quality int
+}
+
+// imageEncodingFor returns the encoding of the format using the qualities
+// from the config.
+func imageEncodingFor(format ImageFormat) ImageEncoding {
+	switch format {
+	case imageFormatJPEG:
+		return ImageEncoding{Format: format, Quality: imageJPEGQuality}
+	case imageFormatWebP:
+		return ImageEncoding{Format: format, Quality: imageWebPQuality}
+	default:
+		return ImageEncoding{Format: format}
+	}
+}
+
+// String is used in the image cache keys so that changing the quality
+// settings does not serve images encoded with the old ones.
+func (enc ImageEncoding) String() string {
+	if enc.Quality == 0 {
+		return enc.Format.String()
+	}
+	return fmt.Sprintf("%s-q%d", enc.Format, enc.Quality)
+}
+
+// encodeImage encodes the image drawn by the gg-based renderer. webp images
+// are encoded losslessly by encodeWebP as there is no lossy encoder
+// available in Go.
+func encodeImage(wr io.Writer, img image.Image, enc ImageEncoding) error {
+	switch enc.Format {
+	case imageFormatPNG:
+		return png.Encode(wr, img)
+	case imageFormatJPEG:
+		return jpeg.Encode(wr, img, &jpeg.Options{Quality: enc.Quality})
+	case imageFormatWebP:
+		return encodeWebP(wr, img)
+	default:
+		return fmt.Errorf("%s images can not be encoded from a raster image", enc.Format)
+	}
+}
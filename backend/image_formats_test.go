@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"image"
+	"image/jpeg"
+	"strings"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/models"
+	"golang.org/x/image/webp"
+)
+
+func TestParseImageFormat(t *testing.T) {
+	cases := map[string]ImageFormat{
+		"":     imageFormatPNG,
+		"png":  imageFormatPNG,
+		"jpeg": imageFormatJPEG,
+		"jpg":  imageFormatJPEG,
+		"webp": imageFormatWebP,
+		"svg":  imageFormatSVG,
+	}
+
+	for name, expected := range cases {
+		got, err := parseImageFormat(name)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", name, err)
+		} else if got != expected {
+			t.Errorf("%q: expected %s, got %s", name, expected, got)
+		}
+	}
+
+	if _, err := parseImageFormat("gif"); err == nil {
+		t.Error("Expected error for unknown image format, got nil")
+	}
+}
+
+func TestNegotiateImageFormat(t *testing.T) {
+	cases := map[string]ImageFormat{
+		"":                                   imageFormatPNG,
+		"*/*":                                imageFormatPNG,
+		"image/avif,image/webp,*/*;q=0.8":    imageFormatWebP,
+		"image/webp;q=0.5, image/png":        imageFormatWebP,
+		"image/webp;q=0,image/*":             imageFormatPNG,
+		"image/svg+xml,image/png,image/jpeg": imageFormatPNG,
+	}
+
+	for accept, expected := range cases {
+		if got := negotiateImageFormat(accept); got != expected {
+			t.Errorf("%q: expected %s, got %s", accept, expected, got)
+		}
+	}
+}
+
+func TestGenerateImage_Formats(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Cleanup()
+
+	collection, _ := app.Dao().FindCollectionByNameOrId("messages")
+	message := models.NewRecord(collection)
+	message.Set("content", "Roses are red 🌹 & so are you")
+	message.SetExpand(map[string]any{
+		"gifts": []*models.Record{saveTestGift(t, app, "rose", 10, false)},
+	})
+
+	decoders := map[ImageFormat]func(*bytes.Buffer) (image.Image, error){
+		imageFormatJPEG: func(buf *bytes.Buffer) (image.Image, error) { return jpeg.Decode(buf) },
+		imageFormatWebP: func(buf *bytes.Buffer) (image.Image, error) { return webp.Decode(buf) },
+	}
+
+	for format, decode := range decoders {
+		buf := &bytes.Buffer{}
+		if err := generateImage(buf, imageTypeTwitter, imageEncodingFor(format), message); err != nil {
+			t.Fatalf("%s: generateImage failed: %v", format, err)
+		}
+
+		img, err := decode(buf)
+		if err != nil {
+			t.Fatalf("%s: failed to decode image: %v", format, err)
+		}
+
+		if bounds := img.Bounds(); bounds.Dx() != 1200 || bounds.Dy() != 675 {
+			t.Errorf("%s: expected 1200x675, got %dx%d", format, bounds.Dx(), bounds.Dy())
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	if err := generateImage(buf, imageTypeTwitter, imageEncodingFor(imageFormatSVG), message); err != nil {
+		t.Fatalf("svg: generateImage failed: %v", err)
+	}
+
+	svg := buf.String()
+	if err := xml.Unmarshal(buf.Bytes(), new(struct{})); err != nil {
+		t.Fatalf("svg: invalid document: %v", err)
+	}
+
+	for _, expected := range []string{`width="1200" height="675"`, "@font-face", "&amp; so are you</text>", `id="icon-rose"`, `href="#icon-rose"`} {
+		if !strings.Contains(svg, expected) {
+			t.Errorf("svg: expected %q in the document", expected)
+		}
+	}
+}
+
+func TestGenerateImage_WebPSmallerThanPNG(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Cleanup()
+
+	collection, _ := app.Dao().FindCollectionByNameOrId("messages")
+	message := models.NewRecord(collection)
+	message.Set("content", "Roses are red, violets are blue, happy valentines to the one and only you")
+
+	// clients that accept webp get it instead of png so it has to be
+	// smaller for every theme
+	for _, theme := range imageThemes {
+		message.Set("theme", theme.ID)
+
+		pngBuf, webpBuf := &bytes.Buffer{}, &bytes.Buffer{}
+		if err := generateImage(pngBuf, imageTypeTwitter, imageEncodingFor(imageFormatPNG), message); err != nil {
+			t.Fatalf("%s: png: generateImage failed: %v", theme.ID, err)
+		}
+
+		if err := generateImage(webpBuf, imageTypeTwitter, imageEncodingFor(imageFormatWebP), message); err != nil {
+			t.Fatalf("%s: webp: generateImage failed: %v", theme.ID, err)
+		}
+
+		if webpBuf.Len() >= pngBuf.Len() {
+			t.Errorf("%s: expected webp (%d bytes) to be smaller than png (%d bytes)", theme.ID, webpBuf.Len(), pngBuf.Len())
+		}
+	}
+}
@@ -2,18 +2,14 @@ package main
 
 import (
 	"bytes"
-	"context"
 	"fmt"
 	"html/template"
 	"io"
 	"log"
+	"math"
 	"os"
-	"sync"
 	"time"
 
-	"github.com/chromedp/cdproto/page"
-	"github.com/chromedp/chromedp"
-	"github.com/fogleman/gg"
 	"github.com/golang/freetype/truetype"
 	"github.com/patrickmn/go-cache"
 	"github.com/pocketbase/pocketbase/models"
@@ -27,18 +23,56 @@ func (i ImageType) Size() (width int, height int) {
 		return 1200, 630
 	case imageTypeTwitter:
 		return 1200, 675
+	case imageTypeInstagramStory:
+		return 1080, 1920
+	case imageTypeInstagramSquare:
+		return 1080, 1080
 	default:
 		return 0, 0
 	}
 }
 
+// String returns the name of the image type used in the ?type= parameter
+// of the image endpoint and in the template.
+func (i ImageType) String() string {
+	switch i {
+	case imageTypeFacebook:
+		return "facebook"
+	case imageTypeTwitter:
+		return "twitter"
+	case imageTypeInstagramStory:
+		return "story"
+	case imageTypeInstagramSquare:
+		return "square"
+	default:
+		return "unknown"
+	}
+}
+
 const (
-	imageTypeFacebook ImageType = 0
-	imageTypeTwitter  ImageType = 1
+	imageTypeFacebook        ImageType = 0
+	imageTypeTwitter         ImageType = 1
+	imageTypeInstagramStory  ImageType = 2
+	imageTypeInstagramSquare ImageType = 3
 )
 
-var latoLight *truetype.Font
-var nanumPenScript *truetype.Font
+var imageTypes = []ImageType{imageTypeFacebook, imageTypeTwitter, imageTypeInstagramStory, imageTypeInstagramSquare}
+
+// parseImageType finds the image type by its name. twitter is used if no
+// type is given.
+func parseImageType(name string) (ImageType, error) {
+	if len(name) == 0 {
+		return imageTypeTwitter, nil
+	}
+
+	for _, itype := range imageTypes {
+		if itype.String() == name {
+			return itype, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown image type '%s'", name)
+}
 
 func loadFont(path string) *truetype.Font {
 	fontData, err := os.ReadFile(path)
@@ -54,168 +88,191 @@ func loadFont(path string) *truetype.Font {
 	return fontT
 }
 
-func init() {
-	latoLight = loadFont("./renderer_assets/fonts/lato/lato-v22-latin-regular.ttf")
-	nanumPenScript = loadFont("./renderer_assets/fonts/nanum-pen-script/nanum-pen-script-v15-latin-regular.ttf")
-}
+// how long the images drawn by the gg-based renderer in place of chrome are
+// kept. they are kept apart from the chrome renders and only briefly so
+// that the images are rendered by chrome again once it catches up.
+const imageFallbackCacheTTL = time.Minute
 
 type ImageRenderer struct {
 	// for chrome-based image renderer
-	ChromeCtx  context.Context
+	ChromePool *ChromeRenderPool
 	Funcs      template.FuncMap
-	Template   *template.Template
+	Templates  *template.Template
 	CacheStore *cache.Cache
+
+	// optional, images are only kept in memory if nil
+	DiskCache *DiskImageCache
 }
 
-func (ctx *ImageRenderer) Render(itype ImageType, message *models.Record) ([]byte, error) {
+// TemplateFor returns the html template of the theme
+func (ctx *ImageRenderer) TemplateFor(theme *ImageTheme) (*template.Template, error) {
+	if ctx.Templates == nil {
+		return nil, fmt.Errorf("no html templates loaded")
+	}
+
+	tmpl := ctx.Templates.Lookup(theme.Template)
+	if tmpl == nil {
+		return nil, fmt.Errorf("template '%s' of theme '%s' not found", theme.Template, theme.ID)
+	}
+
+	return tmpl, nil
+}
+
+// Render renders the image of the message in the given encoding. svg
+// images are always drawn by the gg-based layout.
+func (ctx *ImageRenderer) Render(itype ImageType, enc ImageEncoding, message *models.Record) ([]byte, error) {
+	theme := messageImageTheme(message)
+
 	// use cached image if available
-	imageCacheKey := fmt.Sprintf("image/%s", message.Id)
+	imageCacheKey := imageCacheKey(itype, theme.ID, enc, message)
 	if cachedImage, isImageCached := ctx.CacheStore.Get(imageCacheKey); isImageCached && cachedImage != nil {
 		log.Println("using cached image...")
 		return cachedImage.([]byte), nil
 	}
 
+	if ctx.DiskCache != nil {
+		if cachedImage, isImageCached := ctx.DiskCache.Get(imageCacheKey); isImageCached {
+			ctx.CacheStore.Set(imageCacheKey, cachedImage, cache.DefaultExpiration)
+			return cachedImage, nil
+		}
+	}
+
+	fallbackCacheKey := imageCacheKey + "/fallback"
+	if cachedImage, isImageCached := ctx.CacheStore.Get(fallbackCacheKey); isImageCached && cachedImage != nil {
+		return cachedImage.([]byte), nil
+	}
+
 	imgBuf := &bytes.Buffer{}
 	var err error
-	if ctx.ChromeCtx != nil {
-		// use alternative gg-based mode if not connected to chrome
-		err = generateImagePNGChrome(imgBuf, ctx.ChromeCtx, ctx.Template, RendererContext{
-			RawMessage: message,
-			BackendURL: baseUrl,
-		})
+	usesChrome := ctx.ChromePool != nil && enc.Format != imageFormatSVG
+	if usesChrome {
+		// use alternative gg-based mode if not connected to chrome or if
+		// the chrome renderer is busy or failed
+		var tmpl *template.Template
+		if tmpl, err = ctx.TemplateFor(theme); err == nil {
+			var buf []byte
+			rctx := newRendererContext(itype, message)
+			rctx.Encoding = enc
+			buf, err = ctx.ChromePool.Render(tmpl, rctx)
+			imgBuf.Write(buf)
+		}
 	}
 
 	if err != nil || imgBuf.Len() == 0 {
 		passivePrintError(err)
-		if err2 := generateImagePNG(imgBuf, imageTypeTwitter, message); err2 != nil {
+		imgBuf.Reset()
+		if err2 := generateImage(imgBuf, itype, enc, message); err2 != nil {
 			return nil, err2
 		}
+
+		if usesChrome {
+			ctx.CacheStore.Set(fallbackCacheKey, imgBuf.Bytes(), imageFallbackCacheTTL)
+			return imgBuf.Bytes(), nil
+		}
 	}
 
 	if imgBuf.Len() != 0 {
 		ctx.CacheStore.Set(imageCacheKey, imgBuf.Bytes(), cache.DefaultExpiration)
+		if ctx.DiskCache != nil {
+			passivePrintError(ctx.DiskCache.Set(imageCacheKey, imgBuf.Bytes()))
+		}
 	}
 	return imgBuf.Bytes(), nil
 }
 
-func generateImagePNG(wr io.Writer, itype ImageType, message *models.Record) error {
+// generateImage draws the message without chrome, either as vectors for
+// svg images or rasterized for the other formats.
+func generateImage(wr io.Writer, itype ImageType, enc ImageEncoding, message *models.Record) error {
+	width, height := itype.Size()
+	if enc.Format == imageFormatSVG {
+		canvas := newSVGCanvas(width, height)
+		drawMessageImage(canvas, itype, message)
+		return canvas.Encode(wr)
+	}
+
+	canvas := newGGCanvas(width, height)
+	drawMessageImage(canvas, itype, message)
+	return encodeImage(wr, canvas.dc.Image(), enc)
+}
+
+func drawMessageImage(canvas imageCanvas, itype ImageType, message *models.Record) {
 	margin := float64(50)
 	doubleMargin := 2.0 * margin
 	innerContainerMargin := 4.0 * margin
 	width, height := itype.Size()
-	dc := gg.NewContext(width, height)
 
 	containerStartX := float64(width) - doubleMargin
 	containerEndY := float64(height) - doubleMargin
 	innerContainerStartX := float64(width) - innerContainerMargin
 	centerX := float64(width) / 2
-	centerY := float64(height) / 2
 
-	dc.DrawRectangle(0, 0, float64(width), float64(height))
-	dc.SetRGB255(251, 207, 232)
-	dc.Fill()
+	// text is sized after the shorter side so that it fits both the
+	// landscape and the portrait types
+	shortSide := math.Min(float64(width), float64(height))
+	theme := messageImageTheme(message)
 
-	dc.DrawRoundedRectangle(margin, margin, containerStartX, containerEndY, 30.0*float64(width/height))
-	dc.SetRGB255(250, 242, 186)
-	dc.Fill()
+	canvas.SetColor(theme.Palette.Background)
+	canvas.FillRectangle(0, 0, float64(width), float64(height), 0)
 
-	// content := `Molestie id vulputate condimentum tempus nisi interdum scelerisque odio habitasse consectetur suspendisse hac id eu adipiscing.Arcu ridiculus felis nec adipiscing gravida platea neque parturient posuere faucibus laoreet vestibulum feugiat.`
-	content := message.GetString("content")
-	fontReductionFactor := 1.0
-	threshold := 110.0
-	lineHeight := 1.5
-	offsetY := 20.0
+	canvas.SetColor(theme.Palette.Paper)
+	canvas.FillRectangle(margin, margin, containerStartX, containerEndY, 30.0)
 
-	for size := float64(len(content)); size > threshold; size -= threshold {
-		fontReductionFactor -= 0.09
-		lineHeight -= 0.23
-		offsetY -= 7
+	// the content is laid out between the gifts and the footer
+	giftSize := shortSide * 0.12
+	footerSize := shortSide * 0.02
+	textTop := doubleMargin
+	if len(messageGiftIcons(message)) != 0 {
+		textTop += giftSize/2 + margin/2
 	}
+	textBottom := containerEndY + 10 - footerSize*1.5 - margin/2
+
+	layout := layoutRichText(canvas, theme.ContentFont, message.GetString("content"),
+		innerContainerStartX, textBottom-textTop, shortSide*0.025, shortSide*0.075, 1.35)
+	textCenterY := (textTop + textBottom) / 2
 
-	fontSize := (float64(height) * 0.075) * fontReductionFactor
+	// paper lines follow the baselines of the text
+	if len(theme.Palette.Lines) != 0 {
+		pitch := layout.FontHeight * layout.LineSpacing
+		firstLine := textCenterY - layout.Height()/2 + layout.FontHeight*1.2
+		paperTop, paperBottom := margin+30, float64(height)-margin-30
 
-	// paper lines
-	dc.SetRGB255(24, 74, 153)
-	dc.SetLineWidth(2)
-	for w := 20.0; doubleMargin+w < containerEndY; w += fontSize + 3 {
-		y := doubleMargin + w
-		dc.DrawLine(margin, y, float64(width)-margin, y)
-		dc.Stroke()
+		canvas.SetColor(theme.Palette.Lines)
+		for y := firstLine - math.Floor((firstLine-paperTop)/pitch)*pitch; y <= paperBottom; y += pitch {
+			canvas.DrawLine(margin, y, float64(width)-margin, y, 2)
+		}
 	}
 
-	dc.SetRGB255(0, 0, 0)
-	dc.SetFontFace(truetype.NewFace(nanumPenScript, &truetype.Options{
-		Size: fontSize,
-	}))
-	dc.DrawStringWrapped(content, centerX, centerY+offsetY, 0.5, 0.5, innerContainerStartX, lineHeight, gg.AlignCenter)
+	canvas.SetColor(theme.Palette.Text)
+	canvas.SetFont(theme.ContentFont, layout.FontSize)
+	drawTextLayout(canvas, layout, centerX, textCenterY)
 
-	dc.SetRGB255(10, 10, 10)
-	dc.SetFontFace(truetype.NewFace(latoLight, &truetype.Options{
-		Size: float64(width) * 0.02,
-	}))
-	dc.DrawStringWrapped(fmt.Sprintf("Posted on %s", message.Created.Time()), centerX, containerEndY+10, 0.5, 0.5, innerContainerStartX, 1, gg.AlignCenter)
+	drawGiftIcons(canvas, message, centerX, doubleMargin, giftSize)
 
-	return dc.EncodePNG(wr)
+	canvas.SetColor(theme.Palette.Footer)
+	canvas.SetFont(theme.FooterFont, footerSize)
+	drawRichTextWrapped(canvas, fmt.Sprintf("Posted on %s", message.Created.Time()), centerX, containerEndY+10, innerContainerStartX, 1)
 }
 
 type RendererContext struct {
 	RawMessage *models.Record
 	BackendURL string
+	Type       string
+	Width      int
+	Height     int
+	Theme      *ImageTheme
+
+	// format of the screenshot taken by chrome
+	Encoding ImageEncoding
 }
 
-func generateImagePNGChrome(wr io.Writer, parentChromeCtx context.Context, tmpl *template.Template, rctx RendererContext) error {
-	// compile template first
-	output := &bytes.Buffer{}
-	if err := tmpl.Execute(output, rctx); err != nil {
-		return err
-	}
-
-	ctx, cancel := chromedp.NewContext(parentChromeCtx)
-	defer cancel()
-
-	actx, acancel := context.WithTimeout(ctx, 15*time.Second)
-	defer acancel()
-
-	// render to browser
-	if err := chromedp.Run(actx,
-		chromedp.Navigate("about:blank"),
-	); err != nil {
-		return err
-	}
-
-	var wg sync.WaitGroup
-	wg.Add(1)
-	chromedp.ListenTarget(ctx, func(ev interface{}) {
-		switch ev.(type) {
-		case *page.EventLoadEventFired:
-			go func() {
-				var buf []byte
-				if err := chromedp.Run(actx,
-					chromedp.Screenshot("#image-preview", &buf, chromedp.NodeVisible),
-				); err != nil {
-					fmt.Println(err)
-				} else if _, err := wr.Write(buf); err != nil {
-					fmt.Println(err)
-				}
-				wg.Done()
-			}()
-		}
-	})
-
-	if err := chromedp.Run(actx,
-		chromedp.PollFunction(`
-		async (html) => {
-			document.open();
-			document.write(html);
-			document.close();
-			await document.fonts.ready;
-			return true;
-		}
-		`, nil, chromedp.WithPollingArgs(output.String())),
-	); err != nil {
-		return err
+func newRendererContext(itype ImageType, message *models.Record) RendererContext {
+	width, height := itype.Size()
+	return RendererContext{
+		RawMessage: message,
+		BackendURL: baseUrl,
+		Type:       itype.String(),
+		Width:      width,
+		Height:     height,
+		Theme:      messageImageTheme(message),
 	}
-
-	wg.Wait()
-	return nil
 }
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"html/template"
+	"image/png"
+	"testing"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+	"github.com/pocketbase/pocketbase/models"
+)
+
+func TestParseImageType(t *testing.T) {
+	cases := map[string]ImageType{
+		"":         imageTypeTwitter,
+		"facebook": imageTypeFacebook,
+		"twitter":  imageTypeTwitter,
+		"story":    imageTypeInstagramStory,
+		"square":   imageTypeInstagramSquare,
+	}
+
+	for name, expected := range cases {
+		got, err := parseImageType(name)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", name, err)
+		} else if got != expected {
+			t.Errorf("%q: expected %s, got %s", name, expected, got)
+		}
+	}
+
+	if _, err := parseImageType("tiktok"); err == nil {
+		t.Error("Expected error for unknown image type, got nil")
+	}
+}
+
+func TestGenerateImage_Sizes(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Cleanup()
+
+	collection, _ := app.Dao().FindCollectionByNameOrId("messages")
+	message := models.NewRecord(collection)
+	message.Set("content", "Happy valentines! See you at the library later.")
+
+	for _, itype := range imageTypes {
+		buf := &bytes.Buffer{}
+		if err := generateImage(buf, itype, ImageEncoding{Format: imageFormatPNG}, message); err != nil {
+			t.Fatalf("%s: generateImage failed: %v", itype, err)
+		}
+
+		img, err := png.Decode(buf)
+		if err != nil {
+			t.Fatalf("%s: failed to decode image: %v", itype, err)
+		}
+
+		width, height := itype.Size()
+		if bounds := img.Bounds(); bounds.Dx() != width || bounds.Dy() != height {
+			t.Errorf("%s: expected %dx%d, got %dx%d", itype, width, height, bounds.Dx(), bounds.Dy())
+		}
+	}
+}
+
+func TestImageRenderer_FallbackCachedSeparately(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Cleanup()
+
+	message := saveTestMessage(t, app, "user1", "everyone", "Happy valentines!")
+	theme := messageImageTheme(message)
+
+	chromeErr := errors.New("target crashed")
+	chromeRenders := 0
+	pool := newTestChromeRenderPool(1, 0, func(ctx context.Context) ([]byte, error) {
+		chromeRenders++
+		if chromeErr != nil {
+			return nil, chromeErr
+		}
+		return []byte("chrome"), nil
+	})
+
+	diskCache, err := newDiskImageCache(t.TempDir(), 1<<20)
+	if err != nil {
+		t.Fatalf("newDiskImageCache failed: %v", err)
+	}
+
+	renderer := &ImageRenderer{
+		ChromePool: pool,
+		Templates:  template.Must(template.New(theme.Template).Parse(`{{ .Type }}`)),
+		CacheStore: cache.New(time.Minute, time.Minute),
+		DiskCache:  diskCache,
+	}
+
+	enc := imageEncodingFor(imageFormatPNG)
+	key := imageCacheKey(imageTypeTwitter, theme.ID, enc, message)
+
+	fallback, err := renderer.Render(imageTypeTwitter, enc, message)
+	if err != nil || len(fallback) == 0 {
+		t.Fatalf("Expected the fallback image, got %d bytes (err: %v)", len(fallback), err)
+	}
+
+	if _, cached := renderer.CacheStore.Get(key); cached {
+		t.Error("Expected the fallback image not to be cached as the chrome render")
+	}
+
+	if _, cached := diskCache.Get(key); cached {
+		t.Error("Expected the fallback image not to be kept in the disk cache")
+	}
+
+	// the fallback is reused for a while instead of trying chrome again
+	if buf, _ := renderer.Render(imageTypeTwitter, enc, message); !bytes.Equal(buf, fallback) || chromeRenders != 1 {
+		t.Errorf("Expected the cached fallback image, got %d bytes after %d chrome renders", len(buf), chromeRenders)
+	}
+
+	// chrome renders the image again once the fallback has expired
+	chromeErr = nil
+	renderer.CacheStore.Delete(key + "/fallback")
+	waitForTab(t, pool)
+
+	if buf, err := renderer.Render(imageTypeTwitter, enc, message); err != nil || string(buf) != "chrome" {
+		t.Fatalf("Expected the chrome render, got %q (err: %v)", buf, err)
+	}
+
+	if buf, cached := diskCache.Get(key); !cached || string(buf) != "chrome" {
+		t.Errorf("Expected the chrome render to be kept in the disk cache, got %q", buf)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v5"
+	"github.com/pocketbase/pocketbase/daos"
+	"github.com/pocketbase/pocketbase/models"
+)
+
+// how long browsers and crawlers may keep an image before revalidating.
+// private messages are only kept by the browser of the viewer.
+const (
+	imagePublicMaxAge  = 1 * time.Hour
+	imagePrivateMaxAge = 5 * time.Minute
+)
+
+// isMessagePublic tells whether a guest can view the message, in which
+// case shared caches may keep its image as well.
+func isMessagePublic(dao *daos.Dao, message *models.Record) bool {
+	_, err := findViewableRecord(dao, "messages", message.Id, &models.RequestData{})
+	return err == nil
+}
+
+// imageETag identifies the image by what it is rendered from so that the
+// validators can be checked without rendering it. the etag is weak since
+// the same inputs do not always render the same bytes, e.g. when the
+// gg-based renderer stands in for chrome.
+func imageETag(message *models.Record, itype ImageType, enc ImageEncoding) string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{
+		message.Id,
+		message.Updated.String(),
+		itype.String(),
+		enc.String(),
+		messageImageTheme(message).ID,
+	}, "|")))
+	return `W/"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatches checks the etag against an If-None-Match header which may
+// list several etags. If-None-Match uses the weak comparison, so whether
+// either side is weak does not matter.
+func etagMatches(ifNoneMatch string, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// isImageNotModified tells whether the client already has the image.
+// If-Modified-Since is only used when the client did not send an etag.
+func isImageNotModified(req *http.Request, etag string, lastModified time.Time) bool {
+	if ifNoneMatch := req.Header.Get("If-None-Match"); len(ifNoneMatch) != 0 {
+		return etagMatches(ifNoneMatch, etag)
+	}
+
+	if ifModifiedSince, err := http.ParseTime(req.Header.Get("If-Modified-Since")); err == nil {
+		return !lastModified.Truncate(time.Second).After(ifModifiedSince)
+	}
+
+	return false
+}
+
+// serveImage writes the image of the message along with its caching
+// headers. the image is only rendered when the body is needed, not for
+// HEAD requests or clients that already have it.
+func serveImage(c echo.Context, dao *daos.Dao, message *models.Record, itype ImageType, enc ImageEncoding, render func() ([]byte, error)) error {
+	etag := imageETag(message, itype, enc)
+	lastModified := message.Updated.Time()
+
+	header := c.Response().Header()
+	header.Set("ETag", etag)
+	header.Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	if isMessagePublic(dao, message) {
+		header.Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(imagePublicMaxAge.Seconds())))
+	} else {
+		header.Set("Cache-Control", fmt.Sprintf("private, max-age=%d", int(imagePrivateMaxAge.Seconds())))
+	}
+
+	if isImageNotModified(c.Request(), etag, lastModified) {
+		return c.NoContent(http.StatusNotModified)
+	}
+
+	contentType := enc.Format.ContentType()
+	header.Set("Content-Type", contentType)
+	if c.Request().Method == http.MethodHead {
+		return c.NoContent(http.StatusOK)
+	}
+
+	buf, err := render()
+	if err != nil {
+		return err
+	}
+
+	header.Set("Content-Length", strconv.Itoa(len(buf)))
+	return c.Blob(http.StatusOK, contentType, buf)
+}
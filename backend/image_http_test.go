@@ -0,0 +1,107 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v5"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/tests"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// serveTestImage serves the png image of the message and returns the
+// response along with how many times the image was rendered
+func serveTestImage(app *tests.TestApp, method string, message *models.Record, headers map[string]string) (*httptest.ResponseRecorder, int) {
+	req := httptest.NewRequest(method, "/messages/"+message.Id+"/image", nil)
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	renders := 0
+	rec := httptest.NewRecorder()
+	serveImage(echo.New().NewContext(req, rec), app.Dao(), message, imageTypeTwitter, imageEncodingFor(imageFormatPNG), func() ([]byte, error) {
+		renders++
+		return []byte("png"), nil
+	})
+	return rec, renders
+}
+
+func TestServeImage(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Cleanup()
+
+	collection, _ := app.Dao().FindCollectionByNameOrId("messages")
+	collection.ViewRule = types.Pointer(`hidden != true && recipient = "everyone"`)
+	if err := app.Dao().SaveCollection(collection); err != nil {
+		t.Fatal(err)
+	}
+
+	message := saveTestMessage(t, app, "user1", "everyone", "Hello")
+
+	rec, renders := serveTestImage(app, http.MethodGet, message, nil)
+	if rec.Code != http.StatusOK || rec.Body.String() != "png" || renders != 1 {
+		t.Fatalf("Expected 200 with the image, got %d %q (renders: %d)", rec.Code, rec.Body.String(), renders)
+	}
+
+	etag := rec.Header().Get("ETag")
+	if !strings.HasPrefix(etag, `W/"`) || etag != imageETag(message, imageTypeTwitter, imageEncodingFor(imageFormatPNG)) {
+		t.Errorf("Expected weak record etag, got %q", etag)
+	}
+
+	if etag == imageETag(message, imageTypeFacebook, imageEncodingFor(imageFormatPNG)) || etag == imageETag(message, imageTypeTwitter, imageEncodingFor(imageFormatJPEG)) {
+		t.Error("Expected the etag to differ between image types and encodings")
+	}
+
+	lastModified := message.Updated.Time().UTC().Format(http.TimeFormat)
+	if got := rec.Header().Get("Last-Modified"); got != lastModified {
+		t.Errorf("Expected Last-Modified %q, got %q", lastModified, got)
+	}
+
+	if got := rec.Header().Get("Cache-Control"); !strings.HasPrefix(got, "public") {
+		t.Errorf("Expected public Cache-Control, got %q", got)
+	}
+
+	for _, headers := range []map[string]string{
+		{"If-None-Match": etag},
+		{"If-None-Match": `"other", ` + strings.TrimPrefix(etag, "W/")},
+		{"If-Modified-Since": lastModified},
+	} {
+		if rec, renders := serveTestImage(app, http.MethodGet, message, headers); rec.Code != http.StatusNotModified || rec.Body.Len() != 0 || renders != 0 {
+			t.Errorf("%v: expected 304 without rendering, got %d (renders: %d)", headers, rec.Code, renders)
+		}
+	}
+
+	if rec, _ := serveTestImage(app, http.MethodGet, message, map[string]string{"If-None-Match": `"other"`}); rec.Code != http.StatusOK {
+		t.Errorf("Expected 200 for stale etag, got %d", rec.Code)
+	}
+
+	rec, renders = serveTestImage(app, http.MethodHead, message, nil)
+	if rec.Code != http.StatusOK || rec.Body.Len() != 0 || renders != 0 || rec.Header().Get("Content-Type") != "image/png" {
+		t.Errorf("Expected HEAD to only write headers, got %d %q (renders: %d)", rec.Code, rec.Body.String(), renders)
+	}
+
+	message.Set("theme", "midnight")
+	if imageETag(message, imageTypeTwitter, imageEncodingFor(imageFormatPNG)) == etag {
+		t.Error("Expected the etag to change with the theme")
+	}
+
+	// messages guests can not view are only kept by the browser
+	for _, field := range []string{"recipient", "hidden"} {
+		private := saveTestMessage(t, app, "user1", "everyone", "Hello")
+		if field == "recipient" {
+			private.Set("recipient", "202012345678")
+		} else {
+			private.Set("hidden", true)
+		}
+		if err := app.Dao().SaveRecord(private); err != nil {
+			t.Fatal(err)
+		}
+
+		if rec, _ := serveTestImage(app, http.MethodGet, private, nil); !strings.HasPrefix(rec.Header().Get("Cache-Control"), "private") {
+			t.Errorf("%s: expected private Cache-Control, got %q", field, rec.Header().Get("Cache-Control"))
+		}
+	}
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// isIdeographicRune tells whether a line may break around the rune even
+// without spaces, as in chinese, japanese and korean text.
+func isIdeographicRune(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) ||
+		(r >= 0x3000 && r <= 0x303f) || (r >= 0xff00 && r <= 0xffef)
+}
+
+// punctuation that may not start a line (e.g. 。and ）) or end a line
+// (e.g. 「), following the japanese kinsoku rules
+const (
+	noBreakBeforeRunes = "、。，．・：；？！ー）」』】〕〉》〙〗ゝゞぁぃぅぇぉっゃゅょゎァィゥェォッャュョヮヵヶ,.!?:;)]}%"
+	noBreakAfterRunes  = "（「『【〔〈《〘〖([{"
+)
+
+// lineBreakUnit is the smallest piece of text that is kept on one line
+type lineBreakUnit struct {
+	segments []richTextSegment
+
+	// whether a space separates the unit from the previous one
+	space bool
+}
+
+// splitLineBreakUnits splits a paragraph at the places where a line may
+// break: spaces, around emoji and between ideographic characters.
+func splitLineBreakUnits(paragraph string) []lineBreakUnit {
+	units := []lineBreakUnit{}
+
+	for _, word := range strings.FieldsFunc(paragraph, unicode.IsSpace) {
+		unit := lineBreakUnit{space: true}
+		text := &strings.Builder{}
+
+		// the last rune of the unit, or -1 for an emoji
+		last := rune(0)
+
+		flushText := func() {
+			if text.Len() != 0 {
+				unit.segments = append(unit.segments, richTextSegment{text: text.String()})
+				text.Reset()
+			}
+		}
+
+		breakBefore := func(r rune, isEmoji bool) {
+			if last == 0 || strings.ContainsRune(noBreakAfterRunes, last) || (!isEmoji && strings.ContainsRune(noBreakBeforeRunes, r)) {
+				return
+			} else if !isEmoji && last != -1 && !isIdeographicRune(r) && !isIdeographicRune(last) {
+				return
+			}
+
+			flushText()
+			units = append(units, unit)
+			unit = lineBreakUnit{}
+		}
+
+		for _, segment := range splitRichText(word) {
+			if len(segment.emoji) != 0 {
+				breakBefore(0, true)
+				flushText()
+				unit.segments = append(unit.segments, segment)
+				last = -1
+				continue
+			}
+
+			for _, r := range segment.text {
+				breakBefore(r, false)
+				text.WriteRune(r)
+				last = r
+			}
+		}
+
+		flushText()
+		units = append(units, unit)
+	}
+
+	return units
+}
+
+// richTextWidth measures a line where each emoji is as wide as the font
+// size, whether it is drawn from an icon or from the emoji font.
+func richTextWidth(canvas imageCanvas, segments []richTextSegment, emojiSize float64) float64 {
+	width := 0.0
+	for _, segment := range segments {
+		if len(segment.emoji) != 0 {
+			width += emojiSize
+		} else {
+			width += canvas.MeasureString(segment.text)
+		}
+	}
+	return width
+}
+
+// mergeTextSegments joins the text segments next to each other so that
+// they are drawn (and kerned) as one string
+func mergeTextSegments(segments []richTextSegment) []richTextSegment {
+	merged := []richTextSegment{}
+	for _, segment := range segments {
+		if last := len(merged) - 1; last >= 0 && len(segment.emoji) == 0 && len(merged[last].emoji) == 0 {
+			merged[last].text += segment.text
+		} else {
+			merged = append(merged, segment)
+		}
+	}
+	return merged
+}
+
+// breakOverflow breaks a line that is wider than maxWidth at the last
+// character that fits. used for words that are longer than a whole line.
+func breakOverflow(canvas imageCanvas, line []richTextSegment, maxWidth float64, emojiSize float64) (head []richTextSegment, tail []richTextSegment) {
+	chars := []richTextSegment{}
+	for _, segment := range line {
+		if len(segment.emoji) != 0 {
+			chars = append(chars, segment)
+			continue
+		}
+
+		for _, r := range segment.text {
+			chars = append(chars, richTextSegment{text: string(r)})
+		}
+	}
+
+	// at least one character is kept so that the loop always ends
+	split := 1
+	for split < len(chars) && richTextWidth(canvas, mergeTextSegments(chars[:split+1]), emojiSize) <= maxWidth {
+		split++
+	}
+
+	return mergeTextSegments(chars[:split]), mergeTextSegments(chars[split:])
+}
+
+// wrapRichText wraps the text to lines no wider than maxWidth while
+// keeping emoji in place.
+func wrapRichText(canvas imageCanvas, content string, maxWidth float64, emojiSize float64) [][]richTextSegment {
+	lines := [][]richTextSegment{}
+	for _, paragraph := range strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n") {
+		line := []richTextSegment{}
+		for _, unit := range splitLineBreakUnits(paragraph) {
+			candidate := append([]richTextSegment{}, line...)
+			if len(line) != 0 && unit.space {
+				candidate = append(candidate, richTextSegment{text: " "})
+			}
+			candidate = append(candidate, unit.segments...)
+
+			if len(line) != 0 && richTextWidth(canvas, candidate, emojiSize) > maxWidth {
+				lines = append(lines, mergeTextSegments(line))
+				line = append([]richTextSegment{}, unit.segments...)
+			} else {
+				line = candidate
+			}
+
+			for richTextWidth(canvas, line, emojiSize) > maxWidth {
+				head, tail := breakOverflow(canvas, line, maxWidth, emojiSize)
+				if len(tail) == 0 {
+					break
+				}
+
+				lines = append(lines, head)
+				line = tail
+			}
+		}
+		lines = append(lines, mergeTextSegments(line))
+	}
+	return lines
+}
+
+// textLayout is the wrapped text at the font size picked by
+// layoutRichText
+type textLayout struct {
+	FontSize    float64
+	FontHeight  float64
+	LineSpacing float64
+	Lines       [][]richTextSegment
+}
+
+func (layout textLayout) Height() float64 {
+	return float64(len(layout.Lines))*layout.FontHeight*layout.LineSpacing - (layout.LineSpacing-1)*layout.FontHeight
+}
+
+// layoutRichText wraps the text with the largest font size between minSize
+// and maxSize at which it fits in the box. text that does not fit even at
+// minSize is cut off with an ellipsis. the font of the canvas is left at
+// the picked size.
+func layoutRichText(canvas imageCanvas, font ImageFont, content string, maxWidth, maxHeight, minSize, maxSize, lineSpacing float64) textLayout {
+	layoutAt := func(size float64) textLayout {
+		canvas.SetFont(font, size)
+		fontHeight := canvas.FontHeight()
+		return textLayout{
+			FontSize:    size,
+			FontHeight:  fontHeight,
+			LineSpacing: lineSpacing,
+			Lines:       wrapRichText(canvas, content, maxWidth, fontHeight),
+		}
+	}
+
+	best := layoutAt(maxSize)
+	if best.Height() > maxHeight {
+		if best = layoutAt(minSize); best.Height() > maxHeight {
+			best = truncateLayout(canvas, best, maxWidth, maxHeight)
+		} else {
+			// sizes are searched to the half pixel
+			low, high := minSize, maxSize
+			for high-low > 0.5 {
+				mid := (low + high) / 2
+				if layout := layoutAt(mid); layout.Height() <= maxHeight {
+					best, low = layout, mid
+				} else {
+					high = mid
+				}
+			}
+		}
+	}
+
+	canvas.SetFont(font, best.FontSize)
+	return best
+}
+
+// truncateLayout drops the lines that do not fit in maxHeight and ends the
+// last line with an ellipsis
+func truncateLayout(canvas imageCanvas, layout textLayout, maxWidth, maxHeight float64) textLayout {
+	maxLines := int(math.Floor((maxHeight + (layout.LineSpacing-1)*layout.FontHeight) / (layout.FontHeight * layout.LineSpacing)))
+	if maxLines < 1 {
+		maxLines = 1
+	}
+
+	if len(layout.Lines) <= maxLines {
+		return layout
+	}
+
+	layout.Lines = append([][]richTextSegment{}, layout.Lines[:maxLines]...)
+	last := layout.Lines[maxLines-1]
+	for {
+		candidate := mergeTextSegments(append(append([]richTextSegment{}, last...), richTextSegment{text: "…"}))
+		if len(last) == 0 || richTextWidth(canvas, candidate, layout.FontHeight) <= maxWidth {
+			layout.Lines[maxLines-1] = candidate
+			return layout
+		}
+
+		// drop the last character
+		if lastSegment := last[len(last)-1]; len(lastSegment.emoji) != 0 || len([]rune(lastSegment.text)) <= 1 {
+			last = last[:len(last)-1]
+		} else {
+			runes := []rune(lastSegment.text)
+			last = append(append([]richTextSegment{}, last[:len(last)-1]...), richTextSegment{text: string(runes[:len(runes)-1])})
+		}
+	}
+}
+
+// drawTextLayout draws the lines centered at (x, y) the same way as gg's
+// DrawStringWrapped does, with emoji drawn from the emojis folder or the
+// emoji font instead of the text font.
+func drawTextLayout(canvas imageCanvas, layout textLayout, x, y float64) {
+	emojiSize := layout.FontHeight
+	y -= 0.5 * layout.Height()
+
+	for _, line := range layout.Lines {
+		lineX := x - richTextWidth(canvas, line, emojiSize)/2
+		baseline := y + layout.FontHeight
+
+		for _, segment := range line {
+			if len(segment.emoji) == 0 {
+				canvas.DrawString(segment.text, lineX, baseline)
+				lineX += canvas.MeasureString(segment.text)
+			} else if name := emojiIconName(segment.emoji); hasEmojiIcon(name) {
+				canvas.DrawIcon(name, lineX, baseline-emojiSize*0.85, emojiSize)
+				lineX += emojiSize
+			} else {
+				canvas.DrawEmoji(segment.emoji, lineX, baseline-emojiSize*0.85, emojiSize)
+				lineX += emojiSize
+			}
+		}
+
+		y += layout.FontHeight * layout.LineSpacing
+	}
+}
+
+// drawRichTextWrapped wraps and draws the text centered at (x, y) with the
+// current font of the canvas
+func drawRichTextWrapped(canvas imageCanvas, content string, x, y, maxWidth, lineSpacing float64) {
+	fontHeight := canvas.FontHeight()
+	drawTextLayout(canvas, textLayout{
+		FontHeight:  fontHeight,
+		LineSpacing: lineSpacing,
+		Lines:       wrapRichText(canvas, content, maxWidth, fontHeight),
+	}, x, y)
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/models"
+)
+
+var updateGolden = flag.Bool("update", false, "update the golden images in testdata/golden")
+
+func richTextLineString(line []richTextSegment) string {
+	str := &strings.Builder{}
+	for _, segment := range line {
+		str.WriteString(segment.text + segment.emoji)
+	}
+	return str.String()
+}
+
+func TestSplitLineBreakUnits(t *testing.T) {
+	cases := map[string][]string{
+		"hello world": {"hello", "world"},
+		"love💖you":    {"love", "💖", "you"},
+		"今日は。":        {"今", "日", "は。"},
+		"「約束」です":      {"「約", "束」", "で", "す"},
+		"abc日本":       {"abc", "日", "本"},
+		"  spaced   ": {"spaced"},
+	}
+
+	for paragraph, expected := range cases {
+		got := []string{}
+		for _, unit := range splitLineBreakUnits(paragraph) {
+			got = append(got, richTextLineString(unit.segments))
+		}
+
+		if fmt.Sprint(got) != fmt.Sprint(expected) {
+			t.Errorf("%q: expected %q, got %q", paragraph, expected, got)
+		}
+	}
+}
+
+func TestWrapRichText(t *testing.T) {
+	canvas := newGGCanvas(1200, 675)
+	canvas.SetFont(latoFont, 40)
+	maxWidth := canvas.MeasureString("medium word")
+
+	t.Run("LongWord", func(t *testing.T) {
+		lines := wrapRichText(canvas, strings.Repeat("a", 100), maxWidth, 40)
+		if len(lines) < 2 {
+			t.Fatalf("Expected the word to be broken into lines, got %d line(s)", len(lines))
+		}
+
+		joined := ""
+		for _, line := range lines {
+			if width := richTextWidth(canvas, line, 40); width > maxWidth {
+				t.Errorf("Line %q is wider than %f: %f", richTextLineString(line), maxWidth, width)
+			}
+			joined += richTextLineString(line)
+		}
+
+		if joined != strings.Repeat("a", 100) {
+			t.Errorf("Expected no characters to be lost, got %q", joined)
+		}
+	})
+
+	t.Run("CJK", func(t *testing.T) {
+		lines := wrapRichText(canvas, "今日は本当にありがとうございました。またいつか一緒に勉強しましょう！", maxWidth, 40)
+		if len(lines) < 2 {
+			t.Fatalf("Expected the text to be wrapped, got %d line(s)", len(lines))
+		}
+
+		for _, line := range lines {
+			if str := richTextLineString(line); strings.HasPrefix(str, "。") || strings.HasPrefix(str, "！") {
+				t.Errorf("Expected no line to start with closing punctuation, got %q", str)
+			}
+		}
+	})
+
+	t.Run("Paragraphs", func(t *testing.T) {
+		lines := wrapRichText(canvas, "one\r\ntwo\n\nthree", 1000, 40)
+		got := []string{}
+		for _, line := range lines {
+			got = append(got, richTextLineString(line))
+		}
+
+		if expected := []string{"one", "two", "", "three"}; fmt.Sprint(got) != fmt.Sprint(expected) {
+			t.Errorf("Expected %q, got %q", expected, got)
+		}
+	})
+}
+
+func TestLayoutRichText(t *testing.T) {
+	canvas := newGGCanvas(1200, 675)
+
+	t.Run("ShortTextUsesMaxSize", func(t *testing.T) {
+		layout := layoutRichText(canvas, latoFont, "Hi!", 800, 400, 20, 60, 1.35)
+		if layout.FontSize != 60 {
+			t.Errorf("Expected font size 60, got %f", layout.FontSize)
+		}
+	})
+
+	t.Run("LongTextFits", func(t *testing.T) {
+		content := strings.Repeat("Happy valentines to you and your cat! ", 12)
+		layout := layoutRichText(canvas, latoFont, content, 800, 400, 10, 60, 1.35)
+		if layout.FontSize <= 10 || layout.FontSize >= 60 {
+			t.Errorf("Expected a font size between the bounds, got %f", layout.FontSize)
+		}
+
+		if layout.Height() > 400 {
+			t.Errorf("Expected the text to fit 400px, got %f", layout.Height())
+		}
+
+		// the text should fill most of the box instead of being shrunk
+		// more than needed
+		if layout.Height() < 300 {
+			t.Errorf("Expected the text to fill the box, got %f", layout.Height())
+		}
+	})
+
+	t.Run("OverflowIsTruncated", func(t *testing.T) {
+		content := strings.Repeat("Happy valentines to you and your cat! ", 100)
+		layout := layoutRichText(canvas, latoFont, content, 800, 200, 20, 60, 1.35)
+		if layout.FontSize != 20 {
+			t.Errorf("Expected the min font size, got %f", layout.FontSize)
+		}
+
+		if layout.Height() > 200 {
+			t.Errorf("Expected the text to be cut to 200px, got %f", layout.Height())
+		}
+
+		last := richTextLineString(layout.Lines[len(layout.Lines)-1])
+		if !strings.HasSuffix(last, "…") {
+			t.Errorf("Expected the last line to end with an ellipsis, got %q", last)
+		}
+	})
+}
+
+// imageDiffRatio returns the fraction of pixels that differ between the
+// images by more than a few levels of a color channel
+func imageDiffRatio(a, b image.Image) float64 {
+	bounds := a.Bounds()
+	if bounds != b.Bounds() {
+		return 1
+	}
+
+	differ := 0
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r1, g1, b1, a1 := a.At(x, y).RGBA()
+			r2, g2, b2, a2 := b.At(x, y).RGBA()
+			for _, d := range []int64{int64(r1) - int64(r2), int64(g1) - int64(g2), int64(b1) - int64(b2), int64(a1) - int64(a2)} {
+				if d < -0x400 || d > 0x400 {
+					differ++
+					break
+				}
+			}
+		}
+	}
+	return float64(differ) / float64(bounds.Dx()*bounds.Dy())
+}
+
+func TestGenerateImage_Golden(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Cleanup()
+
+	collection, _ := app.Dao().FindCollectionByNameOrId("messages")
+	text := "Happy valentines to the one who always saves me a seat in the library 💖 see you after class, I owe you a milk tea 🧋 and more! "
+
+	for _, length := range []int{1, 120, 240} {
+		content := []rune(strings.Repeat(text, 3))[:length]
+		message := models.NewRecord(collection)
+		message.Set("content", string(content))
+		message.Set("theme", "classic")
+
+		buf := &bytes.Buffer{}
+		if err := generateImage(buf, imageTypeTwitter, imageEncodingFor(imageFormatPNG), message); err != nil {
+			t.Fatalf("%d: generateImage failed: %v", length, err)
+		}
+
+		goldenPath := filepath.Join("testdata", "golden", fmt.Sprintf("message_%d.png", length))
+		if *updateGolden {
+			if err := os.MkdirAll(filepath.Dir(goldenPath), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(goldenPath, buf.Bytes(), 0644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+
+		goldenFile, err := os.Open(goldenPath)
+		if err != nil {
+			t.Fatalf("%d: %v (run the tests with -update to create it)", length, err)
+		}
+		golden, err := png.Decode(goldenFile)
+		goldenFile.Close()
+		if err != nil {
+			t.Fatalf("%d: failed to decode golden image: %v", length, err)
+		}
+
+		got, err := png.Decode(buf)
+		if err != nil {
+			t.Fatalf("%d: failed to decode image: %v", length, err)
+		}
+
+		// small differences in anti-aliasing are allowed
+		if ratio := imageDiffRatio(golden, got); ratio > 0.001 {
+			t.Errorf("%d: %.2f%% of the pixels differ from %s", length, ratio*100, goldenPath)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/daos"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/spf13/cobra"
+)
+
+// the image types fetched by the facebook and twitter crawlers when a
+// message is shared. crawlers do not ask for webp so only png is rendered.
+var prerenderImageTypes = []ImageType{imageTypeFacebook, imageTypeTwitter}
+
+// findImageMessage finds the message along with the gifts drawn on its
+// image
+func findImageMessage(dao *daos.Dao, id string) (*models.Record, error) {
+	message, err := dao.FindRecordById("messages", id)
+	if err != nil {
+		return nil, err
+	}
+
+	errs := dao.ExpandRecord(message, []string{"gifts"}, func(relCollection *models.Collection, relIds []string) ([]*models.Record, error) {
+		return dao.FindRecordsByIds(relCollection.Name, relIds)
+	})
+	if err, failed := errs["gifts"]; failed {
+		return nil, fmt.Errorf("failed to expand the gifts of message %s: %w", id, err)
+	}
+	return message, nil
+}
+
+// prerenderMessageImages renders the default image types of the message
+// so that they are already cached once the crawlers ask for them.
+func prerenderMessageImages(renderer *ImageRenderer, message *models.Record) error {
+	for _, itype := range prerenderImageTypes {
+		if _, err := renderer.Render(itype, imageEncodingFor(imageFormatPNG), message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var errPrerenderQueueFull = errors.New("image prerender queue is full")
+
+// ImagePrerenderMetrics is a point-in-time view of the prerender queue.
+type ImagePrerenderMetrics struct {
+	Queued   int   `json:"queued"`
+	Rendered int64 `json:"rendered"`
+	Failed   int64 `json:"failed"`
+	Dropped  int64 `json:"dropped"`
+}
+
+// ImagePrerenderer renders the images of new messages in the background.
+// messages are dropped once the queue is full so that sending a message
+// never waits for the renderer. dropped messages are rendered on their
+// first request as before.
+type ImagePrerenderer struct {
+	queue chan string
+
+	rendered int64
+	failed   int64
+	dropped  int64
+
+	// replaced in tests
+	render func(messageId string) error
+}
+
+func newImagePrerenderer(app core.App, renderer *ImageRenderer, queueSize int) *ImagePrerenderer {
+	return &ImagePrerenderer{
+		queue: make(chan string, queueSize),
+		render: func(messageId string) error {
+			message, err := findImageMessage(app.Dao(), messageId)
+			if err != nil {
+				return err
+			}
+			return prerenderMessageImages(renderer, message)
+		},
+	}
+}
+
+// Enqueue adds the message to the queue without waiting
+func (p *ImagePrerenderer) Enqueue(messageId string) error {
+	select {
+	case p.queue <- messageId:
+		return nil
+	default:
+		atomic.AddInt64(&p.dropped, 1)
+		return errPrerenderQueueFull
+	}
+}
+
+// Run renders the queued messages one at a time so that the background
+// renders leave the chrome tabs to the requests.
+func (p *ImagePrerenderer) Run() {
+	for messageId := range p.queue {
+		if err := p.render(messageId); err != nil {
+			atomic.AddInt64(&p.failed, 1)
+			log.Printf("[prerender] failed to render images of %s: %v\n", messageId, err)
+			continue
+		}
+
+		atomic.AddInt64(&p.rendered, 1)
+	}
+}
+
+func (p *ImagePrerenderer) Metrics() ImagePrerenderMetrics {
+	return ImagePrerenderMetrics{
+		Queued:   len(p.queue),
+		Rendered: atomic.LoadInt64(&p.rendered),
+		Failed:   atomic.LoadInt64(&p.failed),
+		Dropped:  atomic.LoadInt64(&p.dropped),
+	}
+}
+
+// warmupMessageIds returns the ids of the messages to render after a
+// deploy, either the newest ones or the ones with the most replies. views
+// are not tracked so replies are the closest measure of popular messages.
+func warmupMessageIds(dao *daos.Dao, by string, limit int) ([]string, error) {
+	query := dao.DB().Select("id").From("messages").Limit(int64(limit))
+
+	switch by {
+	case "newest":
+		query = query.OrderBy("created DESC")
+	case "replies":
+		query = query.OrderBy("replies_count DESC", "created DESC")
+	default:
+		return nil, fmt.Errorf("unknown order '%s'", by)
+	}
+
+	ids := []string{}
+	if err := query.Column(&ids); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+func newImagesCommand(app core.App) *cobra.Command {
+	command := &cobra.Command{
+		Use:   "images",
+		Short: "Manage the rendered message images",
+	}
+
+	var by string
+	var limit int
+	warmupCommand := &cobra.Command{
+		Use:   "warmup",
+		Short: "Render the images of the newest or most replied messages into the disk cache",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// images rendered in memory are gone once the command exits
+			if imageDiskCacheSize <= 0 {
+				return errors.New("IMAGE_DISK_CACHE_SIZE has to be set for the warm-up to be kept")
+			}
+
+			if err := setupImageRenderer(app); err != nil {
+				return err
+			}
+
+			ids, err := warmupMessageIds(app.Dao(), by, limit)
+			if err != nil {
+				return err
+			}
+
+			startedAt := time.Now()
+			failed := 0
+			for i, id := range ids {
+				message, err := findImageMessage(app.Dao(), id)
+				if err == nil {
+					err = prerenderMessageImages(imageRenderer, message)
+				}
+
+				if err != nil {
+					failed++
+					log.Printf("[warmup] failed to render images of %s: %v\n", id, err)
+				}
+
+				if (i+1)%10 == 0 || i+1 == len(ids) {
+					log.Printf("[warmup] %d/%d messages rendered (%d failed, %s elapsed)\n", i+1, len(ids), failed, time.Since(startedAt).Round(time.Second))
+				}
+			}
+
+			fmt.Printf("Rendered the images of %d message(s), %d failed.\n", len(ids)-failed, failed)
+			return nil
+		},
+	}
+
+	warmupCommand.Flags().StringVar(&by, "by", "newest", "pick the messages by \"newest\" or \"replies\"")
+	warmupCommand.Flags().IntVar(&limit, "limit", 200, "number of messages to render")
+
+	command.AddCommand(warmupCommand)
+	return command
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/models/schema"
+)
+
+func TestImagePrerenderer(t *testing.T) {
+	prerenderer := &ImagePrerenderer{queue: make(chan string, 3)}
+
+	rendered := []string{}
+	prerenderer.render = func(messageId string) error {
+		if messageId == "broken" {
+			return errors.New("render failed")
+		}
+		rendered = append(rendered, messageId)
+		return nil
+	}
+
+	for _, id := range []string{"msg1", "broken", "msg2"} {
+		if err := prerenderer.Enqueue(id); err != nil {
+			t.Fatalf("Expected %s to be queued, got %v", id, err)
+		}
+	}
+
+	// the queue is full so the message is left for its first request
+	if err := prerenderer.Enqueue("msg3"); err != errPrerenderQueueFull {
+		t.Errorf("Expected full queue error, got %v", err)
+	}
+
+	if metrics := prerenderer.Metrics(); metrics.Queued != 3 || metrics.Dropped != 1 {
+		t.Errorf("Unexpected metrics: %+v", metrics)
+	}
+
+	close(prerenderer.queue)
+	prerenderer.Run()
+
+	if !reflect.DeepEqual(rendered, []string{"msg1", "msg2"}) {
+		t.Errorf("Unexpected rendered messages %v", rendered)
+	}
+
+	if metrics := prerenderer.Metrics(); metrics.Queued != 0 || metrics.Rendered != 2 || metrics.Failed != 1 {
+		t.Errorf("Unexpected metrics: %+v", metrics)
+	}
+}
+
+func TestFindImageMessage(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Cleanup()
+
+	if _, err := findImageMessage(app.Dao(), "missing"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected no rows error for a missing message, got %v", err)
+	}
+
+	// gifts is a plain json field in the test schema, so it is turned into
+	// the relation it is in the app
+	dao := app.Dao()
+	gifts, _ := dao.FindCollectionByNameOrId("gifts")
+	messages, _ := dao.FindCollectionByNameOrId("messages")
+	messages.Schema.GetFieldByName("gifts").Type = schema.FieldTypeRelation
+	messages.Schema.GetFieldByName("gifts").Options = &schema.RelationOptions{CollectionId: gifts.Id}
+	if err := dao.SaveCollection(messages); err != nil {
+		t.Fatalf("Failed to update messages collection: %v", err)
+	}
+
+	rose := saveTestGift(t, app, "rose", 10, false)
+	message := saveTestMessage(t, app, "user1", "everyone", "Happy valentines!")
+	message.Set("gifts", []string{rose.Id})
+	if err := dao.SaveRecord(message); err != nil {
+		t.Fatalf("Failed to save message: %v", err)
+	}
+
+	found, err := findImageMessage(dao, message.Id)
+	if err != nil {
+		t.Fatalf("findImageMessage failed: %v", err)
+	}
+
+	if expanded, _ := found.Expand()["gifts"].([]*models.Record); len(expanded) != 1 || expanded[0].Id != rose.Id {
+		t.Errorf("Expected the gifts to be expanded, got %v", found.Expand()["gifts"])
+	}
+
+	// the gifts can not be fetched anymore
+	if _, err := dao.DB().NewQuery("DROP TABLE gifts").Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := findImageMessage(dao, message.Id); err == nil || errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected the expand error to be returned, got %v", err)
+	}
+}
+
+func TestPrerenderMessageImages(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Cleanup()
+
+	message := saveTestMessage(t, app, "user1", "everyone", "Happy valentines!")
+	renderer := &ImageRenderer{CacheStore: cache.New(time.Minute, time.Minute)}
+
+	if err := prerenderMessageImages(renderer, message); err != nil {
+		t.Fatalf("prerenderMessageImages failed: %v", err)
+	}
+
+	theme := messageImageTheme(message)
+	for _, itype := range prerenderImageTypes {
+		if _, cached := renderer.CacheStore.Get(imageCacheKey(itype, theme.ID, imageEncodingFor(imageFormatPNG), message)); !cached {
+			t.Errorf("Expected %s image to be cached", itype)
+		}
+	}
+}
+
+func TestWarmupMessageIds(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Cleanup()
+
+	old := saveTestMessage(t, app, "user1", "everyone", "Old")
+	old.Set("replies_count", 5)
+	old.Created.Scan(time.Now().Add(-time.Hour))
+	if err := app.Dao().SaveRecord(old); err != nil {
+		t.Fatalf("Failed to save message: %v", err)
+	}
+
+	middle := saveTestMessage(t, app, "user1", "everyone", "Middle")
+	newest := saveTestMessage(t, app, "user1", "everyone", "Newest")
+	newest.Created.Scan(time.Now().Add(time.Hour))
+	if err := app.Dao().SaveRecord(newest); err != nil {
+		t.Fatalf("Failed to save message: %v", err)
+	}
+
+	if ids, err := warmupMessageIds(app.Dao(), "newest", 2); err != nil || !reflect.DeepEqual(ids, []string{newest.Id, middle.Id}) {
+		t.Errorf("Unexpected newest messages %v (err: %v)", ids, err)
+	}
+
+	if ids, err := warmupMessageIds(app.Dao(), "replies", 1); err != nil || !reflect.DeepEqual(ids, []string{old.Id}) {
+		t.Errorf("Unexpected most replied messages %v (err: %v)", ids, err)
+	}
+
+	if _, err := warmupMessageIds(app.Dao(), "views", 1); err == nil {
+		t.Error("Expected error for unknown order, got nil")
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/golang/freetype/truetype"
+	"github.com/pocketbase/pocketbase/models"
+	"golang.org/x/image/font"
+)
+
+const defaultImageTheme = "classic"
+
+type ImageFont struct {
+	Family string `json:"family"`
+
+	// path of the font files in renderer_assets/fonts without the
+	// extension. the .ttf file is used by the gg renderer and the .woff2
+	// file by chrome.
+	Path string `json:"-"`
+}
+
+var (
+	latoFont           = ImageFont{Family: "Lato", Path: "lato/lato-v22-latin-regular"}
+	nanumPenScriptFont = ImageFont{Family: "Nanum Pen Script", Path: "nanum-pen-script/nanum-pen-script-v15-latin-regular"}
+)
+
+var imageFonts = struct {
+	sync.Mutex
+	loaded map[string]*truetype.Font
+}{loaded: map[string]*truetype.Font{}}
+
+// Face loads the font once and returns a face of the given size
+func (f ImageFont) Face(size float64) font.Face {
+	imageFonts.Lock()
+	defer imageFonts.Unlock()
+
+	fontT, loaded := imageFonts.loaded[f.Path]
+	if !loaded {
+		fontT = loadFont(filepath.Join(".", "renderer_assets", "fonts", f.Path+".ttf"))
+		imageFonts.loaded[f.Path] = fontT
+	}
+
+	return truetype.NewFace(fontT, &truetype.Options{Size: size})
+}
+
+// ImagePalette holds the hex colors of a theme. the paper is left blank if
+// Lines is empty.
+type ImagePalette struct {
+	Background string `json:"background"`
+	Paper      string `json:"paper"`
+	Lines      string `json:"lines"`
+	Text       string `json:"text"`
+	Footer     string `json:"footer"`
+}
+
+// ImageTheme defines how the share images of a message look in both the
+// chrome and the gg renderers. premium themes cost Price coins on top of
+// the message.
+type ImageTheme struct {
+	ID              string       `json:"id"`
+	Label           string       `json:"label"`
+	Price           float64      `json:"price"`
+	Palette         ImagePalette `json:"palette"`
+	ContentFont     ImageFont    `json:"content_font"`
+	FooterFont      ImageFont    `json:"footer_font"`
+	BackgroundImage string       `json:"-"`
+	Template        string       `json:"-"`
+}
+
+// Fonts returns the fonts to be loaded by the html template
+func (theme *ImageTheme) Fonts() []ImageFont {
+	if theme.ContentFont == theme.FooterFont {
+		return []ImageFont{theme.ContentFont}
+	}
+	return []ImageFont{theme.ContentFont, theme.FooterFont}
+}
+
+func (theme *ImageTheme) IsPremium() bool {
+	return theme.Price > 0
+}
+
+var imageThemes = []*ImageTheme{
+	{
+		ID:    "classic",
+		Label: "Classic",
+		Palette: ImagePalette{
+			Background: "#fbcfe8",
+			Paper:      "#fef3c7",
+			Text:       "#000000",
+			Footer:     "#0a0a0a",
+		},
+		ContentFont:     latoFont,
+		FooterFont:      latoFont,
+		BackgroundImage: "background.png",
+		Template:        "message_image.html.tpl",
+	},
+	{
+		ID:    "notebook",
+		Label: "Notebook",
+		Palette: ImagePalette{
+			Background: "#fbcfe8",
+			Paper:      "#faf2ba",
+			Lines:      "#184a99",
+			Text:       "#000000",
+			Footer:     "#0a0a0a",
+		},
+		ContentFont: nanumPenScriptFont,
+		FooterFont:  latoFont,
+		Template:    "message_image.html.tpl",
+	},
+	{
+		ID:    "midnight",
+		Label: "Midnight",
+		Price: 300,
+		Palette: ImagePalette{
+			Background: "#1e1b4b",
+			Paper:      "#312e81",
+			Text:       "#f9fafb",
+			Footer:     "#c7d2fe",
+		},
+		ContentFont: latoFont,
+		FooterFont:  latoFont,
+		Template:    "message_image.html.tpl",
+	},
+	{
+		ID:    "roses",
+		Label: "Roses",
+		Price: 500,
+		Palette: ImagePalette{
+			Background: "#9f1239",
+			Paper:      "#fff1f2",
+			Lines:      "#fda4af",
+			Text:       "#881337",
+			Footer:     "#9f1239",
+		},
+		ContentFont: nanumPenScriptFont,
+		FooterFont:  latoFont,
+		Template:    "message_image.html.tpl",
+	},
+}
+
+// findImageTheme finds a theme by its id. the default theme is returned
+// if no id is given.
+func findImageTheme(id string) (*ImageTheme, error) {
+	if len(id) == 0 {
+		id = defaultImageTheme
+	}
+
+	for _, theme := range imageThemes {
+		if theme.ID == id {
+			return theme, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unknown theme '%s'", id)
+}
+
+// messageImageTheme returns the theme picked by the sender, falling back
+// to the default theme for themes that have been removed.
+func messageImageTheme(message *models.Record) *ImageTheme {
+	theme, err := findImageTheme(message.GetString("theme"))
+	if err != nil {
+		theme, _ = findImageTheme(defaultImageTheme)
+	}
+	return theme
+}
+
+// parseHexColor parses colors in the #rrggbb format used by the palettes
+func parseHexColor(hex string) color.Color {
+	value, err := strconv.ParseUint(strings.TrimPrefix(hex, "#"), 16, 32)
+	if err != nil {
+		return color.Black
+	}
+
+	return color.RGBA{R: uint8(value >> 16), G: uint8(value >> 8), B: uint8(value), A: 255}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"html/template"
+	"image/color"
+	"strings"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/models"
+)
+
+func TestFindImageTheme(t *testing.T) {
+	if theme, err := findImageTheme(""); err != nil || theme.ID != defaultImageTheme {
+		t.Errorf("Expected default theme, got %v (err: %v)", theme, err)
+	}
+
+	if theme, err := findImageTheme("midnight"); err != nil || !theme.IsPremium() {
+		t.Errorf("Expected premium midnight theme, got %v (err: %v)", theme, err)
+	}
+
+	if _, err := findImageTheme("unknown"); err == nil {
+		t.Error("Expected error for unknown theme, got nil")
+	}
+}
+
+func TestParseHexColor(t *testing.T) {
+	if got := parseHexColor("#184a99"); got != (color.RGBA{R: 24, G: 74, B: 153, A: 255}) {
+		t.Errorf("Unexpected color %v", got)
+	}
+}
+
+func TestImageThemeTemplates(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Cleanup()
+
+	renderer := &ImageRenderer{
+		Templates: template.Must(template.New("").Funcs(imageRenderer.Funcs).ParseGlob("./templates/html/*.html.tpl")),
+	}
+
+	collection, _ := app.Dao().FindCollectionByNameOrId("messages")
+	message := models.NewRecord(collection)
+	message.Set("content", "Happy valentines!")
+
+	for _, theme := range imageThemes {
+		message.Set("theme", theme.ID)
+
+		tmpl, err := renderer.TemplateFor(theme)
+		if err != nil {
+			t.Fatalf("%s: %v", theme.ID, err)
+		}
+
+		output := &bytes.Buffer{}
+		if err := tmpl.Execute(output, newRendererContext(imageTypeTwitter, message)); err != nil {
+			t.Fatalf("%s: failed to execute template: %v", theme.ID, err)
+		}
+
+		html := output.String()
+		if strings.Contains(html, "ZgotmplZ") {
+			t.Errorf("%s: template has unsafe values", theme.ID)
+		}
+
+		for _, expected := range []string{theme.Palette.Background, theme.Palette.Paper, theme.ContentFont.Family} {
+			if !strings.Contains(html, expected) {
+				t.Errorf("%s: expected %q in the template", theme.ID, expected)
+			}
+		}
+	}
+}
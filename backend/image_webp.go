@@ -0,0 +1,572 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/draw"
+	"io"
+	"sort"
+)
+
+// encodeWebP encodes the image as a lossless (VP8L) webp. it only uses the
+// parts of the format that pay off for the rendered images: the subtract
+// green and predictor transforms, literal pixels and runs of the previous
+// pixel, with one set of prefix codes for the whole image and no color
+// cache.
+func encodeWebP(wr io.Writer, img image.Image) error {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width < 1 || height < 1 || width > 1<<14 || height > 1<<14 {
+		return errors.New("webp: invalid image size")
+	}
+
+	nrgba, ok := img.(*image.NRGBA)
+	if !ok || nrgba.Rect.Min != (image.Point{}) || nrgba.Stride != width*4 {
+		nrgba = image.NewNRGBA(image.Rect(0, 0, width, height))
+		draw.Draw(nrgba, nrgba.Rect, img, bounds.Min, draw.Src)
+	}
+
+	pixels := make([]uint32, width*height)
+	hasAlpha := false
+	for i := range pixels {
+		p := nrgba.Pix[i*4 : i*4+4]
+		pixels[i] = uint32(p[3])<<24 | uint32(p[0])<<16 | uint32(p[1])<<8 | uint32(p[2])
+		hasAlpha = hasAlpha || p[3] != 0xff
+	}
+
+	bw := &webpBitWriter{}
+	bw.write(0x2f, 8)
+	bw.write(uint32(width-1), 14)
+	bw.write(uint32(height-1), 14)
+	if hasAlpha {
+		bw.write(1, 1)
+	} else {
+		bw.write(0, 1)
+	}
+	bw.write(0, 3) // version
+
+	// the decoder undoes the transforms in reverse order so the predictor
+	// works on the pixels with green already subtracted
+	webpSubtractGreen(pixels)
+	bw.write(1, 1)
+	bw.write(webpTransformSubtractGreen, 2)
+
+	modes := webpPredict(pixels, width, height)
+	bw.write(1, 1)
+	bw.write(webpTransformPredictor, 2)
+	bw.write(webpPredictorBits-2, 3)
+	bw.writeImage(modes, false)
+
+	bw.write(0, 1) // no more transforms
+	bw.writeImage(pixels, true)
+	bw.flush()
+
+	data := bw.buf
+	if len(data)%2 == 1 {
+		data = append(data, 0)
+	}
+
+	header := make([]byte, 20)
+	copy(header[0:], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], uint32(12+len(data)))
+	copy(header[8:], "WEBPVP8L")
+	binary.LittleEndian.PutUint32(header[16:], uint32(len(bw.buf)))
+	if _, err := wr.Write(header); err != nil {
+		return err
+	}
+
+	_, err := wr.Write(data)
+	return err
+}
+
+const (
+	webpTransformPredictor     = 0
+	webpTransformSubtractGreen = 2
+
+	// the predictor mode is picked for each block of 16x16 pixels
+	webpPredictorBits = 4
+)
+
+// predictors tried for each block: the pixel on the left, the pixel above
+// and the average of both
+var webpPredictorModes = []uint32{1, 2, 7}
+
+// webpSubtractGreen subtracts the green channel from the red and blue ones
+// as they mostly change together in the rendered images.
+func webpSubtractGreen(pixels []uint32) {
+	for i, argb := range pixels {
+		green := argb >> 8 & 0xff
+		red := (argb>>16 - green) & 0xff
+		blue := (argb - green) & 0xff
+		pixels[i] = argb&0xff00ff00 | red<<16 | blue
+	}
+}
+
+// webpPredict replaces the pixels with their difference from the pixel
+// predicted by the mode that fits each block best. it returns the image of
+// the modes, one pixel per block with the mode in the green channel.
+func webpPredict(pixels []uint32, width, height int) []uint32 {
+	original := make([]uint32, len(pixels))
+	copy(original, pixels)
+
+	blockSize := 1 << webpPredictorBits
+	blocksX := (width + blockSize - 1) / blockSize
+	blocksY := (height + blockSize - 1) / blockSize
+	modes := make([]uint32, blocksX*blocksY)
+
+	for by := 0; by < blocksY; by++ {
+		for bx := 0; bx < blocksX; bx++ {
+			best, bestCost := webpPredictorModes[0], -1
+			for _, mode := range webpPredictorModes {
+				cost := 0
+				for y := by * blockSize; y < height && y < (by+1)*blockSize; y++ {
+					for x := bx * blockSize; x < width && x < (bx+1)*blockSize; x++ {
+						cost += webpResidualCost(webpResidual(original, width, x, y, mode))
+					}
+				}
+
+				if bestCost == -1 || cost < bestCost {
+					best, bestCost = mode, cost
+				}
+			}
+			modes[by*blocksX+bx] = 0xff000000 | best<<8
+		}
+	}
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			mode := modes[y>>webpPredictorBits*blocksX+x>>webpPredictorBits] >> 8 & 0xff
+			pixels[y*width+x] = webpResidual(original, width, x, y, mode)
+		}
+	}
+
+	return modes
+}
+
+// webpResidual returns the difference between the pixel and its
+// prediction. the first pixel is predicted as opaque black, the rest of
+// the first row from the left and the first column from above whatever
+// the mode of their block.
+func webpResidual(pixels []uint32, width, x, y int, mode uint32) uint32 {
+	i := y*width + x
+	switch {
+	case x == 0 && y == 0:
+		return webpSubPixels(pixels[i], 0xff000000)
+	case y == 0:
+		mode = 1
+	case x == 0:
+		mode = 2
+	}
+
+	left, top := uint32(0), uint32(0)
+	if x > 0 {
+		left = pixels[i-1]
+	}
+	if y > 0 {
+		top = pixels[i-width]
+	}
+
+	switch mode {
+	case 1:
+		return webpSubPixels(pixels[i], left)
+	case 2:
+		return webpSubPixels(pixels[i], top)
+	default:
+		return webpSubPixels(pixels[i], webpAveragePixels(left, top))
+	}
+}
+
+// webpSubPixels subtracts each channel separately, wrapping around
+func webpSubPixels(a, b uint32) uint32 {
+	alphaGreen := (a | 0x00ff00ff) - (b & 0xff00ff00)
+	redBlue := (a | 0xff00ff00) - (b & 0x00ff00ff)
+	return alphaGreen&0xff00ff00 | redBlue&0x00ff00ff
+}
+
+func webpAveragePixels(a, b uint32) uint32 {
+	return ((a^b)&0xfefefefe)>>1 + a&b
+}
+
+// webpResidualCost estimates how well a residual compresses by how far its
+// channels are from zero.
+func webpResidualCost(residual uint32) int {
+	cost := 0
+	for shift := 0; shift < 32; shift += 8 {
+		channel := int(int8(residual >> shift))
+		if channel < 0 {
+			channel = -channel
+		}
+		cost += channel
+	}
+	return cost
+}
+
+// writeImage writes the pixels of the image or of a transform. only the
+// main image has the bit for meta prefix codes.
+func (w *webpBitWriter) writeImage(pixels []uint32, main bool) {
+	tokens := webpTokenize(pixels)
+
+	var counts [5][]int
+	for i, size := range webpAlphabetSizes {
+		counts[i] = make([]int, size)
+	}
+	for _, token := range tokens {
+		if token.length > 0 {
+			symbol, _, _ := webpPrefixEncode(token.length - 1)
+			counts[0][256+symbol]++
+			counts[4][webpPrevPixelDistance]++
+			continue
+		}
+
+		argb := token.argb
+		counts[0][argb>>8&0xff]++
+		counts[1][argb>>16&0xff]++
+		counts[2][argb&0xff]++
+		counts[3][argb>>24]++
+	}
+
+	w.write(0, 1) // no color cache
+	if main {
+		w.write(0, 1) // no meta prefix codes
+	}
+
+	var codes [5]webpPrefixCode
+	for i := range codes {
+		codes[i] = w.writePrefixCode(counts[i])
+	}
+
+	for _, token := range tokens {
+		if token.length > 0 {
+			symbol, extraBits, extra := webpPrefixEncode(token.length - 1)
+			codes[0].write(w, 256+symbol)
+			w.write(extra, extraBits)
+			codes[4].write(w, webpPrevPixelDistance)
+			continue
+		}
+
+		argb := token.argb
+		codes[0].write(w, int(argb>>8&0xff))
+		codes[1].write(w, int(argb>>16&0xff))
+		codes[2].write(w, int(argb&0xff))
+		codes[3].write(w, int(argb>>24))
+	}
+}
+
+// alphabet sizes of the green (plus backward reference lengths), red, blue,
+// alpha and distance prefix codes
+var webpAlphabetSizes = [5]int{256 + 24, 256, 256, 256, 40}
+
+const (
+	// distance code 2 points to the pixel on the left
+	webpPrevPixelDistance = 1
+	webpMinRunLength      = 3
+	webpMaxRunLength      = 4096
+)
+
+var webpCodeLengthOrder = [19]int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// webpToken is either a literal pixel or, when length is set, a copy of
+// the previous pixel repeated length times.
+type webpToken struct {
+	argb   uint32
+	length int
+}
+
+func webpTokenize(pixels []uint32) []webpToken {
+	tokens := []webpToken{}
+	for i := 0; i < len(pixels); {
+		run := 0
+		if i > 0 {
+			for i+run < len(pixels) && run < webpMaxRunLength && pixels[i+run] == pixels[i-1] {
+				run++
+			}
+		}
+
+		if run >= webpMinRunLength {
+			tokens = append(tokens, webpToken{length: run})
+			i += run
+			continue
+		}
+
+		tokens = append(tokens, webpToken{argb: pixels[i]})
+		i++
+	}
+	return tokens
+}
+
+// webpPrefixEncode splits a backward reference length or distance (minus
+// one) into its prefix symbol and extra bits.
+func webpPrefixEncode(value int) (symbol int, extraBits uint, extra uint32) {
+	if value < 4 {
+		return value, 0, 0
+	}
+
+	highest := uint(0)
+	for v := value; v > 1; v >>= 1 {
+		highest++
+	}
+	extraBits = highest - 1
+	symbol = int(2*highest) + (value>>extraBits)&1
+	return symbol, extraBits, uint32(value) & (1<<extraBits - 1)
+}
+
+type webpBitWriter struct {
+	buf  []byte
+	bits uint64
+	n    uint
+}
+
+// write appends the lowest n bits of the value, least significant first.
+func (w *webpBitWriter) write(value uint32, n uint) {
+	w.bits |= uint64(value) << w.n
+	w.n += n
+	for w.n >= 8 {
+		w.buf = append(w.buf, byte(w.bits))
+		w.bits >>= 8
+		w.n -= 8
+	}
+}
+
+func (w *webpBitWriter) flush() {
+	if w.n > 0 {
+		w.buf = append(w.buf, byte(w.bits))
+		w.bits, w.n = 0, 0
+	}
+}
+
+// webpPrefixCode holds the bit-reversed canonical code of each symbol so
+// that it can be written least significant bit first.
+type webpPrefixCode struct {
+	codes   []uint32
+	lengths []uint
+}
+
+func (c webpPrefixCode) write(w *webpBitWriter, symbol int) {
+	w.write(c.codes[symbol], c.lengths[symbol])
+}
+
+// writePrefixCode writes the prefix code built from the symbol counts and
+// returns it for writing the symbols.
+func (w *webpBitWriter) writePrefixCode(counts []int) webpPrefixCode {
+	used := []int{}
+	for symbol, count := range counts {
+		if count > 0 {
+			used = append(used, symbol)
+		}
+	}
+
+	code := webpPrefixCode{codes: make([]uint32, len(counts)), lengths: make([]uint, len(counts))}
+
+	// the simple code stores up to two symbols below 256 directly
+	if len(used) == 0 || (len(used) <= 2 && used[len(used)-1] < 256) {
+		if len(used) == 0 {
+			used = append(used, 0)
+		}
+
+		w.write(1, 1)
+		w.write(uint32(len(used)-1), 1)
+		if used[0] < 2 {
+			w.write(0, 1)
+			w.write(uint32(used[0]), 1)
+		} else {
+			w.write(1, 1)
+			w.write(uint32(used[0]), 8)
+		}
+
+		if len(used) == 2 {
+			w.write(uint32(used[1]), 8)
+			code.codes[used[1]] = 1
+			code.lengths[used[0]], code.lengths[used[1]] = 1, 1
+		}
+		return code
+	}
+
+	lengths := webpCodeLengths(counts, 15)
+	w.write(0, 1)
+
+	// code lengths are written with the code length code, using symbols
+	// 17 and 18 for runs of zeros
+	type lengthToken struct {
+		symbol int
+		extra  uint32
+	}
+
+	tokens := []lengthToken{}
+	for i := 0; i < len(lengths); {
+		if lengths[i] != 0 {
+			tokens = append(tokens, lengthToken{symbol: int(lengths[i])})
+			i++
+			continue
+		}
+
+		zeros := 0
+		for i+zeros < len(lengths) && lengths[i+zeros] == 0 && zeros < 138 {
+			zeros++
+		}
+
+		switch {
+		case zeros >= 11:
+			tokens = append(tokens, lengthToken{symbol: 18, extra: uint32(zeros - 11)})
+		case zeros >= 3:
+			tokens = append(tokens, lengthToken{symbol: 17, extra: uint32(zeros - 3)})
+		default:
+			for j := 0; j < zeros; j++ {
+				tokens = append(tokens, lengthToken{symbol: 0})
+			}
+		}
+		i += zeros
+	}
+
+	lengthCounts := make([]int, len(webpCodeLengthOrder))
+	for _, token := range tokens {
+		lengthCounts[token.symbol]++
+	}
+
+	lengthCodeLengths := webpCodeLengths(lengthCounts, 7)
+	numLengths := len(webpCodeLengthOrder)
+	for numLengths > 4 && lengthCodeLengths[webpCodeLengthOrder[numLengths-1]] == 0 {
+		numLengths--
+	}
+
+	w.write(uint32(numLengths-4), 4)
+	for _, symbol := range webpCodeLengthOrder[:numLengths] {
+		w.write(uint32(lengthCodeLengths[symbol]), 3)
+	}
+	w.write(0, 1) // lengths are given for every symbol
+
+	lengthCode := newWebpPrefixCode(lengthCodeLengths)
+	for _, token := range tokens {
+		lengthCode.write(w, token.symbol)
+		switch token.symbol {
+		case 17:
+			w.write(token.extra, 3)
+		case 18:
+			w.write(token.extra, 7)
+		}
+	}
+
+	return newWebpPrefixCode(lengths)
+}
+
+// newWebpPrefixCode assigns the canonical codes for the code lengths. a
+// code with a single symbol takes no bits at all.
+func newWebpPrefixCode(lengths []uint8) webpPrefixCode {
+	code := webpPrefixCode{codes: make([]uint32, len(lengths)), lengths: make([]uint, len(lengths))}
+
+	var lengthCounts [16]uint32
+	used := 0
+	for _, length := range lengths {
+		if length > 0 {
+			lengthCounts[length]++
+			used++
+		}
+	}
+
+	if used < 2 {
+		return code
+	}
+
+	var nextCodes [16]uint32
+	next := uint32(0)
+	for length := 1; length < len(nextCodes); length++ {
+		next = (next + lengthCounts[length-1]) << 1
+		nextCodes[length] = next
+	}
+
+	for symbol, length := range lengths {
+		if length == 0 {
+			continue
+		}
+
+		canonical := nextCodes[length]
+		nextCodes[length]++
+
+		reversed := uint32(0)
+		for i := uint8(0); i < length; i++ {
+			reversed = reversed<<1 | canonical>>i&1
+		}
+
+		code.codes[symbol] = reversed
+		code.lengths[symbol] = uint(length)
+	}
+
+	return code
+}
+
+// webpCodeLengths computes huffman code lengths of at most maxLength bits
+// for the symbol counts. when the tree gets too deep the rare symbols are
+// counted as more frequent until it fits.
+func webpCodeLengths(counts []int, maxLength int) []uint8 {
+	for floor := 1; ; floor *= 2 {
+		lengths, depth := webpHuffmanLengths(counts, floor)
+		if depth <= maxLength {
+			return lengths
+		}
+	}
+}
+
+func webpHuffmanLengths(counts []int, floor int) ([]uint8, int) {
+	type node struct {
+		weight      int
+		symbol      int
+		left, right int
+	}
+
+	nodes := []node{}
+	for symbol, count := range counts {
+		if count == 0 {
+			continue
+		}
+		if count < floor {
+			count = floor
+		}
+		nodes = append(nodes, node{weight: count, symbol: symbol, left: -1, right: -1})
+	}
+
+	lengths := make([]uint8, len(counts))
+	if len(nodes) == 1 {
+		lengths[nodes[0].symbol] = 1
+		return lengths, 1
+	}
+
+	sort.SliceStable(nodes, func(i, j int) bool {
+		return nodes[i].weight < nodes[j].weight
+	})
+
+	// leaves and merged nodes are both kept in increasing weight order so
+	// the two lightest nodes are always at the front of either queue
+	leaves := len(nodes)
+	nextLeaf, nextMerged := 0, leaves
+	lightest := func() int {
+		if nextLeaf < leaves && (nextMerged >= len(nodes) || nodes[nextLeaf].weight <= nodes[nextMerged].weight) {
+			nextLeaf++
+			return nextLeaf - 1
+		}
+		nextMerged++
+		return nextMerged - 1
+	}
+
+	for i := 1; i < leaves; i++ {
+		left := lightest()
+		right := lightest()
+		nodes = append(nodes, node{weight: nodes[left].weight + nodes[right].weight, symbol: -1, left: left, right: right})
+	}
+
+	depth := 0
+	var walk func(n int, d int)
+	walk = func(n int, d int) {
+		if nodes[n].left < 0 {
+			lengths[nodes[n].symbol] = uint8(d)
+			if d > depth {
+				depth = d
+			}
+			return
+		}
+		walk(nodes[n].left, d+1)
+		walk(nodes[n].right, d+1)
+	}
+	walk(len(nodes)-1, 0)
+
+	return lengths, depth
+}
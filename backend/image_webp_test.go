@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+
+	"golang.org/x/image/webp"
+)
+
+func TestEncodeWebP(t *testing.T) {
+	noise := image.NewNRGBA(image.Rect(0, 0, 97, 61))
+	random := rand.New(rand.NewSource(14))
+	random.Read(noise.Pix)
+
+	card := image.NewNRGBA(image.Rect(0, 0, 320, 180))
+	for y := 0; y < 180; y++ {
+		for x := 0; x < 320; x++ {
+			c := color.NRGBA{R: 0xfb, G: 0xcf, B: 0xe8, A: 0xff}
+			if x > 40 && x < 280 && y > 30 && y < 150 {
+				c = color.NRGBA{R: uint8(x), G: uint8(y), B: 0x80, A: uint8(255 - y)}
+			}
+			card.SetNRGBA(x, y, c)
+		}
+	}
+
+	solid := image.NewNRGBA(image.Rect(0, 0, 5000, 3))
+	for i := range solid.Pix {
+		solid.Pix[i] = 0xff
+	}
+
+	cases := map[string]image.Image{
+		"noise": noise,
+		"card":  card,
+		"solid": solid,
+		"pixel": image.NewNRGBA(image.Rect(0, 0, 1, 1)),
+		"rgba":  image.NewRGBA(image.Rect(10, 10, 30, 20)),
+	}
+
+	for name, img := range cases {
+		buf := &bytes.Buffer{}
+		if err := encodeWebP(buf, img); err != nil {
+			t.Errorf("%s: failed to encode: %v", name, err)
+			continue
+		}
+
+		decoded, err := webp.Decode(buf)
+		if err != nil {
+			t.Errorf("%s: failed to decode: %v", name, err)
+			continue
+		}
+
+		bounds := img.Bounds()
+		if decoded.Bounds().Dx() != bounds.Dx() || decoded.Bounds().Dy() != bounds.Dy() {
+			t.Errorf("%s: expected size %v, got %v", name, bounds.Size(), decoded.Bounds().Size())
+			continue
+		}
+
+	compare:
+		for y := 0; y < bounds.Dy(); y++ {
+			for x := 0; x < bounds.Dx(); x++ {
+				expected := color.NRGBAModel.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y))
+				got := color.NRGBAModel.Convert(decoded.At(x, y))
+				if expected != got {
+					t.Errorf("%s: pixel (%d, %d): expected %v, got %v", name, x, y, expected, got)
+					break compare
+				}
+			}
+		}
+	}
+}
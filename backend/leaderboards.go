@@ -0,0 +1,278 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/tools/search"
+)
+
+const (
+	leaderboardWindow24h    = "24h"
+	leaderboardWindowWeek   = "week"
+	leaderboardWindowSeason = "season"
+)
+
+var errInvalidLeaderboardWindow = errors.New("invalid leaderboard window")
+
+const bucketDayLayout = "2006-01-02"
+
+func bucketDay(t time.Time) string {
+	return t.In(leaderboardTimezone).Format(bucketDayLayout)
+}
+
+// bucketDayRange returns the time the bucket day starts and the time the
+// next one starts
+func bucketDayRange(day string) (time.Time, time.Time, error) {
+	start, err := time.ParseInLocation(bucketDayLayout, day, leaderboardTimezone)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return start, start.AddDate(0, 0, 1), nil
+}
+
+// findOrNewRankingBucket returns the recipient's bucket in the tenant for
+// the day, or a new unsaved one if there is none yet.
+func findOrNewRankingBucket(dao *daos.Dao, tenantId string, recipientId string, day string) (*models.Record, error) {
+	buckets, err := dao.FindRecordsByExpr("ranking_buckets", dbx.HashExp{
+		"tenant":    tenantId,
+		"recipient": recipientId,
+		"day":       day,
+	})
+	if err != nil {
+		return nil, err
+	} else if len(buckets) != 0 {
+		return buckets[0], nil
+	}
+
+	collection, err := dao.FindCollectionByNameOrId("ranking_buckets")
+	if err != nil {
+		return nil, err
+	}
+
+	bucket := models.NewRecord(collection)
+	bucket.Set("tenant", tenantId)
+	bucket.Set("recipient", recipientId)
+	bucket.Set("day", day)
+	return bucket, nil
+}
+
+// recomputeRankingBucket rewrites the recipient's bucket for the day of the
+// given time with the score of the messages sent that day. the scoring is
+// the same as the season's but applies per bucket: the sender cap and the
+// unique sender bonus count once a day, so a window of several days can
+// add up to more than the season score of the same messages.
+func recomputeRankingBucket(dao *daos.Dao, tenantId string, recipientId string, at time.Time) error {
+	if recipientId == "everyone" {
+		return nil
+	}
+
+	day := bucketDay(at)
+	from, to, err := bucketDayRange(day)
+	if err != nil {
+		return err
+	}
+
+	contributions, err := querySenderContributionsBetween(dao, tenantId, recipientId, from, to)
+	if err != nil {
+		return err
+	}
+
+	messagesCount := 0
+	for _, contribution := range contributions {
+		if !rankingScoring.ExcludeSelfSends || !contribution.IsSelfSend() {
+			messagesCount += contribution.Messages
+		}
+	}
+
+	bucket, err := findOrNewRankingBucket(dao, tenantId, recipientId, day)
+	if err != nil {
+		return err
+	}
+
+	bucket.Set("total_coins", rankingScoring.Score(contributions)[recipientId])
+	bucket.Set("messages_count", messagesCount)
+	return dao.SaveRecord(bucket)
+}
+
+// isHiddenFromLeaderboards reports whether the recipient should be left
+// out of the public leaderboards. students who have not signed up yet are
+// hidden by default.
+func isHiddenFromLeaderboards(details *models.Record) bool {
+	return details == nil || details.GetBool("hide_from_leaderboards")
+}
+
+// leaderboardWindowStart returns the first bucket day included in the
+// window. the 24h window does not follow the day buckets and has no start
+// day, see queryWindowLeaderboard.
+func leaderboardWindowStart(window string, now time.Time) (string, error) {
+	now = now.In(leaderboardTimezone)
+
+	switch window {
+	case leaderboardWindowWeek:
+		// weeks start on monday
+		daysSinceMonday := (int(now.Weekday()) + 6) % 7
+		return bucketDay(now.AddDate(0, 0, -daysSinceMonday)), nil
+	case leaderboardWindowSeason, "":
+		return "", nil
+	default:
+		return "", fmt.Errorf("%w '%s'", errInvalidLeaderboardWindow, window)
+	}
+}
+
+type leaderboardRow struct {
+	RecipientID string  `db:"recipient_id"`
+	Department  string  `db:"department"`
+	Sex         string  `db:"sex"`
+	TotalCoins  float64 `db:"total_coins"`
+}
+
+// queryLeaderboard sums the buckets of each recipient in the tenant
+// starting from the given day, but only the days of the given season.
+// department and sex are taken from the recipient's ranking in that
+// season. recipients without a ranking or with a hidden one are left out.
+func queryLeaderboard(dao *daos.Dao, tenantId string, seasonId string, sinceDay string) (Recipients, error) {
+	firstDay, lastDay, err := seasonBucketDays(dao, seasonId)
+	if err != nil {
+		return nil, err
+	} else if firstDay > sinceDay {
+		sinceDay = firstDay
+	}
+
+	rows := []leaderboardRow{}
+	err = dao.DB().NewQuery(`
+		SELECT b.recipient AS recipient_id,
+			COALESCE(r.college_department, 'unknown') AS department,
+			COALESCE(r.sex, 'unknown') AS sex,
+			SUM(b.total_coins) AS total_coins
+		FROM ranking_buckets b
+		INNER JOIN rankings r ON r.recipient = b.recipient AND r.tenant = b.tenant AND r.season = {:season}
+		WHERE b.tenant = {:tenant} AND b.day >= {:since} AND ({:until} = '' OR b.day <= {:until})
+			AND r.hidden = FALSE
+		GROUP BY b.recipient
+	`).Bind(dbx.Params{
+		"tenant": tenantId,
+		"since":  sinceDay,
+		"until":  lastDay,
+		"season": seasonId,
+	}).All(&rows)
+	if err != nil {
+		return nil, err
+	}
+
+	recipients := make(Recipients, 0, len(rows))
+	for _, row := range rows {
+		if row.TotalCoins <= 0 {
+			continue
+		}
+
+		recipients = append(recipients, &RecipientStats2{
+			RecipientID: row.RecipientID,
+			Department:  row.Department,
+			Sex:         row.Sex,
+			TotalCoins:  float32(row.TotalCoins),
+		})
+	}
+
+	sort.Stable(recipients)
+	return recipients, nil
+}
+
+// queryWindowLeaderboard returns the leaderboard of the tenant for the
+// window. the week and season windows sum the day buckets while the 24h
+// window scores the messages of the last 24 hours, so the sender cap and
+// the unique sender bonus count once over those 24 hours.
+func queryWindowLeaderboard(dao *daos.Dao, tenantId string, window string, now time.Time) (Recipients, error) {
+	if window == leaderboardWindow24h {
+		return queryRecentLeaderboard(dao, tenantId, now.Add(-24*time.Hour))
+	}
+
+	sinceDay, err := leaderboardWindowStart(window, now)
+	if err != nil {
+		return nil, err
+	}
+
+	return queryLeaderboard(dao, tenantId, currentSeasonId(dao), sinceDay)
+}
+
+// queryRecentLeaderboard scores the messages sent to each recipient in the
+// tenant since the given time. like queryLeaderboard, recipients without a
+// ranking or with a hidden one are left out.
+func queryRecentLeaderboard(dao *daos.Dao, tenantId string, since time.Time) (Recipients, error) {
+	contributions, err := querySenderContributionsBetween(dao, tenantId, "", since, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+
+	scores := rankingScoring.Score(contributions)
+	recipientIds := make([]any, 0, len(scores))
+	for recipientId := range scores {
+		recipientIds = append(recipientIds, recipientId)
+	}
+
+	if len(recipientIds) == 0 {
+		return Recipients{}, nil
+	}
+
+	rows := []leaderboardRow{}
+	err = dao.DB().
+		Select("recipient AS recipient_id", "COALESCE(college_department, 'unknown') AS department", "COALESCE(sex, 'unknown') AS sex").
+		From("rankings").
+		Where(dbx.HashExp{"tenant": tenantId, "season": currentSeasonId(dao), "recipient": recipientIds}).
+		AndWhere(dbx.NewExp("hidden = FALSE")).
+		All(&rows)
+	if err != nil {
+		return nil, err
+	}
+
+	recipients := make(Recipients, 0, len(rows))
+	for _, row := range rows {
+		if scores[row.RecipientID] <= 0 {
+			continue
+		}
+
+		recipients = append(recipients, &RecipientStats2{
+			RecipientID: row.RecipientID,
+			Department:  row.Department,
+			Sex:         row.Sex,
+			TotalCoins:  float32(scores[row.RecipientID]),
+		})
+	}
+
+	sort.Stable(recipients)
+	return recipients, nil
+}
+
+func paginateRecipients(recipients Recipients, page int, perPage int) *search.Result {
+	if perPage <= 0 || perPage > search.MaxPerPage {
+		perPage = search.DefaultPerPage
+	}
+
+	if page <= 0 {
+		page = 1
+	}
+
+	start := (page - 1) * perPage
+	end := start + perPage
+	if start > len(recipients) {
+		start = len(recipients)
+	}
+
+	if end > len(recipients) {
+		end = len(recipients)
+	}
+
+	return &search.Result{
+		Page:       page,
+		PerPage:    perPage,
+		TotalItems: len(recipients),
+		TotalPages: int(math.Ceil(float64(len(recipients)) / float64(perPage))),
+		Items:      recipients[start:end],
+	}
+}
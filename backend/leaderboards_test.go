@@ -0,0 +1,412 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/daos"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/tests"
+)
+
+// addTestRankingBucket adds the coins and a message to the recipient's
+// bucket for the day of the given time
+func addTestRankingBucket(t *testing.T, dao *daos.Dao, tenantId string, recipientId string, at time.Time, coins float64) {
+	t.Helper()
+
+	bucket, err := findOrNewRankingBucket(dao, tenantId, recipientId, bucketDay(at))
+	if err != nil {
+		t.Fatalf("Failed to find bucket: %v", err)
+	}
+
+	bucket.Set("total_coins", bucket.GetFloat("total_coins")+coins)
+	bucket.Set("messages_count", bucket.GetInt("messages_count")+1)
+	if err := dao.SaveRecord(bucket); err != nil {
+		t.Fatalf("Failed to save bucket: %v", err)
+	}
+}
+
+// saveTestMessageAt saves a message from the sender to the recipient that
+// was created at the given time
+func saveTestMessageAt(t *testing.T, app *tests.TestApp, userId string, recipient string, at time.Time) *models.Record {
+	t.Helper()
+
+	collection, _ := app.Dao().FindCollectionByNameOrId("messages")
+	message := models.NewRecord(collection)
+	message.Set("user", userId)
+	message.Set("recipient", recipient)
+	message.Set("content", "Hello")
+	message.Set("season", currentSeason)
+	message.Set("tenant", defaultTenant)
+	message.Created.Scan(at)
+	if err := app.Dao().SaveRecord(message); err != nil {
+		t.Fatalf("Failed to save message: %v", err)
+	}
+
+	return message
+}
+
+func findTestRankingBucket(t *testing.T, dao *daos.Dao, recipientId string, at time.Time) *models.Record {
+	t.Helper()
+
+	bucket, err := findOrNewRankingBucket(dao, defaultTenant, recipientId, bucketDay(at))
+	if err != nil {
+		t.Fatalf("Failed to find bucket: %v", err)
+	}
+	return bucket
+}
+
+func TestRecomputeRankingBucket(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Cleanup()
+
+	defer func(scoring RankingScoring) { rankingScoring = scoring }(rankingScoring)
+	rankingScoring = RankingScoring{SenderCap: 200, UniqueSenderBonus: 10}
+
+	dao := app.Dao()
+	today := time.Now()
+	yesterday := today.AddDate(0, 0, -1)
+
+	saveTestMessageAt(t, app, "sender1", "202000000001", yesterday)
+	saveTestMessageAt(t, app, "sender1", "202000000001", today)
+	saveTestMessageAt(t, app, "sender1", "202000000001", today)
+	saveTestMessageAt(t, app, "sender2", "202000000001", today)
+
+	for _, at := range []time.Time{yesterday, today} {
+		if err := recomputeRankingBucket(dao, defaultTenant, "202000000001", at); err != nil {
+			t.Fatalf("recomputeRankingBucket failed: %v", err)
+		}
+	}
+
+	// the cap and the bonus are applied to the messages of the day
+	bucket := findTestRankingBucket(t, dao, "202000000001", today)
+	if coins := bucket.GetFloat("total_coins"); coins != (200+10)+(150+10) {
+		t.Errorf("Expected the scored coins of today, got %f", coins)
+	}
+
+	if count := bucket.GetInt("messages_count"); count != 3 {
+		t.Errorf("Expected 3 messages today, got %d", count)
+	}
+
+	// sender1 is capped once a day in the buckets but once a season in
+	// the ranking, so the buckets of both days add up to more
+	contributions, _ := querySenderContributions(dao, defaultTenant, "202000000001")
+	seasonScore := rankingScoring.Score(contributions)["202000000001"]
+	bucketsScore := bucket.GetFloat("total_coins") + findTestRankingBucket(t, dao, "202000000001", yesterday).GetFloat("total_coins")
+	if seasonScore != (200+10)+(150+10) || bucketsScore != seasonScore+150+10 {
+		t.Errorf("Expected the buckets to cap per day, got season %f and buckets %f", seasonScore, bucketsScore)
+	}
+}
+
+func TestOnMessageSaved(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Cleanup()
+
+	dao := app.Dao()
+	message := saveTestMessageAt(t, app, "sender1", "202000000001", time.Now())
+	if err := onMessageSaved(&core.ModelEvent{Dao: dao, Model: message}); err != nil {
+		t.Fatalf("onMessageSaved failed: %v", err)
+	}
+
+	if ranking, err := findRanking(dao, defaultTenant, "202000000001"); err != nil || ranking.GetFloat("total_coins") != sendPrice {
+		t.Errorf("Expected the ranking to include the message, got %v (err: %v)", ranking, err)
+	}
+
+	if coins := findTestRankingBucket(t, dao, "202000000001", time.Now()).GetFloat("total_coins"); coins != sendPrice {
+		t.Errorf("Expected the bucket to include the message, got %f", coins)
+	}
+
+	if err := dao.DeleteRecord(message); err != nil {
+		t.Fatal(err)
+	}
+	if err := onMessageSaved(&core.ModelEvent{Dao: dao, Model: message}); err != nil {
+		t.Fatalf("onMessageSaved failed: %v", err)
+	}
+
+	if coins := findTestRankingBucket(t, dao, "202000000001", time.Now()).GetFloat("total_coins"); coins != 0 {
+		t.Errorf("Expected the deleted message to be removed from the bucket, got %f", coins)
+	}
+
+	// hidden posts do not create a ranking
+	hidden := saveTestMessageAt(t, app, "sender1", "202000000002", time.Now())
+	hidden.Set("hidden", true)
+	dao.SaveRecord(hidden)
+	concealHiddenPost(hidden)
+	if err := onMessageSaved(&core.ModelEvent{Dao: dao, Model: hidden}); err != nil {
+		t.Fatalf("onMessageSaved failed: %v", err)
+	}
+
+	if _, err := findRanking(dao, defaultTenant, "202000000002"); err == nil {
+		t.Error("Expected no ranking for the hidden message")
+	}
+}
+
+func TestOnMessageUpdated(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Cleanup()
+
+	dao := app.Dao()
+	saved := saveTestMessageAt(t, app, "sender1", "202000000001", time.Now())
+	if err := onMessageSaved(&core.ModelEvent{Dao: dao, Model: saved}); err != nil {
+		t.Fatalf("onMessageSaved failed: %v", err)
+	}
+
+	updateMessage := func(change func(message *models.Record)) {
+		t.Helper()
+
+		message, err := dao.FindRecordById("messages", saved.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		change(message)
+		if err := dao.SaveRecord(message); err != nil {
+			t.Fatal(err)
+		}
+
+		concealHiddenPost(message)
+		if err := onMessageUpdated(&core.ModelEvent{Dao: dao, Model: message}); err != nil {
+			t.Fatalf("onMessageUpdated failed: %v", err)
+		}
+	}
+
+	coinsOf := func(recipientId string) (float64, float64) {
+		t.Helper()
+
+		ranking, err := findRanking(dao, defaultTenant, recipientId)
+		if err != nil {
+			t.Fatalf("Failed to find the ranking of %s: %v", recipientId, err)
+		}
+		return ranking.GetFloat("total_coins"), findTestRankingBucket(t, dao, recipientId, time.Now()).GetFloat("total_coins")
+	}
+
+	// the coins move along with the message
+	updateMessage(func(message *models.Record) {
+		message.Set("recipient", "202000000002")
+	})
+
+	if total, bucket := coinsOf("202000000001"); total != 0 || bucket != 0 {
+		t.Errorf("Expected the previous recipient to lose the coins, got %f and %f in the bucket", total, bucket)
+	}
+
+	if total, bucket := coinsOf("202000000002"); total != sendPrice || bucket != sendPrice {
+		t.Errorf("Expected the new recipient to get the coins, got %f and %f in the bucket", total, bucket)
+	}
+
+	// hiding a counted message takes its coins off the board
+	updateMessage(func(message *models.Record) {
+		message.Set("hidden", true)
+	})
+
+	if total, bucket := coinsOf("202000000002"); total != 0 || bucket != 0 {
+		t.Errorf("Expected the hidden message to be removed, got %f and %f in the bucket", total, bucket)
+	}
+
+	updateMessage(func(message *models.Record) {
+		message.Set("hidden", false)
+	})
+
+	if total, bucket := coinsOf("202000000002"); total != sendPrice || bucket != sendPrice {
+		t.Errorf("Expected the revealed message to be counted again, got %f and %f in the bucket", total, bucket)
+	}
+}
+
+func TestLeaderboardWindowStart(t *testing.T) {
+	// wednesday, 1 AM in philippine time
+	now := time.Date(2023, time.February, 15, 1, 0, 0, 0, leaderboardTimezone)
+
+	cases := map[string]string{
+		leaderboardWindowWeek:   "2023-02-13",
+		leaderboardWindowSeason: "",
+	}
+
+	for window, expected := range cases {
+		got, err := leaderboardWindowStart(window, now)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", window, err)
+		} else if got != expected {
+			t.Errorf("%s: expected %q, got %q", window, expected, got)
+		}
+	}
+
+	if _, err := leaderboardWindowStart("month", now); err == nil {
+		t.Error("Expected error for invalid window, got nil")
+	}
+}
+
+func TestQueryLeaderboard(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Cleanup()
+
+	dao := app.Dao()
+	today := time.Now()
+	lastWeek := today.AddDate(0, 0, -8)
+
+	saveTestRanking(t, app, "202000000001", 0)
+	ranking := saveTestRanking(t, app, "202000000002", 0)
+	ranking.Set("sex", "female")
+	ranking.Set("college_department", "ccs")
+	dao.SaveRecord(ranking)
+
+	for _, bucket := range []struct {
+		recipient string
+		at        time.Time
+		coins     float64
+	}{
+		{"202000000001", lastWeek, 1000},
+		{"202000000001", today, 150},
+		{"202000000002", today, 200},
+		{"202000000002", today, 150},
+		{"everyone", today, 150},
+	} {
+		addTestRankingBucket(t, dao, defaultTenant, bucket.recipient, bucket.at, bucket.coins)
+	}
+
+	season, err := queryLeaderboard(dao, defaultTenant, currentSeasonId(dao), "")
+	if err != nil {
+		t.Fatalf("queryLeaderboard failed: %v", err)
+	}
+
+	if len(season) != 2 || season[0].RecipientID != "202000000001" || season[0].TotalCoins != 1150 {
+		t.Errorf("Unexpected season leaderboard: %+v", season)
+	}
+
+	weekly, err := queryWindowLeaderboard(dao, defaultTenant, leaderboardWindowWeek, today)
+	if err != nil {
+		t.Fatalf("queryWindowLeaderboard failed: %v", err)
+	}
+
+	if len(weekly) != 2 || weekly[0].RecipientID != "202000000002" || weekly[0].TotalCoins != 350 {
+		t.Errorf("Unexpected weekly leaderboard: %+v", weekly)
+	}
+
+	if filtered := weekly.ByDepartment("ccs").BySex("female"); len(filtered) != 1 || filtered[0].RecipientID != "202000000002" {
+		t.Errorf("Unexpected filtered leaderboard: %+v", filtered)
+	}
+
+	if _, err := queryWindowLeaderboard(dao, defaultTenant, "month", today); !errors.Is(err, errInvalidLeaderboardWindow) {
+		t.Errorf("Expected invalid window error, got %v", err)
+	}
+}
+
+func TestQueryWindowLeaderboard_24h(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Cleanup()
+
+	dao := app.Dao()
+	now := time.Now()
+
+	saveTestRanking(t, app, "202000000001", 0)
+	saveTestRanking(t, app, "202000000002", 0)
+	saveTestRanking(t, app, "202000000003", 0)
+
+	// the window rolls over the last 24 hours instead of following the
+	// day buckets
+	saveTestMessageAt(t, app, "sender1", "202000000001", now.Add(-25*time.Hour))
+	saveTestMessageAt(t, app, "sender1", "202000000002", now.Add(-23*time.Hour))
+	saveTestMessageAt(t, app, "sender2", "202000000002", now.Add(-time.Hour))
+	saveTestMessageAt(t, app, "sender1", "202000000003", now.Add(-time.Hour))
+
+	recipients, err := queryWindowLeaderboard(dao, defaultTenant, leaderboardWindow24h, now)
+	if err != nil {
+		t.Fatalf("queryWindowLeaderboard failed: %v", err)
+	}
+
+	if len(recipients) != 2 || recipients[0].RecipientID != "202000000002" || recipients[0].TotalCoins != float32(2*sendPrice) {
+		t.Fatalf("Unexpected 24h leaderboard: %+v", recipients)
+	}
+
+	if recipients[1].RecipientID != "202000000003" || recipients[1].TotalCoins != float32(sendPrice) {
+		t.Errorf("Unexpected 24h leaderboard: %+v", recipients)
+	}
+}
+
+func TestPaginateRecipients(t *testing.T) {
+	recipients := Recipients{}
+	for i := 0; i < 5; i++ {
+		recipients = append(recipients, &RecipientStats2{TotalCoins: float32(5 - i)})
+	}
+
+	result := paginateRecipients(recipients, 2, 2)
+	if result.TotalItems != 5 || result.TotalPages != 3 {
+		t.Errorf("Expected 5 items in 3 pages, got %d items in %d pages", result.TotalItems, result.TotalPages)
+	}
+
+	if items := result.Items.(Recipients); len(items) != 2 || items[0].TotalCoins != 3 {
+		t.Errorf("Unexpected second page: %+v", items)
+	}
+
+	if items := paginateRecipients(recipients, 4, 2).Items.(Recipients); len(items) != 0 {
+		t.Errorf("Expected out of range page to be empty, got %+v", items)
+	}
+}
+
+func TestQueryLeaderboard_HiddenRecipients(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Cleanup()
+
+	dao := app.Dao()
+	today := time.Now()
+
+	saveTestRanking(t, app, "202000000001", 0)
+	hidden := saveTestRanking(t, app, "202000000002", 0)
+	hidden.Set("hidden", true)
+	dao.SaveRecord(hidden)
+
+	// recipients without a ranking are left out too
+	for _, recipient := range []string{"202000000001", "202000000002", "202000000003"} {
+		addTestRankingBucket(t, dao, defaultTenant, recipient, today, 150)
+	}
+
+	recipients, err := queryLeaderboard(dao, defaultTenant, currentSeasonId(dao), "")
+	if err != nil {
+		t.Fatalf("queryLeaderboard failed: %v", err)
+	}
+
+	if len(recipients) != 1 || recipients[0].RecipientID != "202000000001" {
+		t.Errorf("Expected only the visible recipient, got: %+v", recipients)
+	}
+}
+
+func TestUpdateRanking_Visibility(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Cleanup()
+
+	dao := app.Dao()
+
+	// not registered yet
+	if err := updateRanking(dao, defaultTenant, "202012345678", 150); err != nil {
+		t.Fatalf("updateRanking failed: %v", err)
+	}
+
+	ranking, _ := dao.FindFirstRecordByData("rankings", "recipient", "202012345678")
+	if !ranking.GetBool("hidden") {
+		t.Errorf("Expected unregistered recipient to be hidden")
+	}
+
+	details := newTestUserDetails(t, app)
+	if err := dao.SaveRecord(details); err != nil {
+		t.Fatalf("Failed to save user details: %v", err)
+	}
+
+	if err := syncRankingDetails(dao, details); err != nil {
+		t.Fatalf("syncRankingDetails failed: %v", err)
+	}
+
+	ranking, _ = dao.FindFirstRecordByData("rankings", "recipient", "202012345678")
+	if ranking.GetBool("hidden") {
+		t.Errorf("Expected registered recipient to be visible")
+	}
+
+	details.Set("hide_from_leaderboards", true)
+	if err := syncRankingDetails(dao, details); err != nil {
+		t.Fatalf("syncRankingDetails failed: %v", err)
+	}
+
+	ranking, _ = dao.FindFirstRecordByData("rankings", "recipient", "202012345678")
+	if !ranking.GetBool("hidden") {
+		t.Errorf("Expected opted out recipient to be hidden")
+	}
+}
@@ -16,6 +16,7 @@ type TemplatedMailSender struct {
 	template                   *template.Template
 	emailName                  string
 	subject                    string
+	senderName                 string
 	data                       any
 }
 
@@ -37,10 +38,15 @@ func (t *TemplatedMailSender) Message(meta settings.MetaConfig, toRecipientEmail
 		return nil, err
 	}
 
+	senderName := meta.SenderName
+	if len(t.senderName) != 0 {
+		senderName = t.senderName
+	}
+
 	return &mailer.Message{
 		From: mail.Address{
 			Address: meta.SenderAddress,
-			Name:    meta.SenderName,
+			Name:    senderName,
 		},
 		To:      mail.Address{Address: toRecipientEmail},
 		Subject: subjectBuf.String(),
@@ -55,10 +61,19 @@ func (t *TemplatedMailSender) With(data interface{}) *TemplatedMailSender {
 		subject:                    t.subject,
 		subjectTemplate:            t.subjectTemplate,
 		hasSubjectTemplateCompiled: t.hasSubjectTemplateCompiled,
+		senderName:                 t.senderName,
 		data:                       data,
 	}
 }
 
+// From sends the email under the given name instead of the sender name
+// in the settings (e.g. the site name of the tenant)
+func (t *TemplatedMailSender) From(senderName string) *TemplatedMailSender {
+	sender := t.With(t.data)
+	sender.senderName = senderName
+	return sender
+}
+
 func newTemplatedMailSender(tmpl *template.Template, emailName, subject string) *TemplatedMailSender {
 	return &TemplatedMailSender{
 		template:  tmpl,
@@ -82,6 +97,6 @@ func init() {
 	emailTemplates = emailTemplatesList{
 		reply:   newTemplatedMailSender(rawEmailTemplates.Lookup("reply.txt.tpl"), "Mr. Kupido", "Your message has received a reply!"),
 		message: newTemplatedMailSender(rawEmailTemplates.Lookup("message.txt.tpl"), "Mr. Kupido", "You received a new message!"),
-		welcome: newTemplatedMailSender(rawEmailTemplates.Lookup("welcome.txt.tpl"), "UIC Valentine Wall", "Welcome to UIC Valentine Wall 2023!"),
+		welcome: newTemplatedMailSender(rawEmailTemplates.Lookup("welcome.txt.tpl"), "Welcome", "Welcome to {{ .SeasonName }}!"),
 	}
 }
@@ -18,6 +18,10 @@ func main() {
 		Automigrate: true,
 	})
 
+	app.RootCmd.AddCommand(newRankingsCommand(app))
+	app.RootCmd.AddCommand(newSeasonCommand(app))
+	app.RootCmd.AddCommand(newImagesCommand(app))
+
 	// chrome/browser-based image rendering specific code
 	if len(chromeDevtoolsURL) != 0 {
 		// launch chrome instance
@@ -25,12 +29,21 @@ func main() {
 		remoteChromeCtx, remoteCtxCancel := chromedp.NewRemoteAllocator(context.Background(), chromeDevtoolsURL)
 		defer remoteCtxCancel()
 
-		chromeCtx, chromeCancel := chromedp.NewContext(remoteChromeCtx)
-		defer chromeCancel()
+		if chromeCtx, chromeCancel, err := newChromeBrowser(remoteChromeCtx); err != nil {
+			log.Printf("failed to connect to chrome, using the gg-based renderer: %v\n", err)
+		} else {
+			defer chromeCancel()
+			imageRenderer.ChromePool = newChromeRenderPool(chromeCtx, chromeTabs, chromeQueueSize, chromeRenderTimeout)
+		}
+	}
 
-		imageRenderer.ChromeCtx = chromeCtx
+	if imagePrerenderQueueSize > 0 {
+		imagePrerenderer = newImagePrerenderer(app, imageRenderer, imagePrerenderQueueSize)
 	}
 
+	registerHiddenPostHooks(app)
+	registerTenantHooks(app)
+
 	app.OnRecordAfterConfirmVerificationRequest().Add(func(e *core.RecordConfirmVerificationEvent) error {
 		return onUserVerified(app, e)
 	})
@@ -41,6 +54,23 @@ func main() {
 			return onBeforeAddMessage(app.Dao(), e)
 		case "message_replies":
 			return onBeforeAddMessageReply(app.Dao(), e)
+		case "user_details":
+			return onBeforeAddUserDetails(app.Dao(), e)
+		}
+
+		return nil
+	})
+
+	app.OnRecordBeforeUpdateRequest().Add(func(e *core.RecordUpdateEvent) error {
+		switch e.Record.Collection().Name {
+		case "user_details":
+			return checkTenantUnchanged(e)
+		case "messages":
+			keepHiddenUnchanged(e)
+			keepSendPriceUnchanged(e)
+			return checkThemeUnchanged(e)
+		case "message_replies":
+			keepHiddenUnchanged(e)
 		}
 
 		return nil
@@ -59,6 +89,24 @@ func main() {
 		return nil
 	})
 
+	app.OnRecordAfterUpdateRequest().Add(func(e *core.RecordUpdateEvent) error {
+		switch e.Record.Collection().Name {
+		case "user_details":
+			return onUpdateUserDetails(app, e)
+		}
+
+		return nil
+	})
+
+	app.OnModelBeforeUpdate().Add(func(e *core.ModelEvent) error {
+		switch e.Model.TableName() {
+		case "ranking_snapshots":
+			return errSnapshotImmutable
+		}
+
+		return nil
+	})
+
 	app.OnModelAfterCreate().Add(func(e *core.ModelEvent) error {
 		switch e.Model.TableName() {
 		case "users":
@@ -67,6 +115,26 @@ func main() {
 			return onAddWallet(app.Dao(), e)
 		case "virtual_transactions":
 			return onAddWalletTransaction(app.Dao(), e)
+		case "messages":
+			passivePrintError(onMessageSaved(e))
+		}
+
+		return nil
+	})
+
+	app.OnModelAfterUpdate().Add(func(e *core.ModelEvent) error {
+		switch e.Model.TableName() {
+		case "messages":
+			passivePrintError(onMessageUpdated(e))
+		}
+
+		return nil
+	})
+
+	app.OnModelAfterDelete().Add(func(e *core.ModelEvent) error {
+		switch e.Model.TableName() {
+		case "messages":
+			passivePrintError(onMessageSaved(e))
 		}
 
 		return nil
@@ -76,8 +144,6 @@ func main() {
 		switch e.Record.Collection().Name {
 		case "users":
 			return onRemoveUser(app.Dao(), e)
-		case "messages":
-			return onRemoveMessage(app.Dao(), e)
 		case "message_replies":
 			// NOTE: temp added
 			return onRemoveMessageReply(app.Dao(), e)
@@ -87,6 +153,11 @@ func main() {
 	})
 
 	app.OnBeforeServe().Add(setupRoutes(app))
+	app.OnBeforeServe().Add(func(e *core.ServeEvent) error {
+		go watchRankingsDrift(app, rankingsDriftCheckInterval)
+		go takeRankingSnapshots(app, rankingSnapshotInterval)
+		return nil
+	})
 
 	if err := app.Start(); err != nil {
 		log.Fatal(err)
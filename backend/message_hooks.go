@@ -1,7 +1,9 @@
 package main
 
 import (
+	"database/sql"
 	"fmt"
+	"time"
 
 	"github.com/pocketbase/dbx"
 	"github.com/pocketbase/pocketbase/apis"
@@ -22,7 +24,7 @@ func expandMessage(dao *daos.Dao, record *models.Record) error {
 
 	// fetch recipient except everyone
 	if record.GetString("recipient") != "everyone" {
-		if recipient, err := dao.FindFirstRecordByData("user_details", "student_id", record.GetString("recipient")); err == nil {
+		if recipient, err := findRecipientDetails(dao, record.GetString("tenant"), record.GetString("recipient")); err == nil {
 			dao.ExpandRecord(recipient, []string{"college_departments"}, func(relCollection *models.Collection, relIds []string) ([]*models.Record, error) {
 				return dao.FindRecordsByIds(relCollection.Name, relIds)
 			})
@@ -34,6 +36,21 @@ func expandMessage(dao *daos.Dao, record *models.Record) error {
 	return nil
 }
 
+// findRecipientDetails finds the details of the student in the tenant
+func findRecipientDetails(dao *daos.Dao, tenantId string, studentId string) (*models.Record, error) {
+	records, err := dao.FindRecordsByExpr("user_details", dbx.HashExp{
+		"student_id": studentId,
+		"tenant":     tenantId,
+	})
+	if err != nil {
+		return nil, err
+	} else if len(records) == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	return records[0], nil
+}
+
 func expandMessageReply(dao *daos.Dao, record *models.Record) error {
 	errs := dao.ExpandRecord(record, []string{"sender", "message"}, func(relCollection *models.Collection, relIds []string) ([]*models.Record, error) {
 		return dao.FindRecordsByIds(relCollection.Name, relIds)
@@ -45,12 +62,12 @@ func expandMessageReply(dao *daos.Dao, record *models.Record) error {
 	return nil
 }
 
-func updateRanking(dao *daos.Dao, recipientId string, coinsToAdd float64) error {
+func updateRanking(dao *daos.Dao, tenantId string, recipientId string, coinsToAdd float64) error {
 	if recipientId == "everyone" {
 		return nil
 	}
 
-	ranking, err := dao.FindFirstRecordByData("rankings", "recipient", recipientId)
+	ranking, err := findRanking(dao, tenantId, recipientId)
 	if err != nil {
 		collection, err := dao.FindCollectionByNameOrId("rankings")
 		if err != nil {
@@ -59,21 +76,20 @@ func updateRanking(dao *daos.Dao, recipientId string, coinsToAdd float64) error
 
 		ranking = models.NewRecord(collection)
 		ranking.Set("recipient", recipientId)
+		ranking.Set("tenant", tenantId)
+		ranking.Set("season", currentSeasonId(dao))
 		ranking.Set("college_department", "unknown")
 		ranking.Set("sex", "unknown")
 		ranking.Set("total_coins", 0)
 	}
 
 	// fetch recipient / student id
-	recipient, err := dao.FindFirstRecordByData("user_details", "student_id", recipientId)
-	if err == nil {
-		if ranking.GetString("college_department") == "unknown" && ranking.GetString("sex") == "unknown" {
-			cDept, _ := dao.FindRecordById("college_departments", recipient.GetString("college_department"))
-			ranking.Set("college_department", cDept.Id)
-			ranking.Set("sex", recipient.GetString("sex"))
-		}
+	recipient, err := findRecipientDetails(dao, tenantId, recipientId)
+	if err != nil {
+		recipient = nil
 	}
 
+	applyRecipientDetails(dao, ranking, recipient)
 	ranking.Set("total_coins", ranking.GetFloat("total_coins")+coinsToAdd)
 	return dao.SaveRecord(ranking)
 }
@@ -94,31 +110,117 @@ func computeGiftCost(record *models.Record) (totalAmount float64, remittableAmou
 	return totalAmount, remittableAmount
 }
 
+// senderStudentId reads the student id of the sender's details before the
+// record is expanded so that the rate limit is checked before anything else
+func senderStudentId(dao *daos.Dao, detailsId string) string {
+	details, err := dao.FindRecordById("user_details", detailsId)
+	if err != nil {
+		return ""
+	}
+	return details.GetString("student_id")
+}
+
 func onBeforeAddMessage(dao *daos.Dao, e *core.RecordCreateEvent) error {
+	// rejected attempts count towards the limit as well
+	if err := rateLimiter.CheckRecord(e, senderStudentId(dao, e.Record.GetString("user"))); err != nil {
+		return err
+	}
+
+	if err := checkSeasonOpen(dao, time.Now()); err != nil {
+		return err
+	}
+	e.Record.Set("season", currentSeasonId(dao))
+
+	tenant := tenantFromContext(e.HttpContext)
+	e.Record.Set("tenant", tenantId(tenant))
+	if recipientId := e.Record.GetString("recipient"); recipientId != "everyone" {
+		if err := checkStudentId(tenant, recipientId); err != nil {
+			return err
+		}
+	}
+
 	// to avoid spams
 	if r, err := dao.FindRecordsByExpr(
 		e.Record.Collection().Name,
 		dbx.HashExp{
 			"content":   e.Record.GetString("content"),
 			"recipient": e.Record.GetString("recipient"),
+			"tenant":    tenantId(tenant),
 		},
 	); err == nil && len(r) != 0 {
 		return apis.NewBadRequestError(
 			"You have posted a similar message to a similar recipient.", nil)
 	}
 
-	// check profanity content
-	if err := checkProfanity(e.Record.GetString("content")); err != nil {
-		return err.ToApiError()
+	// catch near-duplicates and bursts of the same content
+	if err := checkSpam(dao, e.Record); err != nil {
+		return err
+	}
+
+	// check profanity and personal information
+	content, moderationErr := moderateContent(e.Record.GetString("content"))
+	if moderationErr != nil {
+		return moderationErr.ToApiError()
 	}
+	e.Record.Set("content", content)
 
 	if err := expandMessage(dao, e.Record); err != nil {
 		return err
 	}
 
+	theme, err := findImageTheme(e.Record.GetString("theme"))
+	if err != nil {
+		return apis.NewBadRequestError(err.Error(), nil)
+	}
+	e.Record.Set("theme", theme.ID)
+
 	totalAmount, _ := computeGiftCost(e.Record)
 	user := e.Record.Expand()["user"].(*models.Record)
-	return checkSufficientFunds(dao, user.GetString("user"), sendPrice+totalAmount)
+	sanctions := findUserSanctions(dao, user.Id)
+	if err := checkSendSanctions(sanctions, false); err != nil {
+		return err
+	}
+
+	// posts of shadow-banned users are only shown to themselves
+	e.Record.Set("hidden", isShadowBanned(sanctions))
+
+	if user.GetString("tenant") != tenantId(tenant) {
+		return apis.NewForbiddenError("You can only send messages to your own campus.", nil)
+	}
+
+	// the price is kept with the message so that the rankings are not
+	// recomputed with a price the sender did not pay
+	e.Record.Set("send_price", tenantSendPrice(tenant))
+
+	return checkSufficientFunds(dao, user.GetString("user"), e.Record.GetFloat("send_price")+totalAmount+theme.Price)
+}
+
+// checkThemeUnchanged keeps the sender from switching to a premium theme
+// after sending since the price of the theme is only charged on create.
+func checkThemeUnchanged(e *core.RecordUpdateEvent) error {
+	if e.HttpContext != nil {
+		if admin, _ := e.HttpContext.Get(apis.ContextAdminKey).(*models.Admin); admin != nil {
+			return nil
+		}
+	}
+
+	if messageImageTheme(e.Record).ID != messageImageTheme(e.Record.OriginalCopy()).ID {
+		return apis.NewForbiddenError("The theme of a sent message can not be changed.", nil)
+	}
+
+	return nil
+}
+
+// keepSendPriceUnchanged keeps the sender from changing the price their
+// message counts for in the rankings
+func keepSendPriceUnchanged(e *core.RecordUpdateEvent) {
+	if e.HttpContext != nil {
+		if admin, _ := e.HttpContext.Get(apis.ContextAdminKey).(*models.Admin); admin != nil {
+			return
+		}
+	}
+
+	e.Record.Set("send_price", e.Record.OriginalCopy().GetFloat("send_price"))
 }
 
 func onAddMessage(app core.App, e *core.RecordCreateEvent) error {
@@ -134,13 +236,24 @@ func onAddMessage(app core.App, e *core.RecordCreateEvent) error {
 		return err
 	}
 
+	// the rankings are already updated by the time the request hooks run
+	// (see onMessageSaved)
 	studentId := e.Record.GetString("recipient")
-	if err := updateRanking(dao, studentId, totalAmount+sendPrice); err != nil {
-		passivePrintError(err)
-		return nil
+	tenantId := e.Record.GetString("tenant")
+	price := e.Record.GetFloat("send_price")
+
+	// hidden posts of shadow-banned senders are still paid for so that
+	// nothing looks off to them, but they do not reach the recipient
+	hidden := isHiddenPost(dao, e.Record)
+	if !hidden {
+		if rankingScoring.ExcludeSelfSends && isSelfSend(e.Record) {
+			passivePrintError(queueSelfSend(dao, user.Id, e.Record))
+		} else {
+			passivePrintError(flagSuspiciousContributions(dao, tenantId, studentId))
+		}
 	}
 
-	if err := createTransaction(dao, wallet.Id, -sendPrice, fmt.Sprintf("Send message to %s", studentId)); err != nil {
+	if err := createTransaction(dao, wallet.Id, -price, fmt.Sprintf("Send message to %s", studentId)); err != nil {
 		return err
 	}
 
@@ -152,15 +265,26 @@ func onAddMessage(app core.App, e *core.RecordCreateEvent) error {
 		}
 	}
 
-	if isRecipientAccessible && remittableAmount != 0 {
+	// themes are not counted in the rankings since they only change how
+	// the message looks
+	if theme := messageImageTheme(e.Record); theme.IsPremium() {
+		if err := createTransaction(dao,
+			wallet.Id, -theme.Price,
+			fmt.Sprintf("Used the %s theme for %s", theme.Label, studentId)); err != nil {
+			passivePrintError(err)
+		}
+	}
+
+	if isRecipientAccessible && !hidden && remittableAmount != 0 {
 		if err := createTransactionFromUser(dao, recipient.GetString("user"),
 			remittableAmount, fmt.Sprintf("Gift message from message %s", e.Record.Id)); err != nil {
 			passivePrintError(err)
 		}
 	}
 
-	// send email
-	if isRecipientAccessible {
+	// send email. posts from shadow-banned users are only visible to
+	// themselves so the recipient should not be notified.
+	if isRecipientAccessible && !hidden {
 		if msg, err := emailTemplates.message.With(map[string]any{
 			"Email":      recipient.GetString("email"),
 			"MessageURL": fmt.Sprintf("%s/wall/%s/%s", frontendUrl, studentId, e.Record.Id),
@@ -173,24 +297,85 @@ func onAddMessage(app core.App, e *core.RecordCreateEvent) error {
 	user.Set("last_active", types.DateTime{})
 	passivePrintError(dao.SaveRecord(user))
 
+	// render the share images before the crawlers ask for them
+	if imagePrerenderer != nil {
+		passivePrintError(imagePrerenderer.Enqueue(e.Record.Id))
+	}
+
 	return nil
 }
 
-func onRemoveMessage(dao *daos.Dao, e *core.RecordDeleteEvent) error {
-	expandMessage(dao, e.Record)
+// onMessageSaved recomputes the ranking of the recipient and their bucket
+// for the day the message was sent. it is bound to the model hooks so that
+// messages saved or deleted outside of the api are counted as well. a
+// failed update should not fail the save since the drift check will catch
+// it and `rankings rebuild` can fix it afterwards.
+func onMessageSaved(e *core.ModelEvent) error {
+	message, ok := e.Model.(*models.Record)
+	if !ok {
+		return nil
+	}
 
-	// deduct total_cost
-	ranking, err := dao.FindFirstRecordByData("rankings", "recipient", e.Record.GetString("recipient"))
-	if err != nil {
-		passivePrintError(err)
+	// new hidden posts are left out so that no ranking is created for
+	// them. a deleted one can be recomputed since it is gone already.
+	if message.GetBool("hidden") || isHiddenPost(e.Dao, message) {
 		return nil
 	}
 
-	totalAmount, _ := computeGiftCost(e.Record)
-	ranking.Set("total_coins", ranking.GetFloat("total_coins")-totalAmount)
-	passivePrintError(dao.SaveRecord(ranking))
+	return recomputeMessageRankings(e.Dao, message)
+}
 
-	return nil
+// rankedMessageFields are the fields of a message that change the rankings
+// when updated
+var rankedMessageFields = []string{"tenant", "season", "recipient", "gifts", "send_price"}
+
+// onMessageUpdated recomputes the rankings when a message is hidden,
+// revealed or moved to another recipient. the previous recipient is
+// recomputed as well so that the coins do not stay on their ranking.
+func onMessageUpdated(e *core.ModelEvent) error {
+	message, ok := e.Model.(*models.Record)
+	if !ok {
+		return nil
+	}
+
+	// the record is concealed by now so whether it is hidden is read from
+	// the database
+	original := message.OriginalCopy()
+	changed := original.GetBool("hidden") != isHiddenPost(e.Dao, message)
+	for _, field := range rankedMessageFields {
+		if fmt.Sprint(original.Get(field)) != fmt.Sprint(message.Get(field)) {
+			changed = true
+			break
+		}
+	}
+
+	if !changed {
+		return nil
+	}
+
+	if err := recomputeMessageRankings(e.Dao, message); err != nil {
+		return err
+	}
+
+	if original.GetString("tenant") == message.GetString("tenant") && original.GetString("recipient") == message.GetString("recipient") {
+		return nil
+	}
+
+	return recomputeMessageRankings(e.Dao, original)
+}
+
+func recomputeMessageRankings(dao *daos.Dao, message *models.Record) error {
+	tenantId := message.GetString("tenant")
+	recipientId := message.GetString("recipient")
+	defer invalidateDepartmentLeaderboard()
+
+	return dao.RunInTransaction(func(txDao *daos.Dao) error {
+		if err := recomputeRanking(txDao, tenantId, recipientId); err != nil {
+			return err
+		}
+
+		return recomputeRankingBucket(txDao, tenantId, recipientId, message.Created.Time())
+	})
 }
 
 func onAddMessageReply(app core.App, e *core.RecordCreateEvent) error {
@@ -204,8 +389,15 @@ func onAddMessageReply(app core.App, e *core.RecordCreateEvent) error {
 		passivePrintError(dao.SaveRecord(user))
 	}
 
+	price := sendPrice
 	msg, msgOk := e.Record.Expand()["message"].(*models.Record)
 	if msgOk {
+		price = tenantSendPrice(findTenant(dao, msg.GetString("tenant")))
+	}
+
+	// hidden replies of shadow-banned senders are left out of the count
+	// and the recipient is not notified
+	if msgOk && !isHiddenPost(dao, e.Record) {
 		msg.Set("replies_count", msg.GetInt("replies_count")+1)
 		passivePrintError(dao.SaveRecord(msg))
 		expandMessage(dao, msg)
@@ -221,14 +413,14 @@ func onAddMessageReply(app core.App, e *core.RecordCreateEvent) error {
 		}
 	}
 
-	return createTransactionFromUser(dao, user.GetString("user"), -sendPrice, fmt.Sprintf("Reply message %s", e.Record.Id))
+	return createTransactionFromUser(dao, user.GetString("user"), -price, fmt.Sprintf("Reply message %s", e.Record.Id))
 }
 
 func onRemoveMessageReply(dao *daos.Dao, e *core.RecordDeleteEvent) error {
 	expandMessageReply(dao, e.Record)
 
 	msg, msgOk := e.Record.Expand()["message"].(*models.Record)
-	if msgOk {
+	if msgOk && !e.Record.GetBool("hidden") {
 		msg.Set("replies_count", msg.GetInt("replies_count")-1)
 		passivePrintError(dao.SaveRecord(msg))
 	}
@@ -237,15 +429,36 @@ func onRemoveMessageReply(dao *daos.Dao, e *core.RecordDeleteEvent) error {
 }
 
 func onBeforeAddMessageReply(dao *daos.Dao, e *core.RecordCreateEvent) error {
-	// check profanity content
-	if err := checkProfanity(e.Record.GetString("content")); err != nil {
-		return err.ToApiError()
+	if err := rateLimiter.CheckRecord(e, senderStudentId(dao, e.Record.GetString("sender"))); err != nil {
+		return err
+	}
+
+	if err := checkSeasonOpen(dao, time.Now()); err != nil {
+		return err
+	}
+
+	// check profanity and personal information
+	content, moderationErr := moderateContent(e.Record.GetString("content"))
+	if moderationErr != nil {
+		return moderationErr.ToApiError()
 	}
+	e.Record.Set("content", content)
 
 	if err := expandMessageReply(dao, e.Record); err != nil {
 		return err
 	}
 
 	sender := e.Record.Expand()["sender"].(*models.Record)
-	return checkSufficientFunds(dao, sender.GetString("user"), sendPrice)
+	sanctions := findUserSanctions(dao, sender.Id)
+	if err := checkSendSanctions(sanctions, true); err != nil {
+		return err
+	}
+	e.Record.Set("hidden", isShadowBanned(sanctions))
+
+	price := sendPrice
+	if msg, ok := e.Record.Expand()["message"].(*models.Record); ok {
+		price = tenantSendPrice(findTenant(dao, msg.GetString("tenant")))
+	}
+
+	return checkSufficientFunds(dao, sender.GetString("user"), price)
 }
@@ -72,7 +72,7 @@ func TestUpdateRanking(t *testing.T) {
 	recipientId := "202012345678"
 	coinsToAdd := 150.0
 	
-	err := updateRanking(app.Dao(), recipientId, coinsToAdd)
+	err := updateRanking(app.Dao(), defaultTenant, recipientId, coinsToAdd)
 	if err != nil {
 		t.Errorf("updateRanking failed: %v", err)
 	}
@@ -175,6 +175,32 @@ func TestOnBeforeAddMessage_InsufficientFunds(t *testing.T) {
 	}
 }
 
+func TestCheckThemeUnchanged(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Cleanup()
+
+	message := saveTestMessage(t, app, "user1", "everyone", "Happy valentines!")
+	message.Set("theme", "classic")
+	if err := app.Dao().SaveRecord(message); err != nil {
+		t.Fatal(err)
+	}
+
+	sent, err := app.Dao().FindRecordById("messages", message.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sent.Set("content", "Happy valentines!!")
+	if err := checkThemeUnchanged(&core.RecordUpdateEvent{Record: sent}); err != nil {
+		t.Errorf("Expected other fields to be editable, got %v", err)
+	}
+
+	sent.Set("theme", "midnight")
+	if err := checkThemeUnchanged(&core.RecordUpdateEvent{Record: sent}); err == nil {
+		t.Error("Expected switching to a premium theme to be rejected, got nil")
+	}
+}
+
 func TestOnAddMessageReply_RepliesCountIncremented(t *testing.T) {
 	app := newTestApp(t)
 	defer app.Cleanup()
@@ -236,6 +262,57 @@ func TestOnAddMessageReply_RepliesCountIncremented(t *testing.T) {
 	}
 }
 
+func TestOnAddMessageReply_HiddenReplyNotCounted(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Cleanup()
+
+	dao := app.Dao()
+
+	userCollection, _ := dao.FindCollectionByNameOrId("users")
+	authUser := models.NewRecord(userCollection)
+	dao.SaveRecord(authUser)
+
+	userDetailsCollection, _ := dao.FindCollectionByNameOrId("user_details")
+	senderDetails := models.NewRecord(userDetailsCollection)
+	senderDetails.Set("user", authUser.Id)
+	senderDetails.Set("student_id", "202099990001")
+	dao.SaveRecord(senderDetails)
+
+	walletCollection, _ := dao.FindCollectionByNameOrId("virtual_wallets")
+	senderWallet := models.NewRecord(walletCollection)
+	senderWallet.Set("user", authUser.Id)
+	senderWallet.Set("balance", 1000.0)
+	dao.SaveRecord(senderWallet)
+
+	messageCollection, _ := dao.FindCollectionByNameOrId("messages")
+	message := models.NewRecord(messageCollection)
+	message.Set("content", "Original message")
+	message.Set("recipient", "everyone")
+	dao.SaveRecord(message)
+
+	// a reply of a shadow-banned sender
+	replyCollection, _ := dao.FindCollectionByNameOrId("message_replies")
+	reply := models.NewRecord(replyCollection)
+	reply.Set("content", "This is a reply")
+	reply.Set("sender", senderDetails.Id)
+	reply.Set("message", message.Id)
+	reply.Set("hidden", true)
+	dao.SaveRecord(reply)
+
+	if err := onAddMessageReply(app, &core.RecordCreateEvent{Record: reply}); err != nil {
+		t.Fatalf("onAddMessageReply failed: %v", err)
+	}
+
+	updatedMsg, err := dao.FindRecordById("messages", message.Id)
+	if err != nil {
+		t.Fatalf("Failed to find updated message: %v", err)
+	}
+
+	if updatedMsg.GetInt("replies_count") != 0 {
+		t.Errorf("Expected hidden reply not to be counted, got %d", updatedMsg.GetInt("replies_count"))
+	}
+}
+
 func TestOnRemoveMessageReply_RepliesCountDecremented(t *testing.T) {
 	app := newTestApp(t)
 	defer app.Cleanup()
@@ -0,0 +1,135 @@
+package migrations
+
+import (
+	"encoding/json"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/models/schema"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		userDetails, err := dao.FindCollectionByNameOrId("px00yjig95x0mcw")
+		if err != nil {
+			return err
+		}
+
+		// add
+		for _, rawField := range []string{
+			`{
+				"system": false,
+				"id": "snbn7u2k",
+				"name": "send_banned_until",
+				"type": "date",
+				"required": false,
+				"unique": false,
+				"options": {
+					"min": "",
+					"max": ""
+				}
+			}`,
+			`{
+				"system": false,
+				"id": "rplo4m9x",
+				"name": "reply_only_until",
+				"type": "date",
+				"required": false,
+				"unique": false,
+				"options": {
+					"min": "",
+					"max": ""
+				}
+			}`,
+			`{
+				"system": false,
+				"id": "shbn3q8w",
+				"name": "shadow_banned_until",
+				"type": "date",
+				"required": false,
+				"unique": false,
+				"options": {
+					"min": "",
+					"max": ""
+				}
+			}`,
+		} {
+			newField := &schema.SchemaField{}
+			json.Unmarshal([]byte(rawField), newField)
+			userDetails.Schema.AddField(newField)
+		}
+
+		if err := dao.SaveCollection(userDetails); err != nil {
+			return err
+		}
+
+		// hide shadow-banned posts from everyone except their author
+		messages, err := dao.FindCollectionByNameOrId("caqiysan7yf0wve")
+		if err != nil {
+			return err
+		}
+
+		messages.ListRule = types.Pointer("(user.shadow_banned_until = \"\" || user.shadow_banned_until < @now || @request.auth.details.id = user.id) && (gifts:length = 0 || recipient = \"everyone\" || (@request.auth.details.id = user.id || @request.auth.details.student_id = recipient))")
+
+		messages.ViewRule = types.Pointer("(user.shadow_banned_until = \"\" || user.shadow_banned_until < @now || @request.auth.details.id = user.id) && (gifts:length = 0 || recipient = \"everyone\" || (@request.auth.details.id = user.id || @request.auth.details.student_id = recipient))")
+
+		if err := dao.SaveCollection(messages); err != nil {
+			return err
+		}
+
+		replies, err := dao.FindCollectionByNameOrId("35mnuyxwxc8xvs6")
+		if err != nil {
+			return err
+		}
+
+		replies.ListRule = types.Pointer("(sender.shadow_banned_until = \"\" || sender.shadow_banned_until < @now || @request.auth.details.id = sender.id) && (message.recipient = \"everyone\" || @request.auth.details.id = message.user.id || @request.auth.details.id = sender.id)")
+
+		replies.ViewRule = types.Pointer("(sender.shadow_banned_until = \"\" || sender.shadow_banned_until < @now || @request.auth.details.id = sender.id) && (message.recipient = \"everyone\" || @request.auth.details.id = message.user.id || @request.auth.details.id = sender.id)")
+
+		return dao.SaveCollection(replies)
+	}, func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		replies, err := dao.FindCollectionByNameOrId("35mnuyxwxc8xvs6")
+		if err != nil {
+			return err
+		}
+
+		replies.ListRule = types.Pointer("message.recipient = \"everyone\" || @request.auth.details.id = message.user.id || @request.auth.details.id = sender.id")
+
+		replies.ViewRule = types.Pointer("message.recipient = \"everyone\" || @request.auth.details.id = message.user.id || @request.auth.details.id = sender.id")
+
+		if err := dao.SaveCollection(replies); err != nil {
+			return err
+		}
+
+		messages, err := dao.FindCollectionByNameOrId("caqiysan7yf0wve")
+		if err != nil {
+			return err
+		}
+
+		messages.ListRule = types.Pointer("gifts:length = 0 || recipient = \"everyone\" || (@request.auth.details.id = user.id || @request.auth.details.student_id = recipient)")
+
+		messages.ViewRule = types.Pointer("gifts:length = 0 || recipient = \"everyone\" || (@request.auth.details.id = user.id || @request.auth.details.student_id = recipient)")
+
+		if err := dao.SaveCollection(messages); err != nil {
+			return err
+		}
+
+		userDetails, err := dao.FindCollectionByNameOrId("px00yjig95x0mcw")
+		if err != nil {
+			return err
+		}
+
+		// remove
+		userDetails.Schema.RemoveField("snbn7u2k")
+		userDetails.Schema.RemoveField("rplo4m9x")
+		userDetails.Schema.RemoveField("shbn3q8w")
+
+		return dao.SaveCollection(userDetails)
+	})
+}
@@ -0,0 +1,133 @@
+package migrations
+
+import (
+	"encoding/json"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/models"
+)
+
+func init() {
+	m.Register(func(db dbx.Builder) error {
+		jsonData := `{
+			"id": "mdq5x2r8vbt0kzc",
+			"created": "2023-02-13 08:00:00.000Z",
+			"updated": "2023-02-13 08:00:00.000Z",
+			"name": "moderation_queue",
+			"type": "base",
+			"system": false,
+			"schema": [
+				{
+					"system": false,
+					"id": "mq7usr01",
+					"name": "user",
+					"type": "relation",
+					"required": false,
+					"unique": false,
+					"options": {
+						"maxSelect": 1,
+						"collectionId": "px00yjig95x0mcw",
+						"cascadeDelete": true
+					}
+				},
+				{
+					"system": false,
+					"id": "mq7col02",
+					"name": "collection",
+					"type": "text",
+					"required": true,
+					"unique": false,
+					"options": {
+						"min": null,
+						"max": null,
+						"pattern": ""
+					}
+				},
+				{
+					"system": false,
+					"id": "mq7rec03",
+					"name": "record",
+					"type": "text",
+					"required": false,
+					"unique": false,
+					"options": {
+						"min": null,
+						"max": null,
+						"pattern": ""
+					}
+				},
+				{
+					"system": false,
+					"id": "mq7rsn04",
+					"name": "reason",
+					"type": "text",
+					"required": true,
+					"unique": false,
+					"options": {
+						"min": null,
+						"max": null,
+						"pattern": ""
+					}
+				},
+				{
+					"system": false,
+					"id": "mq7pld05",
+					"name": "payload",
+					"type": "json",
+					"required": false,
+					"unique": false,
+					"options": {}
+				},
+				{
+					"system": false,
+					"id": "mq7det06",
+					"name": "details",
+					"type": "json",
+					"required": false,
+					"unique": false,
+					"options": {}
+				},
+				{
+					"system": false,
+					"id": "mq7sts07",
+					"name": "status",
+					"type": "select",
+					"required": true,
+					"unique": false,
+					"options": {
+						"maxSelect": 1,
+						"values": [
+							"pending",
+							"approved",
+							"rejected"
+						]
+					}
+				}
+			],
+			"listRule": null,
+			"viewRule": null,
+			"createRule": null,
+			"updateRule": null,
+			"deleteRule": null,
+			"options": {}
+		}`
+
+		collection := &models.Collection{}
+		if err := json.Unmarshal([]byte(jsonData), &collection); err != nil {
+			return err
+		}
+
+		return daos.New(db).SaveCollection(collection)
+	}, func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		collection, err := dao.FindCollectionByNameOrId("mdq5x2r8vbt0kzc")
+		if err != nil {
+			return err
+		}
+
+		return dao.DeleteCollection(collection)
+	})
+}
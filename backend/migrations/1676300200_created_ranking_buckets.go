@@ -0,0 +1,123 @@
+package migrations
+
+import (
+	"encoding/json"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/models"
+)
+
+func init() {
+	m.Register(func(db dbx.Builder) error {
+		jsonData := `{
+			"id": "rkb8d1y4q7w2m0s",
+			"created": "2023-02-13 08:10:00.000Z",
+			"updated": "2023-02-13 08:10:00.000Z",
+			"name": "ranking_buckets",
+			"type": "base",
+			"system": false,
+			"schema": [
+				{
+					"system": false,
+					"id": "rkbrcp01",
+					"name": "recipient",
+					"type": "text",
+					"required": true,
+					"unique": false,
+					"options": {
+						"min": null,
+						"max": null,
+						"pattern": ""
+					}
+				},
+				{
+					"system": false,
+					"id": "rkbday02",
+					"name": "day",
+					"type": "text",
+					"required": true,
+					"unique": false,
+					"options": {
+						"min": null,
+						"max": null,
+						"pattern": "^\\d{4}-\\d{2}-\\d{2}$"
+					}
+				},
+				{
+					"system": false,
+					"id": "rkbcns03",
+					"name": "total_coins",
+					"type": "number",
+					"required": false,
+					"unique": false,
+					"options": {
+						"min": null,
+						"max": null
+					}
+				},
+				{
+					"system": false,
+					"id": "rkbmsg04",
+					"name": "messages_count",
+					"type": "number",
+					"required": false,
+					"unique": false,
+					"options": {
+						"min": null,
+						"max": null
+					}
+				}
+			],
+			"listRule": null,
+			"viewRule": null,
+			"createRule": null,
+			"updateRule": null,
+			"deleteRule": null,
+			"options": {}
+		}`
+
+		collection := &models.Collection{}
+		if err := json.Unmarshal([]byte(jsonData), &collection); err != nil {
+			return err
+		}
+
+		dao := daos.New(db)
+		if err := dao.SaveCollection(collection); err != nil {
+			return err
+		}
+
+		if _, err := db.NewQuery("CREATE UNIQUE INDEX IF NOT EXISTS idx_ranking_buckets_recipient_day ON ranking_buckets (recipient, day)").Execute(); err != nil {
+			return err
+		}
+
+		// backfill the buckets from the existing messages. days are in
+		// philippine time and the send price is the one used in 2023 (150).
+		_, err := db.NewQuery(`
+			INSERT INTO ranking_buckets (id, created, updated, recipient, day, total_coins, messages_count)
+			SELECT substr(lower(hex(randomblob(8))), 1, 15),
+				strftime('%Y-%m-%d %H:%M:%fZ', 'now'),
+				strftime('%Y-%m-%d %H:%M:%fZ', 'now'),
+				m.recipient,
+				date(m.created, '+8 hours'),
+				COUNT(DISTINCT m.id) * 150 + COALESCE(SUM(g.price), 0),
+				COUNT(DISTINCT m.id)
+			FROM messages m
+			LEFT JOIN json_each(CASE WHEN json_valid(m.gifts) THEN m.gifts ELSE '[]' END) mg
+			LEFT JOIN gifts g ON g.id = mg.value
+			WHERE m.recipient != 'everyone'
+			GROUP BY m.recipient, date(m.created, '+8 hours')
+		`).Execute()
+		return err
+	}, func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		collection, err := dao.FindCollectionByNameOrId("rkb8d1y4q7w2m0s")
+		if err != nil {
+			return err
+		}
+
+		return dao.DeleteCollection(collection)
+	})
+}
@@ -0,0 +1,100 @@
+package migrations
+
+import (
+	"encoding/json"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/models/schema"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		userDetails, err := dao.FindCollectionByNameOrId("px00yjig95x0mcw")
+		if err != nil {
+			return err
+		}
+
+		// add
+		new_hide_from_leaderboards := &schema.SchemaField{}
+		json.Unmarshal([]byte(`{
+			"system": false,
+			"id": "hdlb6v2n",
+			"name": "hide_from_leaderboards",
+			"type": "bool",
+			"required": false,
+			"unique": false,
+			"options": {}
+		}`), new_hide_from_leaderboards)
+		userDetails.Schema.AddField(new_hide_from_leaderboards)
+
+		if err := dao.SaveCollection(userDetails); err != nil {
+			return err
+		}
+
+		rankings, err := dao.FindCollectionByNameOrId("ocpdx07v34h97tx")
+		if err != nil {
+			return err
+		}
+
+		// add
+		new_hidden := &schema.SchemaField{}
+		json.Unmarshal([]byte(`{
+			"system": false,
+			"id": "rkhd9c3e",
+			"name": "hidden",
+			"type": "bool",
+			"required": false,
+			"unique": false,
+			"options": {}
+		}`), new_hidden)
+		rankings.Schema.AddField(new_hidden)
+
+		rankings.ListRule = types.Pointer("hidden = false")
+		rankings.ViewRule = types.Pointer("hidden = false")
+
+		if err := dao.SaveCollection(rankings); err != nil {
+			return err
+		}
+
+		// unregistered recipients are hidden by default
+		_, err = db.NewQuery(`
+			UPDATE rankings SET hidden = NOT EXISTS (
+				SELECT 1 FROM user_details ud
+				WHERE ud.student_id = rankings.recipient AND ud.hide_from_leaderboards = FALSE
+			)
+		`).Execute()
+		return err
+	}, func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		rankings, err := dao.FindCollectionByNameOrId("ocpdx07v34h97tx")
+		if err != nil {
+			return err
+		}
+
+		// remove
+		rankings.Schema.RemoveField("rkhd9c3e")
+
+		rankings.ListRule = types.Pointer("")
+		rankings.ViewRule = types.Pointer("")
+
+		if err := dao.SaveCollection(rankings); err != nil {
+			return err
+		}
+
+		userDetails, err := dao.FindCollectionByNameOrId("px00yjig95x0mcw")
+		if err != nil {
+			return err
+		}
+
+		// remove
+		userDetails.Schema.RemoveField("hdlb6v2n")
+
+		return dao.SaveCollection(userDetails)
+	})
+}
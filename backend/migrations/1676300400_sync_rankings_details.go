@@ -0,0 +1,29 @@
+package migrations
+
+import (
+	"github.com/pocketbase/dbx"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(db dbx.Builder) error {
+		// relink the rankings of registered students with their current
+		// department and sex
+		_, err := db.NewQuery(`
+			UPDATE rankings SET
+				college_department = COALESCE((
+					SELECT d.id FROM user_details ud
+					INNER JOIN college_departments d ON d.id = ud.college_department
+					WHERE ud.student_id = rankings.recipient
+				), 'unknown'),
+				sex = COALESCE((
+					SELECT NULLIF(ud.sex, '') FROM user_details ud
+					WHERE ud.student_id = rankings.recipient
+				), 'unknown')
+			WHERE EXISTS (SELECT 1 FROM user_details ud WHERE ud.student_id = rankings.recipient)
+		`).Execute()
+		return err
+	}, func(db dbx.Builder) error {
+		return nil
+	})
+}
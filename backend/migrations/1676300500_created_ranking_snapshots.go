@@ -0,0 +1,81 @@
+package migrations
+
+import (
+	"encoding/json"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/models"
+)
+
+func init() {
+	m.Register(func(db dbx.Builder) error {
+		jsonData := `{
+			"id": "rks3n7c1x5v9b2h",
+			"created": "2023-02-13 08:20:00.000Z",
+			"updated": "2023-02-13 08:20:00.000Z",
+			"name": "ranking_snapshots",
+			"type": "base",
+			"system": false,
+			"schema": [
+				{
+					"system": false,
+					"id": "rkssea01",
+					"name": "season",
+					"type": "text",
+					"required": true,
+					"unique": false,
+					"options": {
+						"min": null,
+						"max": null,
+						"pattern": ""
+					}
+				},
+				{
+					"system": false,
+					"id": "rkstkn02",
+					"name": "taken_at",
+					"type": "date",
+					"required": true,
+					"unique": false,
+					"options": {
+						"min": "",
+						"max": ""
+					}
+				},
+				{
+					"system": false,
+					"id": "rksent03",
+					"name": "entries",
+					"type": "json",
+					"required": false,
+					"unique": false,
+					"options": {}
+				}
+			],
+			"listRule": "",
+			"viewRule": "",
+			"createRule": null,
+			"updateRule": null,
+			"deleteRule": null,
+			"options": {}
+		}`
+
+		collection := &models.Collection{}
+		if err := json.Unmarshal([]byte(jsonData), &collection); err != nil {
+			return err
+		}
+
+		return daos.New(db).SaveCollection(collection)
+	}, func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		collection, err := dao.FindCollectionByNameOrId("rks3n7c1x5v9b2h")
+		if err != nil {
+			return err
+		}
+
+		return dao.DeleteCollection(collection)
+	})
+}
@@ -0,0 +1,181 @@
+package migrations
+
+import (
+	"encoding/json"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/models/schema"
+)
+
+func init() {
+	m.Register(func(db dbx.Builder) error {
+		jsonData := `{
+			"id": "ssn4q8w2e6r0t1y",
+			"created": "2023-02-13 08:30:00.000Z",
+			"updated": "2023-02-13 08:30:00.000Z",
+			"name": "seasons",
+			"type": "base",
+			"system": false,
+			"schema": [
+				{
+					"system": false,
+					"id": "ssnuid01",
+					"name": "uid",
+					"type": "text",
+					"required": true,
+					"unique": true,
+					"options": {
+						"min": null,
+						"max": null,
+						"pattern": ""
+					}
+				},
+				{
+					"system": false,
+					"id": "ssnnam02",
+					"name": "name",
+					"type": "text",
+					"required": true,
+					"unique": false,
+					"options": {
+						"min": null,
+						"max": null,
+						"pattern": ""
+					}
+				},
+				{
+					"system": false,
+					"id": "ssnsta03",
+					"name": "starts_at",
+					"type": "date",
+					"required": true,
+					"unique": false,
+					"options": {
+						"min": "",
+						"max": ""
+					}
+				},
+				{
+					"system": false,
+					"id": "ssnend04",
+					"name": "ends_at",
+					"type": "date",
+					"required": false,
+					"unique": false,
+					"options": {
+						"min": "",
+						"max": ""
+					}
+				},
+				{
+					"system": false,
+					"id": "ssnarc05",
+					"name": "archived",
+					"type": "bool",
+					"required": false,
+					"unique": false,
+					"options": {}
+				}
+			],
+			"listRule": "",
+			"viewRule": "",
+			"createRule": null,
+			"updateRule": null,
+			"deleteRule": null,
+			"options": {}
+		}`
+
+		collection := &models.Collection{}
+		if err := json.Unmarshal([]byte(jsonData), &collection); err != nil {
+			return err
+		}
+
+		dao := daos.New(db)
+		if err := dao.SaveCollection(collection); err != nil {
+			return err
+		}
+
+		// tag the existing records with the first season
+		for _, target := range []struct {
+			collectionId string
+			fieldId      string
+		}{
+			{"caqiysan7yf0wve", "msgssn01"},
+			{"ocpdx07v34h97tx", "rnkssn01"},
+			{"rs07r3dxff0hxbz", "wltssn01"},
+		} {
+			targetCollection, err := dao.FindCollectionByNameOrId(target.collectionId)
+			if err != nil {
+				return err
+			}
+
+			new_season := &schema.SchemaField{}
+			json.Unmarshal([]byte(`{
+				"system": false,
+				"id": "`+target.fieldId+`",
+				"name": "season",
+				"type": "text",
+				"required": false,
+				"unique": false,
+				"options": {
+					"min": null,
+					"max": null,
+					"pattern": ""
+				}
+			}`), new_season)
+			targetCollection.Schema.AddField(new_season)
+
+			if err := dao.SaveCollection(targetCollection); err != nil {
+				return err
+			}
+
+			if _, err := db.Update(targetCollection.Name, dbx.Params{"season": "2023"}, nil).Execute(); err != nil {
+				return err
+			}
+		}
+
+		// the first season is left open-ended so that the wall keeps
+		// working until the admins set its end.
+		_, err := db.NewQuery(`
+			INSERT INTO seasons (id, created, updated, uid, name, starts_at, ends_at, archived)
+			VALUES ('ssn2023valentin',
+				strftime('%Y-%m-%d %H:%M:%fZ', 'now'),
+				strftime('%Y-%m-%d %H:%M:%fZ', 'now'),
+				'2023', 'UIC Valentine Wall 2023', '2023-01-31 16:00:00.000Z', '', FALSE)
+		`).Execute()
+		return err
+	}, func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		for _, target := range []struct {
+			collectionId string
+			fieldId      string
+		}{
+			{"caqiysan7yf0wve", "msgssn01"},
+			{"ocpdx07v34h97tx", "rnkssn01"},
+			{"rs07r3dxff0hxbz", "wltssn01"},
+		} {
+			targetCollection, err := dao.FindCollectionByNameOrId(target.collectionId)
+			if err != nil {
+				return err
+			}
+
+			// remove
+			targetCollection.Schema.RemoveField(target.fieldId)
+
+			if err := dao.SaveCollection(targetCollection); err != nil {
+				return err
+			}
+		}
+
+		collection, err := dao.FindCollectionByNameOrId("ssn4q8w2e6r0t1y")
+		if err != nil {
+			return err
+		}
+
+		return dao.DeleteCollection(collection)
+	})
+}
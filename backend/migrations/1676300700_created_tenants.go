@@ -0,0 +1,325 @@
+package migrations
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/models/schema"
+)
+
+var tenantScopedCollections = []struct {
+	collectionId string
+	fieldId      string
+}{
+	{"caqiysan7yf0wve", "msgtnt01"},
+	{"ocpdx07v34h97tx", "rnktnt01"},
+	{"rkb8d1y4q7w2m0s", "rkbtnt05"},
+	{"rks3n7c1x5v9b2h", "rkstnt04"},
+	{"rs07r3dxff0hxbz", "wlttnt01"},
+	{"px00yjig95x0mcw", "udttnt01"},
+	{"yhv9suo8ru0esf0", "cdptnt01"},
+}
+
+// defaultTenantUid follows the DEFAULT_TENANT setting of the server since
+// the migrations can not read its config
+func defaultTenantUid() string {
+	if uid, exists := os.LookupEnv("DEFAULT_TENANT"); exists {
+		return uid
+	}
+	return "uic"
+}
+
+func init() {
+	m.Register(func(db dbx.Builder) error {
+		jsonData := `{
+			"id": "tnt7h3k9m1p5s2d",
+			"created": "2023-02-13 08:40:00.000Z",
+			"updated": "2023-02-13 08:40:00.000Z",
+			"name": "tenants",
+			"type": "base",
+			"system": false,
+			"schema": [
+				{
+					"system": false,
+					"id": "tntuid01",
+					"name": "uid",
+					"type": "text",
+					"required": true,
+					"unique": true,
+					"options": {
+						"min": null,
+						"max": null,
+						"pattern": "^[a-z0-9_-]+$"
+					}
+				},
+				{
+					"system": false,
+					"id": "tntnam02",
+					"name": "name",
+					"type": "text",
+					"required": true,
+					"unique": false,
+					"options": {
+						"min": null,
+						"max": null,
+						"pattern": ""
+					}
+				},
+				{
+					"system": false,
+					"id": "tnthst03",
+					"name": "hosts",
+					"type": "json",
+					"required": false,
+					"unique": false,
+					"options": {}
+				},
+				{
+					"system": false,
+					"id": "tnteml04",
+					"name": "email_domains",
+					"type": "json",
+					"required": false,
+					"unique": false,
+					"options": {}
+				},
+				{
+					"system": false,
+					"id": "tntbrd05",
+					"name": "branding",
+					"type": "json",
+					"required": false,
+					"unique": false,
+					"options": {}
+				},
+				{
+					"system": false,
+					"id": "tntprc06",
+					"name": "send_price",
+					"type": "number",
+					"required": false,
+					"unique": false,
+					"options": {
+						"min": 0,
+						"max": null
+					}
+				},
+				{
+					"system": false,
+					"id": "tntsid07",
+					"name": "student_id_pattern",
+					"type": "text",
+					"required": false,
+					"unique": false,
+					"options": {
+						"min": null,
+						"max": null,
+						"pattern": ""
+					}
+				}
+			],
+			"listRule": null,
+			"viewRule": null,
+			"createRule": null,
+			"updateRule": null,
+			"deleteRule": null,
+			"options": {}
+		}`
+
+		collection := &models.Collection{}
+		if err := json.Unmarshal([]byte(jsonData), &collection); err != nil {
+			return err
+		}
+
+		dao := daos.New(db)
+		if err := dao.SaveCollection(collection); err != nil {
+			return err
+		}
+
+		// existing records belong to the default campus
+		for _, target := range tenantScopedCollections {
+			targetCollection, err := dao.FindCollectionByNameOrId(target.collectionId)
+			if err != nil {
+				return err
+			}
+
+			new_tenant := &schema.SchemaField{}
+			json.Unmarshal([]byte(`{
+				"system": false,
+				"id": "`+target.fieldId+`",
+				"name": "tenant",
+				"type": "text",
+				"required": false,
+				"unique": false,
+				"options": {
+					"min": null,
+					"max": null,
+					"pattern": ""
+				}
+			}`), new_tenant)
+			targetCollection.Schema.AddField(new_tenant)
+
+			if err := dao.SaveCollection(targetCollection); err != nil {
+				return err
+			}
+
+			if _, err := db.Update(targetCollection.Name, dbx.Params{"tenant": defaultTenantUid()}, nil).Execute(); err != nil {
+				return err
+			}
+		}
+
+		// student ids are validated against the pattern of the tenant
+		messages, err := dao.FindCollectionByNameOrId("caqiysan7yf0wve")
+		if err != nil {
+			return err
+		}
+
+		edit_recipient := &schema.SchemaField{}
+		json.Unmarshal([]byte(`{
+			"system": false,
+			"id": "idbaffkv",
+			"name": "recipient",
+			"type": "text",
+			"required": true,
+			"unique": false,
+			"options": {
+				"min": null,
+				"max": 32,
+				"pattern": ""
+			}
+		}`), edit_recipient)
+		messages.Schema.AddField(edit_recipient)
+
+		if err := dao.SaveCollection(messages); err != nil {
+			return err
+		}
+
+		userDetails, err := dao.FindCollectionByNameOrId("px00yjig95x0mcw")
+		if err != nil {
+			return err
+		}
+
+		edit_student_id := &schema.SchemaField{}
+		json.Unmarshal([]byte(`{
+			"system": false,
+			"id": "oaqps5fh",
+			"name": "student_id",
+			"type": "text",
+			"required": true,
+			"unique": false,
+			"options": {
+				"min": null,
+				"max": 32,
+				"pattern": ""
+			}
+		}`), edit_student_id)
+		userDetails.Schema.AddField(edit_student_id)
+
+		if err := dao.SaveCollection(userDetails); err != nil {
+			return err
+		}
+
+		if _, err := db.NewQuery("DROP INDEX IF EXISTS idx_ranking_buckets_recipient_day").Execute(); err != nil {
+			return err
+		}
+
+		if _, err := db.NewQuery("CREATE UNIQUE INDEX IF NOT EXISTS idx_ranking_buckets_tenant_recipient_day ON ranking_buckets (tenant, recipient, day)").Execute(); err != nil {
+			return err
+		}
+
+		_, err = db.NewQuery(`
+			INSERT INTO tenants (id, created, updated, uid, name, hosts, email_domains, branding, send_price, student_id_pattern)
+			VALUES ('tntuicdefault00',
+				strftime('%Y-%m-%d %H:%M:%fZ', 'now'),
+				strftime('%Y-%m-%d %H:%M:%fZ', 'now'),
+				'uic', 'University of the Immaculate Conception', '[]', '["uic.edu.ph"]',
+				'{"site_name": "UIC Valentine Wall", "community_name": "ignacians"}', 150, '^[0-9]{6,12}$')
+		`).Execute()
+		return err
+	}, func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		if _, err := db.NewQuery("DROP INDEX IF EXISTS idx_ranking_buckets_tenant_recipient_day").Execute(); err != nil {
+			return err
+		}
+
+		if _, err := db.NewQuery("CREATE UNIQUE INDEX IF NOT EXISTS idx_ranking_buckets_recipient_day ON ranking_buckets (recipient, day)").Execute(); err != nil {
+			return err
+		}
+
+		messages, err := dao.FindCollectionByNameOrId("caqiysan7yf0wve")
+		if err != nil {
+			return err
+		}
+
+		edit_recipient := &schema.SchemaField{}
+		json.Unmarshal([]byte(`{
+			"system": false,
+			"id": "idbaffkv",
+			"name": "recipient",
+			"type": "text",
+			"required": true,
+			"unique": false,
+			"options": {
+				"min": 6,
+				"max": 12,
+				"pattern": "[0-9]{6,12}|everyone"
+			}
+		}`), edit_recipient)
+		messages.Schema.AddField(edit_recipient)
+
+		if err := dao.SaveCollection(messages); err != nil {
+			return err
+		}
+
+		userDetails, err := dao.FindCollectionByNameOrId("px00yjig95x0mcw")
+		if err != nil {
+			return err
+		}
+
+		edit_student_id := &schema.SchemaField{}
+		json.Unmarshal([]byte(`{
+			"system": false,
+			"id": "oaqps5fh",
+			"name": "student_id",
+			"type": "text",
+			"required": true,
+			"unique": false,
+			"options": {
+				"min": 11,
+				"max": 12,
+				"pattern": ""
+			}
+		}`), edit_student_id)
+		userDetails.Schema.AddField(edit_student_id)
+
+		if err := dao.SaveCollection(userDetails); err != nil {
+			return err
+		}
+
+		for _, target := range tenantScopedCollections {
+			targetCollection, err := dao.FindCollectionByNameOrId(target.collectionId)
+			if err != nil {
+				return err
+			}
+
+			// remove
+			targetCollection.Schema.RemoveField(target.fieldId)
+
+			if err := dao.SaveCollection(targetCollection); err != nil {
+				return err
+			}
+		}
+
+		collection, err := dao.FindCollectionByNameOrId("tnt7h3k9m1p5s2d")
+		if err != nil {
+			return err
+		}
+
+		return dao.DeleteCollection(collection)
+	})
+}
@@ -0,0 +1,57 @@
+package migrations
+
+import (
+	"encoding/json"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/models/schema"
+)
+
+func init() {
+	m.Register(func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		messages, err := dao.FindCollectionByNameOrId("caqiysan7yf0wve")
+		if err != nil {
+			return err
+		}
+
+		// add
+		new_theme := &schema.SchemaField{}
+		json.Unmarshal([]byte(`{
+			"system": false,
+			"id": "msgthm01",
+			"name": "theme",
+			"type": "text",
+			"required": false,
+			"unique": false,
+			"options": {
+				"min": null,
+				"max": 32,
+				"pattern": "^[a-z0-9_-]*$"
+			}
+		}`), new_theme)
+		messages.Schema.AddField(new_theme)
+
+		if err := dao.SaveCollection(messages); err != nil {
+			return err
+		}
+
+		_, err = db.NewQuery("UPDATE messages SET theme = 'classic' WHERE COALESCE(theme, '') = ''").Execute()
+		return err
+	}, func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		messages, err := dao.FindCollectionByNameOrId("caqiysan7yf0wve")
+		if err != nil {
+			return err
+		}
+
+		// remove
+		messages.Schema.RemoveField("msgthm01")
+
+		return dao.SaveCollection(messages)
+	})
+}
@@ -0,0 +1,282 @@
+package migrations
+
+import (
+	"encoding/json"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/models/schema"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// sanction fields of user_details that are moved to user_sanctions
+var userDetailsSanctionFields = []string{
+	`{
+		"system": false,
+		"id": "snbn7u2k",
+		"name": "send_banned_until",
+		"type": "date",
+		"required": false,
+		"unique": false,
+		"options": {
+			"min": "",
+			"max": ""
+		}
+	}`,
+	`{
+		"system": false,
+		"id": "rplo4m9x",
+		"name": "reply_only_until",
+		"type": "date",
+		"required": false,
+		"unique": false,
+		"options": {
+			"min": "",
+			"max": ""
+		}
+	}`,
+	`{
+		"system": false,
+		"id": "shbn3q8w",
+		"name": "shadow_banned_until",
+		"type": "date",
+		"required": false,
+		"unique": false,
+		"options": {
+			"min": "",
+			"max": ""
+		}
+	}`,
+}
+
+func init() {
+	m.Register(func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		// sanctions are only visible to admins
+		jsonData := `{
+			"id": "usnc4k8w2r6t0py",
+			"created": "2023-02-14 12:00:00.000Z",
+			"updated": "2023-02-14 12:00:00.000Z",
+			"name": "user_sanctions",
+			"type": "base",
+			"system": false,
+			"schema": [
+				{
+					"system": false,
+					"id": "usn7usr1",
+					"name": "user",
+					"type": "relation",
+					"required": true,
+					"unique": true,
+					"options": {
+						"maxSelect": 1,
+						"collectionId": "px00yjig95x0mcw",
+						"cascadeDelete": true
+					}
+				},
+				{
+					"system": false,
+					"id": "usn7snd2",
+					"name": "send_banned_until",
+					"type": "date",
+					"required": false,
+					"unique": false,
+					"options": {
+						"min": "",
+						"max": ""
+					}
+				},
+				{
+					"system": false,
+					"id": "usn7rpl3",
+					"name": "reply_only_until",
+					"type": "date",
+					"required": false,
+					"unique": false,
+					"options": {
+						"min": "",
+						"max": ""
+					}
+				},
+				{
+					"system": false,
+					"id": "usn7shd4",
+					"name": "shadow_banned_until",
+					"type": "date",
+					"required": false,
+					"unique": false,
+					"options": {
+						"min": "",
+						"max": ""
+					}
+				}
+			],
+			"listRule": null,
+			"viewRule": null,
+			"createRule": null,
+			"updateRule": null,
+			"deleteRule": null,
+			"options": {}
+		}`
+
+		sanctions := &models.Collection{}
+		if err := json.Unmarshal([]byte(jsonData), &sanctions); err != nil {
+			return err
+		}
+
+		if err := dao.SaveCollection(sanctions); err != nil {
+			return err
+		}
+
+		if _, err := db.NewQuery(`
+			INSERT INTO user_sanctions (id, created, updated, user, send_banned_until, reply_only_until, shadow_banned_until)
+			SELECT substr(lower(hex(randomblob(8))), 1, 15), strftime('%Y-%m-%d %H:%M:%fZ', 'now'), strftime('%Y-%m-%d %H:%M:%fZ', 'now'),
+				id, COALESCE(send_banned_until, ''), COALESCE(reply_only_until, ''), COALESCE(shadow_banned_until, '')
+			FROM user_details
+			WHERE COALESCE(send_banned_until, '') != '' OR COALESCE(reply_only_until, '') != '' OR COALESCE(shadow_banned_until, '') != ''
+		`).Execute(); err != nil {
+			return err
+		}
+
+		// posts of shadow-banned users are marked as hidden when they are
+		// sent since the rules can not look up the admin-only sanctions
+		messages, err := dao.FindCollectionByNameOrId("caqiysan7yf0wve")
+		if err != nil {
+			return err
+		}
+
+		new_hidden := &schema.SchemaField{}
+		json.Unmarshal([]byte(`{
+			"system": false,
+			"id": "msghdn01",
+			"name": "hidden",
+			"type": "bool",
+			"required": false,
+			"unique": false,
+			"options": {}
+		}`), new_hidden)
+		messages.Schema.AddField(new_hidden)
+
+		messages.ListRule = types.Pointer("(hidden != true || @request.auth.details.id = user.id) && (gifts:length = 0 || recipient = \"everyone\" || (@request.auth.details.id = user.id || @request.auth.details.student_id = recipient))")
+
+		messages.ViewRule = types.Pointer("(hidden != true || @request.auth.details.id = user.id) && (gifts:length = 0 || recipient = \"everyone\" || (@request.auth.details.id = user.id || @request.auth.details.student_id = recipient))")
+
+		if err := dao.SaveCollection(messages); err != nil {
+			return err
+		}
+
+		replies, err := dao.FindCollectionByNameOrId("35mnuyxwxc8xvs6")
+		if err != nil {
+			return err
+		}
+
+		new_reply_hidden := &schema.SchemaField{}
+		json.Unmarshal([]byte(`{
+			"system": false,
+			"id": "rplhdn01",
+			"name": "hidden",
+			"type": "bool",
+			"required": false,
+			"unique": false,
+			"options": {}
+		}`), new_reply_hidden)
+		replies.Schema.AddField(new_reply_hidden)
+
+		replies.ListRule = types.Pointer("(hidden != true || @request.auth.details.id = sender.id) && (message.recipient = \"everyone\" || @request.auth.details.id = message.user.id || @request.auth.details.id = sender.id)")
+
+		replies.ViewRule = types.Pointer("(hidden != true || @request.auth.details.id = sender.id) && (message.recipient = \"everyone\" || @request.auth.details.id = message.user.id || @request.auth.details.id = sender.id)")
+
+		if err := dao.SaveCollection(replies); err != nil {
+			return err
+		}
+
+		// posts sent during a shadow-ban that is still active stay hidden
+		for _, query := range []string{
+			"UPDATE messages SET hidden = TRUE WHERE user IN (SELECT user FROM user_sanctions WHERE shadow_banned_until > strftime('%Y-%m-%d %H:%M:%fZ', 'now'))",
+			"UPDATE message_replies SET hidden = TRUE WHERE sender IN (SELECT user FROM user_sanctions WHERE shadow_banned_until > strftime('%Y-%m-%d %H:%M:%fZ', 'now'))",
+		} {
+			if _, err := db.NewQuery(query).Execute(); err != nil {
+				return err
+			}
+		}
+
+		userDetails, err := dao.FindCollectionByNameOrId("px00yjig95x0mcw")
+		if err != nil {
+			return err
+		}
+
+		// remove
+		userDetails.Schema.RemoveField("snbn7u2k")
+		userDetails.Schema.RemoveField("rplo4m9x")
+		userDetails.Schema.RemoveField("shbn3q8w")
+
+		return dao.SaveCollection(userDetails)
+	}, func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		userDetails, err := dao.FindCollectionByNameOrId("px00yjig95x0mcw")
+		if err != nil {
+			return err
+		}
+
+		// add
+		for _, rawField := range userDetailsSanctionFields {
+			newField := &schema.SchemaField{}
+			json.Unmarshal([]byte(rawField), newField)
+			userDetails.Schema.AddField(newField)
+		}
+
+		if err := dao.SaveCollection(userDetails); err != nil {
+			return err
+		}
+
+		if _, err := db.NewQuery(`
+			UPDATE user_details SET
+				send_banned_until = COALESCE((SELECT s.send_banned_until FROM user_sanctions s WHERE s.user = user_details.id), ''),
+				reply_only_until = COALESCE((SELECT s.reply_only_until FROM user_sanctions s WHERE s.user = user_details.id), ''),
+				shadow_banned_until = COALESCE((SELECT s.shadow_banned_until FROM user_sanctions s WHERE s.user = user_details.id), '')
+		`).Execute(); err != nil {
+			return err
+		}
+
+		replies, err := dao.FindCollectionByNameOrId("35mnuyxwxc8xvs6")
+		if err != nil {
+			return err
+		}
+
+		replies.Schema.RemoveField("rplhdn01")
+
+		replies.ListRule = types.Pointer("(sender.shadow_banned_until = \"\" || sender.shadow_banned_until < @now || @request.auth.details.id = sender.id) && (message.recipient = \"everyone\" || @request.auth.details.id = message.user.id || @request.auth.details.id = sender.id)")
+
+		replies.ViewRule = types.Pointer("(sender.shadow_banned_until = \"\" || sender.shadow_banned_until < @now || @request.auth.details.id = sender.id) && (message.recipient = \"everyone\" || @request.auth.details.id = message.user.id || @request.auth.details.id = sender.id)")
+
+		if err := dao.SaveCollection(replies); err != nil {
+			return err
+		}
+
+		messages, err := dao.FindCollectionByNameOrId("caqiysan7yf0wve")
+		if err != nil {
+			return err
+		}
+
+		messages.Schema.RemoveField("msghdn01")
+
+		messages.ListRule = types.Pointer("(user.shadow_banned_until = \"\" || user.shadow_banned_until < @now || @request.auth.details.id = user.id) && (gifts:length = 0 || recipient = \"everyone\" || (@request.auth.details.id = user.id || @request.auth.details.student_id = recipient))")
+
+		messages.ViewRule = types.Pointer("(user.shadow_banned_until = \"\" || user.shadow_banned_until < @now || @request.auth.details.id = user.id) && (gifts:length = 0 || recipient = \"everyone\" || (@request.auth.details.id = user.id || @request.auth.details.student_id = recipient))")
+
+		if err := dao.SaveCollection(messages); err != nil {
+			return err
+		}
+
+		sanctions, err := dao.FindCollectionByNameOrId("usnc4k8w2r6t0py")
+		if err != nil {
+			return err
+		}
+
+		return dao.DeleteCollection(sanctions)
+	})
+}
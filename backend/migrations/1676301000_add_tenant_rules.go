@@ -0,0 +1,65 @@
+package migrations
+
+import (
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		// users only see the records of their own campus once they have set
+		// up their details. the lists of everyone else are scoped by the
+		// server instead.
+		messages, err := dao.FindCollectionByNameOrId("caqiysan7yf0wve")
+		if err != nil {
+			return err
+		}
+
+		messages.ListRule = types.Pointer("(@request.auth.details.id = \"\" || tenant = @request.auth.details.tenant) && (hidden != true || @request.auth.details.id = user.id) && (gifts:length = 0 || recipient = \"everyone\" || (@request.auth.details.id = user.id || @request.auth.details.student_id = recipient))")
+
+		messages.ViewRule = types.Pointer("(@request.auth.details.id = \"\" || tenant = @request.auth.details.tenant) && (hidden != true || @request.auth.details.id = user.id) && (gifts:length = 0 || recipient = \"everyone\" || (@request.auth.details.id = user.id || @request.auth.details.student_id = recipient))")
+
+		if err := dao.SaveCollection(messages); err != nil {
+			return err
+		}
+
+		rankings, err := dao.FindCollectionByNameOrId("ocpdx07v34h97tx")
+		if err != nil {
+			return err
+		}
+
+		rankings.ListRule = types.Pointer("(@request.auth.details.id = \"\" || tenant = @request.auth.details.tenant) && hidden = false")
+		rankings.ViewRule = types.Pointer("(@request.auth.details.id = \"\" || tenant = @request.auth.details.tenant) && hidden = false")
+
+		return dao.SaveCollection(rankings)
+	}, func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		rankings, err := dao.FindCollectionByNameOrId("ocpdx07v34h97tx")
+		if err != nil {
+			return err
+		}
+
+		rankings.ListRule = types.Pointer("hidden = false")
+		rankings.ViewRule = types.Pointer("hidden = false")
+
+		if err := dao.SaveCollection(rankings); err != nil {
+			return err
+		}
+
+		messages, err := dao.FindCollectionByNameOrId("caqiysan7yf0wve")
+		if err != nil {
+			return err
+		}
+
+		messages.ListRule = types.Pointer("(hidden != true || @request.auth.details.id = user.id) && (gifts:length = 0 || recipient = \"everyone\" || (@request.auth.details.id = user.id || @request.auth.details.student_id = recipient))")
+
+		messages.ViewRule = types.Pointer("(hidden != true || @request.auth.details.id = user.id) && (gifts:length = 0 || recipient = \"everyone\" || (@request.auth.details.id = user.id || @request.auth.details.student_id = recipient))")
+
+		return dao.SaveCollection(messages)
+	})
+}
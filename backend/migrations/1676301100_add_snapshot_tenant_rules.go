@@ -0,0 +1,38 @@
+package migrations
+
+import (
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		// like the rankings, users only see the snapshots of their own
+		// campus. the lists of everyone else are scoped by the server.
+		snapshots, err := dao.FindCollectionByNameOrId("rks3n7c1x5v9b2h")
+		if err != nil {
+			return err
+		}
+
+		snapshots.ListRule = types.Pointer("@request.auth.details.id = \"\" || tenant = @request.auth.details.tenant")
+		snapshots.ViewRule = types.Pointer("@request.auth.details.id = \"\" || tenant = @request.auth.details.tenant")
+
+		return dao.SaveCollection(snapshots)
+	}, func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		snapshots, err := dao.FindCollectionByNameOrId("rks3n7c1x5v9b2h")
+		if err != nil {
+			return err
+		}
+
+		snapshots.ListRule = types.Pointer("")
+		snapshots.ViewRule = types.Pointer("")
+
+		return dao.SaveCollection(snapshots)
+	})
+}
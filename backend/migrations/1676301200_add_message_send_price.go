@@ -0,0 +1,61 @@
+package migrations
+
+import (
+	"encoding/json"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/models/schema"
+)
+
+func init() {
+	m.Register(func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		messages, err := dao.FindCollectionByNameOrId("caqiysan7yf0wve")
+		if err != nil {
+			return err
+		}
+
+		// add
+		new_send_price := &schema.SchemaField{}
+		json.Unmarshal([]byte(`{
+			"system": false,
+			"id": "msgprc01",
+			"name": "send_price",
+			"type": "number",
+			"required": false,
+			"unique": false,
+			"options": {
+				"min": 0,
+				"max": null
+			}
+		}`), new_send_price)
+		messages.Schema.AddField(new_send_price)
+
+		if err := dao.SaveCollection(messages); err != nil {
+			return err
+		}
+
+		// the messages sent so far are priced with what their campus
+		// charges now, falling back to the default price of 150
+		_, err = db.NewQuery(`
+			UPDATE messages SET send_price = COALESCE(NULLIF((SELECT t.send_price FROM tenants t WHERE t.uid = messages.tenant), 0), 150)
+			WHERE COALESCE(send_price, 0) = 0
+		`).Execute()
+		return err
+	}, func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		messages, err := dao.FindCollectionByNameOrId("caqiysan7yf0wve")
+		if err != nil {
+			return err
+		}
+
+		// remove
+		messages.Schema.RemoveField("msgprc01")
+
+		return dao.SaveCollection(messages)
+	})
+}
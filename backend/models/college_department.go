@@ -11,8 +11,9 @@ var _ models.Model = (*CollegeDepartment)(nil)
 type CollegeDepartment struct {
 	models.BaseModel
 
-	UID   string `db:"uid" json:"uid"`
-	Label string `db:"label" json:"label"`
+	UID    string `db:"uid" json:"uid"`
+	Label  string `db:"label" json:"label"`
+	Tenant string `db:"tenant" json:"tenant"`
 }
 
 func (dept *CollegeDepartment) TableName() string {
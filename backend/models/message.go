@@ -11,10 +11,11 @@ type Message struct {
 	models.BaseModel
 
 	ID        string         `db:"id" json:"id"`
-	Recipient string         `db:"recipient" json:"recipient" validate:"required,min=6,max=12,numeric"`
+	Recipient string         `db:"recipient" json:"recipient" validate:"required,max=32"`
 	User      string         `db:"user" json:"user"`
 	Content   string         `db:"content" json:"content" validate:"required,max=240"`
 	Gifts     []string       `db:"gifts" json:"gifts"`
+	Theme     string         `db:"theme" json:"theme"`
 	Deleted   types.DateTime `db:"deleted" json:"deleted"`
 }
 
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pocketbase/pocketbase/daos"
+	"github.com/pocketbase/pocketbase/models"
+)
+
+const defaultProfanityCategory = "profanity"
+
+// ModerationMatch describes a flagged portion of a submission. Start and End
+// are rune offsets of the flagged span within the submitted content.
+type ModerationMatch struct {
+	Start      int    `json:"start"`
+	End        int    `json:"end"`
+	Text       string `json:"text,omitempty"`
+	Category   string `json:"category"`
+	Suggestion string `json:"suggestion"`
+}
+
+type ModerationVerdict struct {
+	Stage   string            `json:"stage"`
+	Matches []ModerationMatch `json:"matches"`
+}
+
+func (v *ModerationVerdict) ToResponseError(message string) *ResponseError {
+	return &ResponseError{
+		StatusCode: http.StatusBadRequest,
+		Message:    message,
+		Data: map[string]any{
+			"moderation": v,
+		},
+	}
+}
+
+func newModerationMatch(content string, startByte, endByte int, category string, suggestion string) ModerationMatch {
+	match := ModerationMatch{
+		Start:      utf8.RuneCountInString(content[:startByte]),
+		End:        utf8.RuneCountInString(content[:endByte]),
+		Category:   category,
+		Suggestion: suggestion,
+	}
+
+	if !moderationHiddenCategories[category] {
+		match.Text = content[startByte:endByte]
+	}
+
+	return match
+}
+
+// findProfanitySpans returns the byte ranges of the content censored by the
+// profanity detector. Ranges separated only by whitespace are merged since
+// the detector ignores spaces when matching terms.
+func findProfanitySpans(content string) [][2]int {
+	censored := profanityDetector.Censor(content)
+	if len(censored) != len(content) {
+		return nil
+	}
+
+	spans := [][2]int{}
+	for i := 0; i < len(content); i++ {
+		if censored[i] != '*' || content[i] == '*' {
+			continue
+		}
+
+		if last := len(spans) - 1; last >= 0 && len(strings.TrimSpace(content[spans[last][1]:i])) == 0 {
+			spans[last][1] = i + 1
+		} else {
+			spans = append(spans, [2]int{i, i + 1})
+		}
+	}
+
+	return spans
+}
+
+func profanitySuggestion(term string, category string) string {
+	if moderationHiddenCategories[category] || len(term) == 0 {
+		return "Remove or rephrase the highlighted word."
+	}
+	return fmt.Sprintf("Remove or rephrase \"%s\".", term)
+}
+
+func checkProfanity(content string) *ResponseError {
+	if !profanityDetector.IsProfane(content) {
+		return nil
+	}
+
+	verdict := &ModerationVerdict{Stage: "profanity"}
+	for _, span := range findProfanitySpans(content) {
+		spanText := content[span[0]:span[1]]
+		term := profanityDetector.ExtractProfanity(spanText)
+		category, hasCategory := profanityCategories[term]
+		if !hasCategory {
+			category = defaultProfanityCategory
+		}
+
+		verdict.Matches = append(verdict.Matches, newModerationMatch(content, span[0], span[1], category, profanitySuggestion(spanText, category)))
+	}
+
+	// the detector may flag a term without being able to locate it
+	// (e.g. leetspeak) so report the term on its own instead
+	if len(verdict.Matches) == 0 {
+		term := profanityDetector.ExtractProfanity(content)
+		category, hasCategory := profanityCategories[term]
+		if !hasCategory {
+			category = defaultProfanityCategory
+		}
+
+		match := ModerationMatch{Start: -1, End: -1, Category: category, Suggestion: profanitySuggestion(term, category)}
+		if !moderationHiddenCategories[category] {
+			match.Text = term
+		}
+		verdict.Matches = append(verdict.Matches, match)
+	}
+
+	return verdict.ToResponseError("Your submission contains inappropriate content.")
+}
+
+// moderateContent runs the content through the moderation stages. it
+// returns the content to be saved since some stages mask parts of it.
+func moderateContent(content string) (string, *ResponseError) {
+	if err := checkProfanity(content); err != nil {
+		return content, err
+	}
+
+	return checkPersonalInfo(content)
+}
+
+// queueForModeration stores a submission in the moderation queue so that
+// admins can review it later.
+func queueForModeration(dao *daos.Dao, userId string, record *models.Record, reason string, details map[string]any) error {
+	collection, err := dao.FindCollectionByNameOrId("moderation_queue")
+	if err != nil {
+		return err
+	}
+
+	entry := models.NewRecord(collection)
+	entry.Set("user", userId)
+	entry.Set("collection", record.Collection().Name)
+	entry.Set("record", record.Id)
+	entry.Set("reason", reason)
+	entry.Set("payload", record.SchemaData())
+	entry.Set("details", details)
+	entry.Set("status", "pending")
+	return dao.SaveRecord(entry)
+}
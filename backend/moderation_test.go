@@ -0,0 +1,68 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestCheckProfanity_Clean(t *testing.T) {
+	if err := checkProfanity("Happy valentines day!"); err != nil {
+		t.Errorf("Expected clean content to pass, got: %v", err)
+	}
+}
+
+func TestCheckProfanity_ReturnsMatchedSpan(t *testing.T) {
+	err := checkProfanity("what the fuck is this")
+	if err == nil {
+		t.Fatal("Expected profane content to be rejected, got nil")
+	}
+
+	verdict, ok := err.Data["moderation"].(*ModerationVerdict)
+	if !ok {
+		t.Fatalf("Expected moderation verdict in error data, got %v", err.Data)
+	}
+
+	if len(verdict.Matches) != 1 {
+		t.Fatalf("Expected 1 match, got %d", len(verdict.Matches))
+	}
+
+	match := verdict.Matches[0]
+	if match.Start != 9 || match.End != 13 {
+		t.Errorf("Expected span [9, 13], got [%d, %d]", match.Start, match.End)
+	}
+
+	if match.Text != "fuck" {
+		t.Errorf("Expected matched text 'fuck', got '%s'", match.Text)
+	}
+
+	if match.Category != defaultProfanityCategory {
+		t.Errorf("Expected category '%s', got '%s'", defaultProfanityCategory, match.Category)
+	}
+}
+
+func TestCheckProfanity_HiddenCategory(t *testing.T) {
+	profanityCategories["fuck"] = "slur"
+	moderationHiddenCategories["slur"] = true
+	defer func() {
+		delete(profanityCategories, "fuck")
+		delete(moderationHiddenCategories, "slur")
+	}()
+
+	err := checkProfanity("fuck this")
+	if err == nil {
+		t.Fatal("Expected profane content to be rejected, got nil")
+	}
+
+	verdict := err.Data["moderation"].(*ModerationVerdict)
+	match := verdict.Matches[0]
+	if match.Category != "slur" {
+		t.Errorf("Expected category 'slur', got '%s'", match.Category)
+	}
+
+	if len(match.Text) != 0 {
+		t.Errorf("Expected matched text to be hidden, got '%s'", match.Text)
+	}
+
+	if match.Start != 0 || match.End != 4 {
+		t.Errorf("Expected span [0, 4], got [%d, %d]", match.Start, match.End)
+	}
+}
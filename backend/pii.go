@@ -0,0 +1,251 @@
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	piiPhone        = "phone"
+	piiEmail        = "email"
+	piiSocialHandle = "social_handle"
+	piiURL          = "url"
+)
+
+const (
+	piiPolicyReject = "reject"
+	piiPolicyMask   = "mask"
+)
+
+// spelled-out digits people use to get around number filters
+var piiNumberWords = map[string]string{
+	// english
+	"zero": "0", "oh": "0", "one": "1", "two": "2", "three": "3", "four": "4",
+	"five": "5", "six": "6", "seven": "7", "eight": "8", "nine": "9",
+	// tagalog
+	"sero": "0", "isa": "1", "dalawa": "2", "tatlo": "3", "apat": "4",
+	"lima": "5", "anim": "6", "pito": "7", "walo": "8", "siyam": "9",
+	// bisaya
+	"usa": "1", "duha": "2", "tulo": "3", "upat": "4", "unom": "6",
+}
+
+var phMobileNumberPattern = regexp.MustCompile(`^(?:63|0)?9\d{9}$`)
+
+// links without a scheme or "www." only count when the domain ends with a
+// TLD that is not also an english word. ".me" and ".ly" need a path (e.g.
+// "bit.ly/abc") so that typos like "you.me" are left alone.
+var piiURLPattern = regexp.MustCompile(`(?i)(?:https?://|www\.)[^\s]+|\b[a-z0-9-]+(?:\.[a-z0-9-]+)*(?:\.(?:com|net|org|ph|io|gg)\b(?:/[^\s]*)?|\.(?:me|ly)/[^\s]+)`)
+
+var piiPatterns = []struct {
+	kind    string
+	pattern *regexp.Regexp
+}{
+	{
+		kind:    piiEmail,
+		pattern: regexp.MustCompile(`(?i)[a-z0-9._%+-]+\s*(?:@|\(at\)|\[at\]|\s+at\s+)\s*[a-z0-9-]+(?:\s*(?:\.|\(dot\)|\[dot\]|\s+dot\s+)\s*[a-z0-9-]+)*\s*(?:\.|\(dot\)|\[dot\]|\s+dot\s+)\s*(?:com|net|org|edu|ph|io|me|co)\b`),
+	},
+	{
+		kind:    piiSocialHandle,
+		pattern: regexp.MustCompile(`(?i)(?:https?://)?(?:www\.|m\.)?(?:facebook|fb|instagram|twitter|tiktok|x)\.com/[a-z0-9_.\-/?=]+`),
+	},
+	{
+		kind:    piiSocialHandle,
+		pattern: regexp.MustCompile(`(?i)\b(?:fb|facebook|ig|insta|instagram|twitter|tiktok|tg|telegram)\s*[:\-]\s*@?[a-z0-9_.]{3,}`),
+	},
+	{
+		kind:    piiSocialHandle,
+		pattern: regexp.MustCompile(`(?:^|[^\w@])(@[A-Za-z0-9_.]{3,30})`),
+	},
+	{
+		kind:    piiURL,
+		pattern: piiURLPattern,
+	},
+}
+
+type piiMatch struct {
+	Kind  string
+	Start int
+	End   int
+}
+
+type piiDigitToken struct {
+	digits string
+	start  int
+	end    int
+}
+
+// detectPhoneNumbers looks for PH mobile numbers written with digits,
+// spelled-out numbers (e.g. "zero nine one seven") or a mix of both,
+// separated by spaces, dashes, dots or parentheses. numbers next to each
+// other (e.g. "09171234567 / 09281234567" or "09171234567 2 times") are
+// found on their own as long as a separator comes between them.
+func detectPhoneNumbers(content string) []piiMatch {
+	matches := []piiMatch{}
+	run := []piiDigitToken{}
+
+	flush := func() {
+		for i := 0; i < len(run); {
+			// the longest number that starts with this token wins so
+			// that "+63 917..." is matched with its country code
+			end := -1
+			digits := strings.Builder{}
+			for j := i; j < len(run) && digits.Len()+len(run[j].digits) <= 12; j++ {
+				digits.WriteString(run[j].digits)
+				if digits.Len() >= 10 && phMobileNumberPattern.MatchString(digits.String()) {
+					end = j
+				}
+			}
+
+			if end == -1 {
+				i++
+				continue
+			}
+
+			matches = append(matches, piiMatch{Kind: piiPhone, Start: run[i].start, End: run[end].end})
+			i = end + 1
+		}
+		run = run[:0]
+	}
+
+	for i := 0; i < len(content); {
+		char, size := utf8.DecodeRuneInString(content[i:])
+
+		switch {
+		case unicode.IsDigit(char):
+			// digits written together stay together so that a number is
+			// never found in the middle of a longer one (e.g. an ID)
+			end := i
+			for end < len(content) {
+				c, s := utf8.DecodeRuneInString(content[end:])
+				if !unicode.IsDigit(c) {
+					break
+				}
+				end += s
+			}
+
+			run = append(run, piiDigitToken{digits: content[i:end], start: i, end: end})
+			i = end
+		case unicode.IsLetter(char):
+			end := i
+			for end < len(content) {
+				c, s := utf8.DecodeRuneInString(content[end:])
+				if !unicode.IsLetter(c) && !unicode.IsDigit(c) && c != '\'' {
+					break
+				}
+				end += s
+			}
+
+			word := strings.ToLower(content[i:end])
+			if digit, isNumberWord := piiNumberWords[word]; isNumberWord {
+				run = append(run, piiDigitToken{digits: digit, start: i, end: end})
+			} else if strings.Trim(word, "0123456789ol") == "" && strings.ContainsAny(word, "0123456789") {
+				// letters used in place of digits (e.g. "o9l7")
+				run = append(run, piiDigitToken{digits: strings.NewReplacer("o", "0", "l", "1").Replace(word), start: i, end: end})
+			} else {
+				flush()
+			}
+			i = end
+		case unicode.IsSpace(char) || strings.ContainsRune("-.()+,/", char):
+			i += size
+		default:
+			flush()
+			i += size
+		}
+	}
+
+	flush()
+	return matches
+}
+
+// detectPersonalInfo returns the non-overlapping personal information found
+// in the content. earlier detectors take precedence over later ones.
+func detectPersonalInfo(content string) []piiMatch {
+	// digits of links (e.g. ids in a path) are not phone numbers. the
+	// links are blanked out with the same number of bytes so that the
+	// offsets still point to the content.
+	phoneContent := []byte(content)
+	for _, loc := range piiURLPattern.FindAllStringIndex(content, -1) {
+		for i := loc[0]; i < loc[1]; i++ {
+			phoneContent[i] = '_'
+		}
+	}
+
+	candidates := detectPhoneNumbers(string(phoneContent))
+	for _, p := range piiPatterns {
+		for _, loc := range p.pattern.FindAllStringSubmatchIndex(content, -1) {
+			start, end := loc[0], loc[1]
+			if len(loc) >= 4 && loc[2] != -1 {
+				start, end = loc[2], loc[3]
+			}
+			candidates = append(candidates, piiMatch{Kind: p.kind, Start: start, End: end})
+		}
+	}
+
+	matches := []piiMatch{}
+	for _, candidate := range candidates {
+		overlaps := false
+		for _, match := range matches {
+			if candidate.Start < match.End && match.Start < candidate.End {
+				overlaps = true
+				break
+			}
+		}
+
+		if !overlaps {
+			matches = append(matches, candidate)
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].Start < matches[j].Start
+	})
+
+	return matches
+}
+
+func piiSuggestion(kind string) string {
+	switch kind {
+	case piiPhone:
+		return "Remove the phone number. Messages on the wall are public."
+	case piiEmail:
+		return "Remove the email address. Messages on the wall are public."
+	case piiSocialHandle:
+		return "Remove the social media handle. Messages on the wall are public."
+	default:
+		return "Remove the link. Messages on the wall are public."
+	}
+}
+
+// checkPersonalInfo rejects or masks the personal information found in the
+// content according to piiPolicies. it returns the (possibly masked) content.
+func checkPersonalInfo(content string) (string, *ResponseError) {
+	matches := detectPersonalInfo(content)
+	if len(matches) == 0 {
+		return content, nil
+	}
+
+	verdict := &ModerationVerdict{Stage: "personal_info"}
+	for _, match := range matches {
+		if piiPolicies[match.Kind] == piiPolicyReject {
+			verdict.Matches = append(verdict.Matches, newModerationMatch(content, match.Start, match.End, match.Kind, piiSuggestion(match.Kind)))
+		}
+	}
+
+	if len(verdict.Matches) != 0 {
+		return content, verdict.ToResponseError("Your submission contains personal information.")
+	}
+
+	masked := strings.Builder{}
+	lastEnd := 0
+	for _, match := range matches {
+		masked.WriteString(content[lastEnd:match.Start])
+		masked.WriteString(strings.Repeat("*", utf8.RuneCountInString(content[match.Start:match.End])))
+		lastEnd = match.End
+	}
+	masked.WriteString(content[lastEnd:])
+
+	return masked.String(), nil
+}
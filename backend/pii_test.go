@@ -0,0 +1,101 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestDetectPersonalInfo(t *testing.T) {
+	cases := []struct {
+		content  string
+		kind     string
+		expected string
+	}{
+		{"text me 09171234567 later", piiPhone, "09171234567"},
+		{"my number is 0917 123 4567", piiPhone, "0917 123 4567"},
+		{"call 0917-123-4567!", piiPhone, "0917-123-4567"},
+		{"(0917) 123.4567", piiPhone, "0917) 123.4567"},
+		{"+63 917 123 4567 ha", piiPhone, "63 917 123 4567"},
+		{"zero nine one seven one two three four five six seven", piiPhone, "zero nine one seven one two three four five six seven"},
+		{"Zero Nine 17 one 2 three 45 six 7 hehe", piiPhone, "Zero Nine 17 one 2 three 45 six 7"},
+		{"sero siyam isa pito isa dalawa tatlo apat lima anim pito", piiPhone, "sero siyam isa pito isa dalawa tatlo apat lima anim pito"},
+		{"o9l7 123 4567", piiPhone, "o9l7 123 4567"},
+		{"text 09171234567, 3pm", piiPhone, "09171234567"},
+		{"call 09171234567 2 times", piiPhone, "09171234567"},
+		{"email me at juan.delacruz@gmail.com", piiEmail, "juan.delacruz@gmail.com"},
+		{"juan at gmail dot com", piiEmail, "juan at gmail dot com"},
+		{"juan(at)gmail(dot)com", piiEmail, "juan(at)gmail(dot)com"},
+		{"follow me @juan.dc", piiSocialHandle, "@juan.dc"},
+		{"fb: juan.delacruz", piiSocialHandle, "fb: juan.delacruz"},
+		{"IG - juan_dc", piiSocialHandle, "IG - juan_dc"},
+		{"facebook.com/juan.dc", piiSocialHandle, "facebook.com/juan.dc"},
+		{"see https://example.com/page", piiURL, "https://example.com/page"},
+		{"visit www.example.org", piiURL, "www.example.org"},
+		{"check example.ph", piiURL, "example.ph"},
+		{"https://example.com/p/09171234567 hehe", piiURL, "https://example.com/p/09171234567"},
+		{"facebook.com/profile.php?id=639171234567", piiSocialHandle, "facebook.com/profile.php?id=639171234567"},
+	}
+
+	for _, c := range cases {
+		matches := detectPersonalInfo(c.content)
+		if len(matches) != 1 {
+			t.Errorf("%q: expected 1 match, got %d", c.content, len(matches))
+			continue
+		}
+
+		if matches[0].Kind != c.kind {
+			t.Errorf("%q: expected kind %s, got %s", c.content, c.kind, matches[0].Kind)
+		}
+
+		if got := c.content[matches[0].Start:matches[0].End]; got != c.expected {
+			t.Errorf("%q: expected match %q, got %q", c.content, c.expected, got)
+		}
+	}
+}
+
+func TestDetectPersonalInfo_NoFalsePositives(t *testing.T) {
+	for _, content := range []string{
+		"Happy valentines day! See you at the library at 3.",
+		"I have 2 cats and 3 dogs",
+		"My student ID is 202012345678",
+		"one day, i will tell you. nine times out of ten i think of you",
+		"Class of 2023, 4 years na ta",
+		"i love you <3 so much",
+		"i love you.me too",
+		"My student ID is 2019123456789",
+	} {
+		if matches := detectPersonalInfo(content); len(matches) != 0 {
+			t.Errorf("%q: expected no matches, got %v", content, matches)
+		}
+	}
+}
+
+func TestDetectPersonalInfo_AdjacentNumbers(t *testing.T) {
+	content := "09171234567 / 09281234567"
+	matches := detectPersonalInfo(content)
+	if len(matches) != 2 {
+		t.Fatalf("Expected 2 matches, got %v", matches)
+	}
+
+	for i, expected := range []string{"09171234567", "09281234567"} {
+		if got := content[matches[i].Start:matches[i].End]; matches[i].Kind != piiPhone || got != expected {
+			t.Errorf("Expected phone number %q, got %s %q", expected, matches[i].Kind, got)
+		}
+	}
+}
+
+func TestCheckPersonalInfo_Policies(t *testing.T) {
+	if _, err := checkPersonalInfo("text me 09171234567"); err == nil {
+		t.Error("Expected phone number to be rejected, got nil")
+	} else if verdict := err.Data["moderation"].(*ModerationVerdict); verdict.Matches[0].Category != piiPhone {
+		t.Errorf("Expected verdict category %s, got %s", piiPhone, verdict.Matches[0].Category)
+	}
+
+	masked, err := checkPersonalInfo("follow me @juan.dc")
+	if err != nil {
+		t.Fatalf("Expected social handle to be masked, got: %v", err)
+	}
+
+	if masked != "follow me ********" {
+		t.Errorf("Unexpected masked content: %q", masked)
+	}
+}
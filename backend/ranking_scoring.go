@@ -0,0 +1,229 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// RankingScoring controls how the coins spent on a recipient turn into
+// their ranking score.
+type RankingScoring struct {
+	// the most coins one sender can contribute to one recipient. 0 means
+	// there is no cap.
+	SenderCap float64
+
+	// coins added to the score for every unique sender
+	UniqueSenderBonus float64
+
+	// ignore messages sent by the recipient to themselves
+	ExcludeSelfSends bool
+}
+
+// SenderContribution is the sum of coins a sender has spent on a recipient
+type SenderContribution struct {
+	Recipient       string  `db:"recipient"`
+	Sender          string  `db:"sender"`
+	SenderStudentID string  `db:"sender_student_id"`
+	Coins           float64 `db:"coins"`
+	Messages        int     `db:"messages"`
+}
+
+func (c SenderContribution) IsSelfSend() bool {
+	return len(c.SenderStudentID) != 0 && c.SenderStudentID == c.Recipient
+}
+
+// Score computes the score of each recipient from the contributions of
+// their senders.
+func (s RankingScoring) Score(contributions []SenderContribution) map[string]float64 {
+	scores := map[string]float64{}
+	for _, contribution := range contributions {
+		if s.ExcludeSelfSends && contribution.IsSelfSend() {
+			continue
+		}
+
+		coins := contribution.Coins
+		if s.SenderCap > 0 {
+			coins = math.Min(coins, s.SenderCap)
+		}
+
+		scores[contribution.Recipient] += coins + s.UniqueSenderBonus
+	}
+
+	return scores
+}
+
+// querySenderContributions sums the coins each sender has spent on each
+// recipient of the tenant in the current season, leaving out the hidden
+// messages of shadow-banned senders. an empty recipient id returns the
+// contributions of everyone.
+func querySenderContributions(dao *daos.Dao, tenantId string, recipientId string) ([]SenderContribution, error) {
+	return querySenderContributionsBetween(dao, tenantId, recipientId, time.Time{}, time.Time{})
+}
+
+// querySenderContributionsBetween is querySenderContributions limited to
+// the messages sent from `from` until before `to`. zero times leave that
+// side of the range open.
+func querySenderContributionsBetween(dao *daos.Dao, tenantId string, recipientId string, from time.Time, to time.Time) ([]SenderContribution, error) {
+	formatBound := func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		bound, _ := types.ParseDateTime(t)
+		return bound.String()
+	}
+
+	// messages are priced with what the sender paid when they sent it.
+	// the current price of the tenant is only used for the messages saved
+	// without one.
+	contributions := []SenderContribution{}
+	err := dao.DB().NewQuery(`
+		SELECT m.recipient AS recipient, m.user AS sender,
+			COALESCE(sd.student_id, '') AS sender_student_id,
+			SUM(COALESCE(NULLIF(m.send_price, 0), {:sendPrice}) + COALESCE((
+				SELECT SUM(g.price)
+				FROM json_each(CASE WHEN json_valid(m.gifts) THEN m.gifts ELSE '[]' END) mg
+				INNER JOIN gifts g ON g.id = mg.value
+			), 0)) AS coins,
+			COUNT(m.id) AS messages
+		FROM messages m
+		LEFT JOIN user_details sd ON sd.id = m.user
+		WHERE m.recipient != 'everyone' AND m.tenant = {:tenant} AND m.season = {:season}
+			AND ({:recipient} = '' OR m.recipient = {:recipient}) AND COALESCE(m.hidden, FALSE) = FALSE
+			AND ({:from} = '' OR m.created >= {:from}) AND ({:to} = '' OR m.created < {:to})
+		GROUP BY m.recipient, m.user
+	`).Bind(dbx.Params{
+		"sendPrice": tenantSendPrice(findTenant(dao, tenantId)),
+		"recipient": recipientId,
+		"tenant":    tenantId,
+		"season":    currentSeasonId(dao),
+		"from":      formatBound(from),
+		"to":        formatBound(to),
+	}).All(&contributions)
+	if err != nil {
+		return nil, err
+	}
+
+	return contributions, nil
+}
+
+// recomputeRanking rewrites the stored total of the recipient with the
+// score computed from their messages.
+func recomputeRanking(dao *daos.Dao, tenantId string, recipientId string) error {
+	if recipientId == "everyone" {
+		return nil
+	}
+
+	contributions, err := querySenderContributions(dao, tenantId, recipientId)
+	if err != nil {
+		return err
+	}
+
+	stored := 0.0
+	if ranking, err := findRanking(dao, tenantId, recipientId); err == nil {
+		stored = ranking.GetFloat("total_coins")
+	}
+
+	score := rankingScoring.Score(contributions)[recipientId]
+	return updateRanking(dao, tenantId, recipientId, score-stored)
+}
+
+// isSelfSend reports whether the message was sent by the recipient to
+// themselves. the message should be expanded beforehand.
+func isSelfSend(message *models.Record) bool {
+	user, ok := message.Expand()["user"].(*models.Record)
+	if !ok || user == nil {
+		return false
+	}
+
+	return SenderContribution{
+		Recipient:       message.GetString("recipient"),
+		SenderStudentID: user.GetString("student_id"),
+	}.IsSelfSend()
+}
+
+// queueSelfSend queues a message the sender sent to themselves for review.
+// one pending review per sender and recipient is enough.
+func queueSelfSend(dao *daos.Dao, userId string, message *models.Record) error {
+	pending, err := dao.FindRecordsByExpr("moderation_queue",
+		dbx.HashExp{
+			"user":   userId,
+			"reason": "ranking_self_send",
+			"status": "pending",
+		},
+		dbx.NewExp("json_extract(payload, '$.recipient') = {:recipient}", dbx.Params{"recipient": message.GetString("recipient")}),
+	)
+	if err != nil || len(pending) != 0 {
+		return err
+	}
+
+	return queueForModeration(dao, userId, message, "ranking_self_send", nil)
+}
+
+// flagSuspiciousContributions queues the ranking of the recipient for
+// review when a handful of senders account for most of their coins.
+func flagSuspiciousContributions(dao *daos.Dao, tenantId string, recipientId string) error {
+	if recipientId == "everyone" {
+		return nil
+	}
+
+	contributions, err := querySenderContributions(dao, tenantId, recipientId)
+	if err != nil {
+		return err
+	}
+
+	total := 0.0
+	for _, contribution := range contributions {
+		total += contribution.Coins
+	}
+
+	if total < rankingSuspiciousMinCoins {
+		return nil
+	}
+
+	sort.Slice(contributions, func(i, j int) bool {
+		return contributions[i].Coins > contributions[j].Coins
+	})
+
+	senders, share := []string{}, 0.0
+	for _, contribution := range contributions {
+		if len(senders) >= rankingSuspiciousMaxSenders {
+			break
+		}
+
+		senders = append(senders, contribution.Sender)
+		share += contribution.Coins / total
+		if share >= rankingSuspiciousShare {
+			break
+		}
+	}
+
+	if share < rankingSuspiciousShare {
+		return nil
+	}
+
+	ranking, err := findRanking(dao, tenantId, recipientId)
+	if err != nil {
+		return err
+	}
+
+	// one pending review per ranking is enough
+	if pending, err := dao.FindRecordsByExpr("moderation_queue", dbx.HashExp{
+		"record": ranking.Id,
+		"reason": "ranking_concentration",
+		"status": "pending",
+	}); err != nil || len(pending) != 0 {
+		return err
+	}
+
+	return queueForModeration(dao, senders[0], ranking, "ranking_concentration", map[string]any{
+		"senders":     senders,
+		"share":       share,
+		"total_coins": total,
+	})
+}
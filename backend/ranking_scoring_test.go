@@ -0,0 +1,182 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/pocketbase/dbx"
+)
+
+func TestRankingScoring_Score(t *testing.T) {
+	contributions := []SenderContribution{
+		{Recipient: "202000000001", Sender: "a", Coins: 1500},
+		{Recipient: "202000000001", Sender: "b", Coins: 150},
+		{Recipient: "202000000001", Sender: "c", SenderStudentID: "202000000001", Coins: 3000},
+		{Recipient: "202000000002", Sender: "a", Coins: 300},
+	}
+
+	testCases := []struct {
+		name     string
+		scoring  RankingScoring
+		expected map[string]float64
+	}{
+		{"plain", RankingScoring{}, map[string]float64{"202000000001": 4650, "202000000002": 300}},
+		{"self sends", RankingScoring{ExcludeSelfSends: true}, map[string]float64{"202000000001": 1650, "202000000002": 300}},
+		{"sender cap", RankingScoring{SenderCap: 500, ExcludeSelfSends: true}, map[string]float64{"202000000001": 650, "202000000002": 300}},
+		{"unique senders", RankingScoring{UniqueSenderBonus: 100, ExcludeSelfSends: true}, map[string]float64{"202000000001": 1850, "202000000002": 400}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			scores := tc.scoring.Score(contributions)
+			for recipient, expected := range tc.expected {
+				if scores[recipient] != expected {
+					t.Errorf("Expected %s to score %f, got %f", recipient, expected, scores[recipient])
+				}
+			}
+		})
+	}
+}
+
+func TestRecomputeRanking_SelfSend(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Cleanup()
+
+	dao := app.Dao()
+	self := newTestUserDetails(t, app)
+	if err := dao.SaveRecord(self); err != nil {
+		t.Fatalf("Failed to save user details: %v", err)
+	}
+
+	saveTestMessage(t, app, self.Id, self.GetString("student_id"), "Happy valentines to me")
+	saveTestMessage(t, app, "sender2", self.GetString("student_id"), "Happy valentines!")
+
+	if err := recomputeRanking(dao, defaultTenant, self.GetString("student_id")); err != nil {
+		t.Fatalf("recomputeRanking failed: %v", err)
+	}
+
+	ranking, err := dao.FindFirstRecordByData("rankings", "recipient", self.GetString("student_id"))
+	if err != nil {
+		t.Fatalf("Failed to find ranking: %v", err)
+	}
+
+	if ranking.GetFloat("total_coins") != sendPrice {
+		t.Errorf("Expected self-sends to be excluded, got %f coins", ranking.GetFloat("total_coins"))
+	}
+}
+
+func TestRecomputeRanking_StoredSendPrice(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Cleanup()
+
+	dao := app.Dao()
+	rose := saveTestGift(t, app, "rose", 10, false)
+	chocolate := saveTestGift(t, app, "chocolate", 20, false)
+
+	// sent while the campus charged 100
+	paid := saveTestMessage(t, app, "sender1", "202000000001", "Happy valentines!")
+	paid.Set("send_price", 100)
+	paid.Set("gifts", []string{rose.Id, chocolate.Id})
+	if err := dao.SaveRecord(paid); err != nil {
+		t.Fatal(err)
+	}
+
+	// saved without a price, e.g. before prices were stored
+	saveTestMessage(t, app, "sender2", "202000000001", "See you later")
+
+	if err := recomputeRanking(dao, defaultTenant, "202000000001"); err != nil {
+		t.Fatalf("recomputeRanking failed: %v", err)
+	}
+
+	ranking, err := findRanking(dao, defaultTenant, "202000000001")
+	if err != nil {
+		t.Fatalf("Failed to find ranking: %v", err)
+	}
+
+	if expected := 100 + 10 + 20 + sendPrice; ranking.GetFloat("total_coins") != expected {
+		t.Errorf("Expected %f coins, got %f", expected, ranking.GetFloat("total_coins"))
+	}
+}
+
+func TestQueueSelfSend(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Cleanup()
+
+	dao := app.Dao()
+	for i := 0; i < 3; i++ {
+		message := saveTestMessage(t, app, "sender1", "202000000001", "Happy valentines to me")
+		if err := queueSelfSend(dao, "sender1", message); err != nil {
+			t.Fatalf("queueSelfSend failed: %v", err)
+		}
+	}
+
+	entries, _ := dao.FindRecordsByExpr("moderation_queue", dbx.HashExp{"reason": "ranking_self_send"})
+	if len(entries) != 1 {
+		t.Fatalf("Expected one pending review for the sender, got %d", len(entries))
+	}
+
+	// a new review is queued once the previous one has been handled
+	entries[0].Set("status", "approved")
+	dao.SaveRecord(entries[0])
+
+	message := saveTestMessage(t, app, "sender1", "202000000001", "Happy valentines to me again")
+	if err := queueSelfSend(dao, "sender1", message); err != nil {
+		t.Fatalf("queueSelfSend failed: %v", err)
+	}
+
+	if entries, _ := dao.FindRecordsByExpr("moderation_queue", dbx.HashExp{"reason": "ranking_self_send"}); len(entries) != 2 {
+		t.Errorf("Expected a new review after the previous one was handled, got %d", len(entries))
+	}
+}
+
+func TestFlagSuspiciousContributions(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Cleanup()
+
+	dao := app.Dao()
+	for i := 0; i < 8; i++ {
+		saveTestMessage(t, app, "sender1", "202000000001", "Happy valentines!")
+	}
+	saveTestMessage(t, app, "sender2", "202000000001", "See you later")
+
+	if err := recomputeRanking(dao, defaultTenant, "202000000001"); err != nil {
+		t.Fatalf("recomputeRanking failed: %v", err)
+	}
+
+	// flagging twice should only queue one review
+	for i := 0; i < 2; i++ {
+		if err := flagSuspiciousContributions(dao, defaultTenant, "202000000001"); err != nil {
+			t.Fatalf("flagSuspiciousContributions failed: %v", err)
+		}
+	}
+
+	entries, err := dao.FindRecordsByExpr("moderation_queue", dbx.HashExp{"reason": "ranking_concentration"})
+	if err != nil {
+		t.Fatalf("Failed to find moderation queue entries: %v", err)
+	}
+
+	if len(entries) != 1 || entries[0].GetString("user") != "sender1" {
+		t.Errorf("Expected one review for sender1, got %d entries", len(entries))
+	}
+}
+
+func TestFlagSuspiciousContributions_SpreadOut(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Cleanup()
+
+	dao := app.Dao()
+	for _, sender := range []string{"sender1", "sender2", "sender3", "sender4", "sender5", "sender6", "sender7"} {
+		saveTestMessage(t, app, sender, "202000000001", "Happy valentines!")
+	}
+
+	if err := recomputeRanking(dao, defaultTenant, "202000000001"); err != nil {
+		t.Fatalf("recomputeRanking failed: %v", err)
+	}
+
+	if err := flagSuspiciousContributions(dao, defaultTenant, "202000000001"); err != nil {
+		t.Fatalf("flagSuspiciousContributions failed: %v", err)
+	}
+
+	if entries, _ := dao.FindRecordsByExpr("moderation_queue"); len(entries) != 0 {
+		t.Errorf("Expected no reviews, got %d", len(entries))
+	}
+}
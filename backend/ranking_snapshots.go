@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/daos"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+var errSnapshotImmutable = errors.New("ranking snapshots cannot be modified")
+
+type RankingSnapshotEntry struct {
+	Rank        int     `json:"rank"`
+	RecipientID string  `json:"recipient_id"`
+	Department  string  `json:"department"`
+	Sex         string  `json:"sex"`
+	TotalCoins  float32 `json:"total_coins"`
+}
+
+type RankingSnapshot struct {
+	ID      string                  `json:"id"`
+	Season  string                  `json:"season"`
+	TakenAt types.DateTime          `json:"taken_at"`
+	Entries []*RankingSnapshotEntry `json:"entries"`
+}
+
+func newRankingSnapshot(record *models.Record) (*RankingSnapshot, error) {
+	snapshot := &RankingSnapshot{
+		ID:      record.Id,
+		Season:  record.GetString("season"),
+		TakenAt: record.GetDateTime("taken_at"),
+		Entries: []*RankingSnapshotEntry{},
+	}
+
+	if raw, ok := record.Get("entries").(types.JsonRaw); ok && len(raw) != 0 {
+		if err := json.Unmarshal(raw, &snapshot.Entries); err != nil {
+			return nil, err
+		}
+	}
+
+	return snapshot, nil
+}
+
+// Top returns a copy of the snapshot with only the first n entries
+func (s *RankingSnapshot) Top(n int) *RankingSnapshot {
+	top := *s
+	if n > 0 && n < len(top.Entries) {
+		top.Entries = top.Entries[:n]
+	}
+	return &top
+}
+
+// takeRankingSnapshot saves the leaderboard of the season for the
+// recipients in the tenant who are listed publicly.
+func takeRankingSnapshot(dao *daos.Dao, tenantId string, season string, at time.Time) (*models.Record, error) {
+	recipients, err := queryLeaderboard(dao, tenantId, season, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if rankingSnapshotSize > 0 && len(recipients) > rankingSnapshotSize {
+		recipients = recipients[:rankingSnapshotSize]
+	}
+
+	entries := make([]*RankingSnapshotEntry, len(recipients))
+	for i, recipient := range recipients {
+		entries[i] = &RankingSnapshotEntry{
+			Rank:        i + 1,
+			RecipientID: recipient.RecipientID,
+			Department:  recipient.Department,
+			Sex:         recipient.Sex,
+			TotalCoins:  recipient.TotalCoins,
+		}
+	}
+
+	collection, err := dao.FindCollectionByNameOrId("ranking_snapshots")
+	if err != nil {
+		return nil, err
+	}
+
+	takenAt, err := types.ParseDateTime(at)
+	if err != nil {
+		return nil, err
+	}
+
+	record := models.NewRecord(collection)
+	record.Set("tenant", tenantId)
+	record.Set("season", season)
+	record.Set("taken_at", takenAt)
+	record.Set("entries", entries)
+	if err := dao.SaveRecord(record); err != nil {
+		return nil, err
+	}
+
+	return record, nil
+}
+
+// findRankingSnapshot finds a snapshot of the tenant by its id. "latest"
+// returns the most recent snapshot of the season or of any season if it is
+// empty.
+func findRankingSnapshot(dao *daos.Dao, tenantId string, id string, season string) (*RankingSnapshot, error) {
+	if id != "latest" {
+		record, err := dao.FindRecordById("ranking_snapshots", id, func(q *dbx.SelectQuery) error {
+			q.AndWhere(dbx.HashExp{"tenant": tenantId})
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return newRankingSnapshot(record)
+	}
+
+	collection, err := dao.FindCollectionByNameOrId("ranking_snapshots")
+	if err != nil {
+		return nil, err
+	}
+
+	query := dao.RecordQuery(collection).
+		AndWhere(dbx.HashExp{"tenant": tenantId}).
+		OrderBy("taken_at DESC").
+		Limit(1)
+	if len(season) != 0 {
+		query.AndWhere(dbx.HashExp{"season": season})
+	}
+
+	row := dbx.NullStringMap{}
+	if err := query.One(row); err != nil {
+		return nil, err
+	}
+
+	return newRankingSnapshot(models.NewRecordFromNullStringMap(collection, row))
+}
+
+func exportRankingSnapshot(w io.Writer, snapshot *RankingSnapshot, format string) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(snapshot)
+	case "csv":
+		writer := csv.NewWriter(w)
+		writer.Write([]string{"rank", "recipient_id", "department", "sex", "total_coins"})
+		for _, entry := range snapshot.Entries {
+			writer.Write([]string{
+				strconv.Itoa(entry.Rank),
+				entry.RecipientID,
+				entry.Department,
+				entry.Sex,
+				strconv.FormatFloat(float64(entry.TotalCoins), 'f', 2, 32),
+			})
+		}
+		writer.Flush()
+		return writer.Error()
+	default:
+		return fmt.Errorf("unknown export format '%s'", format)
+	}
+}
+
+// takeRankingSnapshots periodically snapshots the leaderboard of every
+// tenant for the current season.
+func takeRankingSnapshots(app core.App, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		for _, tenantId := range tenantIds(app.Dao()) {
+			if _, err := takeRankingSnapshot(app.Dao(), tenantId, currentSeasonId(app.Dao()), time.Now()); err != nil {
+				passivePrintError(err)
+			}
+		}
+	}
+}
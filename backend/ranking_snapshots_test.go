@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTakeRankingSnapshot(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Cleanup()
+
+	dao := app.Dao()
+	saveTestRanking(t, app, "202000000001", 0)
+	saveTestRanking(t, app, "202000000002", 0)
+	hidden := saveTestRanking(t, app, "202000000003", 0)
+	hidden.Set("hidden", true)
+	dao.SaveRecord(hidden)
+
+	for recipient, coins := range map[string]float64{"202000000001": 150, "202000000002": 300, "202000000003": 1000} {
+		addTestRankingBucket(t, dao, defaultTenant, recipient, time.Now(), coins)
+	}
+
+	first, err := takeRankingSnapshot(dao, defaultTenant, "2023", time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("takeRankingSnapshot failed: %v", err)
+	}
+
+	second, err := takeRankingSnapshot(dao, defaultTenant, "2023", time.Now())
+	if err != nil {
+		t.Fatalf("takeRankingSnapshot failed: %v", err)
+	}
+
+	snapshot, err := findRankingSnapshot(dao, defaultTenant, "latest", "2023")
+	if err != nil {
+		t.Fatalf("findRankingSnapshot failed: %v", err)
+	}
+
+	if snapshot.ID != second.Id {
+		t.Errorf("Expected latest snapshot to be %s, got %s", second.Id, snapshot.ID)
+	}
+
+	if len(snapshot.Entries) != 2 || snapshot.Entries[0].RecipientID != "202000000002" || snapshot.Entries[0].Rank != 1 {
+		t.Errorf("Unexpected snapshot entries: %+v", snapshot.Entries)
+	}
+
+	if top := snapshot.Top(1); len(top.Entries) != 1 || len(snapshot.Entries) != 2 {
+		t.Errorf("Expected top to only keep the first entry without changing the snapshot")
+	}
+
+	if _, err := findRankingSnapshot(dao, defaultTenant, "latest", "2024"); err == nil {
+		t.Errorf("Expected no snapshot for another season")
+	}
+
+	if found, err := findRankingSnapshot(dao, defaultTenant, first.Id, ""); err != nil || found.ID != first.Id {
+		t.Errorf("Expected to find snapshot %s, got %v (err: %v)", first.Id, found, err)
+	}
+}
+
+func TestExportRankingSnapshot(t *testing.T) {
+	snapshot := &RankingSnapshot{
+		Season: "2023",
+		Entries: []*RankingSnapshotEntry{
+			{Rank: 1, RecipientID: "202000000002", Department: "ccs", Sex: "female", TotalCoins: 300},
+			{Rank: 2, RecipientID: "202000000001", Department: "unknown", Sex: "unknown", TotalCoins: 150},
+		},
+	}
+
+	csvOutput := &bytes.Buffer{}
+	if err := exportRankingSnapshot(csvOutput, snapshot, "csv"); err != nil {
+		t.Fatalf("exportRankingSnapshot failed: %v", err)
+	}
+
+	expected := "rank,recipient_id,department,sex,total_coins\n" +
+		"1,202000000002,ccs,female,300.00\n" +
+		"2,202000000001,unknown,unknown,150.00\n"
+	if csvOutput.String() != expected {
+		t.Errorf("Unexpected CSV output:\n%s", csvOutput.String())
+	}
+
+	jsonOutput := &bytes.Buffer{}
+	if err := exportRankingSnapshot(jsonOutput, snapshot, "json"); err != nil {
+		t.Fatalf("exportRankingSnapshot failed: %v", err)
+	}
+
+	if !strings.Contains(jsonOutput.String(), `"recipient_id": "202000000002"`) {
+		t.Errorf("Unexpected JSON output:\n%s", jsonOutput.String())
+	}
+
+	if err := exportRankingSnapshot(jsonOutput, snapshot, "xml"); err == nil {
+		t.Errorf("Expected unknown formats to be rejected")
+	}
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/daos"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/spf13/cobra"
+)
+
+// RankingDiff compares the stored total of a recipient in the rankings
+// collection with the one computed from the messages and gifts.
+type RankingDiff struct {
+	Recipient string
+	Stored    float64
+	Computed  float64
+}
+
+func (d RankingDiff) Delta() float64 {
+	return d.Computed - d.Stored
+}
+
+// findRanking returns the ranking of the recipient in the tenant for the
+// current season
+func findRanking(dao *daos.Dao, tenantId string, recipientId string) (*models.Record, error) {
+	rankings, err := dao.FindRecordsByExpr("rankings", dbx.HashExp{
+		"recipient": recipientId,
+		"tenant":    tenantId,
+		"season":    currentSeasonId(dao),
+	})
+	if err != nil {
+		return nil, err
+	} else if len(rankings) == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	return rankings[0], nil
+}
+
+// applyRecipientDetails copies the department, sex and leaderboard
+// preference of the recipient to their ranking. recipients who have not
+// signed up yet are left as unknown.
+func applyRecipientDetails(dao *daos.Dao, ranking *models.Record, details *models.Record) {
+	department, sex := "unknown", "unknown"
+	if details != nil {
+		if cDept, err := dao.FindRecordById("college_departments", details.GetString("college_department")); err == nil {
+			department = cDept.Id
+		}
+
+		if s := details.GetString("sex"); len(s) != 0 {
+			sex = s
+		}
+	}
+
+	ranking.Set("college_department", department)
+	ranking.Set("sex", sex)
+	ranking.Set("hidden", isHiddenFromLeaderboards(details))
+}
+
+// syncRankingDetails updates the ranking of the student, if they have
+// received any messages yet, after their details have changed.
+func syncRankingDetails(dao *daos.Dao, details *models.Record) error {
+	ranking, err := findRanking(dao, details.GetString("tenant"), details.GetString("student_id"))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	applyRecipientDetails(dao, ranking, details)
+	return dao.SaveRecord(ranking)
+}
+
+// computeRankingTotals computes the score of each recipient in the tenant
+// from the send price of every message plus the price of its gifts,
+// following rankingScoring.
+func computeRankingTotals(dao *daos.Dao, tenantId string) (map[string]float64, error) {
+	contributions, err := querySenderContributions(dao, tenantId, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return rankingScoring.Score(contributions), nil
+}
+
+// diffRankings returns the recipients of the tenant whose stored totals in
+// the current season do not match the computed ones, sorted by recipient.
+func diffRankings(dao *daos.Dao, tenantId string) ([]RankingDiff, error) {
+	computed, err := computeRankingTotals(dao, tenantId)
+	if err != nil {
+		return nil, err
+	}
+
+	rankings, err := dao.FindRecordsByExpr("rankings", dbx.HashExp{
+		"tenant": tenantId,
+		"season": currentSeasonId(dao),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	diffs := []RankingDiff{}
+	for _, ranking := range rankings {
+		recipient := ranking.GetString("recipient")
+		diff := RankingDiff{
+			Recipient: recipient,
+			Stored:    ranking.GetFloat("total_coins"),
+			Computed:  computed[recipient],
+		}
+
+		delete(computed, recipient)
+		if math.Abs(diff.Delta()) >= 0.01 {
+			diffs = append(diffs, diff)
+		}
+	}
+
+	// recipients without a ranking record
+	for recipient, total := range computed {
+		if total != 0 {
+			diffs = append(diffs, RankingDiff{Recipient: recipient, Computed: total})
+		}
+	}
+
+	sort.Slice(diffs, func(i, j int) bool {
+		return diffs[i].Recipient < diffs[j].Recipient
+	})
+
+	return diffs, nil
+}
+
+// applyRankingDiffs rewrites the stored totals with the computed ones
+func applyRankingDiffs(dao *daos.Dao, tenantId string, diffs []RankingDiff) error {
+	return dao.RunInTransaction(func(txDao *daos.Dao) error {
+		for _, diff := range diffs {
+			if err := updateRanking(txDao, tenantId, diff.Recipient, diff.Delta()); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// watchRankingsDrift periodically compares the stored and computed totals
+// and logs an alert when they disagree.
+func watchRankingsDrift(app core.App, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		for _, tenantId := range tenantIds(app.Dao()) {
+			diffs, err := diffRankings(app.Dao(), tenantId)
+			if err != nil {
+				passivePrintError(err)
+				continue
+			}
+
+			if len(diffs) != 0 {
+				log.Printf("[rankings] ALERT: stored totals of %d recipient(s) in %s do not match their messages. run `rankings rebuild --tenant %s` to review.\n", len(diffs), tenantId, tenantId)
+			}
+		}
+	}
+}
+
+func newRankingsCommand(app core.App) *cobra.Command {
+	command := &cobra.Command{
+		Use:   "rankings",
+		Short: "Manage the recipient rankings",
+	}
+
+	var tenantId string
+	command.PersistentFlags().StringVar(&tenantId, "tenant", defaultTenant, "tenant of the rankings")
+
+	var shouldWrite bool
+	rebuildCommand := &cobra.Command{
+		Use:   "rebuild",
+		Short: "Recompute the rankings from messages and gifts",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			diffs, err := diffRankings(app.Dao(), tenantId)
+			if err != nil {
+				return err
+			}
+
+			if len(diffs) == 0 {
+				fmt.Println("Rankings are up to date.")
+				return nil
+			}
+
+			writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(writer, "RECIPIENT\tSTORED\tCOMPUTED\tDELTA")
+			for _, diff := range diffs {
+				fmt.Fprintf(writer, "%s\t%.2f\t%.2f\t%+.2f\n", diff.Recipient, diff.Stored, diff.Computed, diff.Delta())
+			}
+			writer.Flush()
+
+			if !shouldWrite {
+				fmt.Printf("\n%d ranking(s) differ. Run again with --write to update them.\n", len(diffs))
+				return nil
+			}
+
+			if err := applyRankingDiffs(app.Dao(), tenantId, diffs); err != nil {
+				return err
+			}
+
+			fmt.Printf("\n%d ranking(s) have been updated.\n", len(diffs))
+			return nil
+		},
+	}
+
+	rebuildCommand.Flags().BoolVar(&shouldWrite, "write", false, "rewrite the stored totals with the computed ones")
+
+	var season string
+	snapshotCommand := &cobra.Command{
+		Use:   "snapshot",
+		Short: "Save a snapshot of the current leaderboard",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(season) == 0 {
+				season = currentSeasonId(app.Dao())
+			}
+
+			record, err := takeRankingSnapshot(app.Dao(), tenantId, season, time.Now())
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Snapshot %s has been saved.\n", record.Id)
+			return nil
+		},
+	}
+
+	snapshotCommand.Flags().StringVar(&season, "season", "", "season to tag the snapshot with (defaults to the current one)")
+
+	var format, exportSeason string
+	var limit int
+	exportCommand := &cobra.Command{
+		Use:   "export [snapshot id]",
+		Short: "Export a leaderboard snapshot as JSON or CSV",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id := "latest"
+			if len(args) != 0 {
+				id = args[0]
+			}
+
+			snapshot, err := findRankingSnapshot(app.Dao(), tenantId, id, exportSeason)
+			if err != nil {
+				return err
+			}
+
+			return exportRankingSnapshot(os.Stdout, snapshot.Top(limit), format)
+		},
+	}
+
+	exportCommand.Flags().StringVar(&format, "format", "json", "export format (json or csv)")
+	exportCommand.Flags().StringVar(&exportSeason, "season", "", "season of the latest snapshot")
+	exportCommand.Flags().IntVar(&limit, "limit", 0, "number of entries to export (0 for all)")
+
+	command.AddCommand(rebuildCommand, snapshotCommand, exportCommand)
+	return command
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/tests"
+)
+
+func saveTestGift(t *testing.T, app *tests.TestApp, uid string, price float64, isRemittable bool) *models.Record {
+	t.Helper()
+
+	collection, _ := app.Dao().FindCollectionByNameOrId("gifts")
+	gift := models.NewRecord(collection)
+	gift.Set("uid", uid)
+	gift.Set("label", uid)
+	gift.Set("price", price)
+	gift.Set("is_remittable", isRemittable)
+	if err := app.Dao().SaveRecord(gift); err != nil {
+		t.Fatalf("Failed to save gift: %v", err)
+	}
+
+	return gift
+}
+
+func saveTestRanking(t *testing.T, app *tests.TestApp, recipient string, totalCoins float64) *models.Record {
+	t.Helper()
+
+	collection, _ := app.Dao().FindCollectionByNameOrId("rankings")
+	ranking := models.NewRecord(collection)
+	ranking.Set("recipient", recipient)
+	ranking.Set("total_coins", totalCoins)
+	ranking.Set("college_department", "unknown")
+	ranking.Set("sex", "unknown")
+	ranking.Set("hidden", false)
+	ranking.Set("season", currentSeason)
+	ranking.Set("tenant", defaultTenant)
+	if err := app.Dao().SaveRecord(ranking); err != nil {
+		t.Fatalf("Failed to save ranking: %v", err)
+	}
+
+	return ranking
+}
+
+func seedRankingMessages(t *testing.T, app *tests.TestApp) {
+	t.Helper()
+
+	rose := saveTestGift(t, app, "rose", 50, false)
+	chocolate := saveTestGift(t, app, "chocolate", 30, true)
+
+	withGifts := saveTestMessage(t, app, "sender1", "202000000001", "Happy valentines!")
+	withGifts.Set("gifts", []string{rose.Id, chocolate.Id})
+	if err := app.Dao().SaveRecord(withGifts); err != nil {
+		t.Fatalf("Failed to save message gifts: %v", err)
+	}
+
+	saveTestMessage(t, app, "sender2", "202000000001", "See you later")
+
+	single := saveTestMessage(t, app, "sender1", "202000000002", "Hello there")
+	single.Set("gifts", []string{rose.Id})
+	if err := app.Dao().SaveRecord(single); err != nil {
+		t.Fatalf("Failed to save message gifts: %v", err)
+	}
+
+	saveTestMessage(t, app, "sender1", "everyone", "Hello everyone")
+}
+
+func TestComputeRankingTotals(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Cleanup()
+
+	seedRankingMessages(t, app)
+
+	totals, err := computeRankingTotals(app.Dao(), defaultTenant)
+	if err != nil {
+		t.Fatalf("computeRankingTotals failed: %v", err)
+	}
+
+	expected := map[string]float64{
+		"202000000001": 2*sendPrice + 80,
+		"202000000002": sendPrice + 50,
+	}
+
+	if len(totals) != len(expected) {
+		t.Fatalf("Expected %d totals, got %d: %v", len(expected), len(totals), totals)
+	}
+
+	for recipient, total := range expected {
+		if totals[recipient] != total {
+			t.Errorf("Expected %s to have %f coins, got %f", recipient, total, totals[recipient])
+		}
+	}
+}
+
+func TestDiffRankings_AndRebuild(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Cleanup()
+
+	seedRankingMessages(t, app)
+	saveTestRanking(t, app, "202000000001", 2*sendPrice)
+	saveTestRanking(t, app, "202000000003", 100)
+
+	diffs, err := diffRankings(app.Dao(), defaultTenant)
+	if err != nil {
+		t.Fatalf("diffRankings failed: %v", err)
+	}
+
+	expected := []RankingDiff{
+		{Recipient: "202000000001", Stored: 2 * sendPrice, Computed: 2*sendPrice + 80},
+		{Recipient: "202000000002", Stored: 0, Computed: sendPrice + 50},
+		{Recipient: "202000000003", Stored: 100, Computed: 0},
+	}
+
+	if len(diffs) != len(expected) {
+		t.Fatalf("Expected %d diffs, got %d: %v", len(expected), len(diffs), diffs)
+	}
+
+	for i, diff := range diffs {
+		if diff != expected[i] {
+			t.Errorf("Expected diff %v, got %v", expected[i], diff)
+		}
+	}
+
+	if err := applyRankingDiffs(app.Dao(), defaultTenant, diffs); err != nil {
+		t.Fatalf("applyRankingDiffs failed: %v", err)
+	}
+
+	if diffs, err := diffRankings(app.Dao(), defaultTenant); err != nil || len(diffs) != 0 {
+		t.Errorf("Expected rankings to be up to date after rebuild, got %v (err: %v)", diffs, err)
+	}
+}
+
+func TestSyncRankingDetails(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Cleanup()
+
+	dao := app.Dao()
+	ccs := saveTestDepartment(t, app, "ccs")
+	cba := saveTestDepartment(t, app, "cba")
+
+	// received messages before signing up
+	if err := updateRanking(dao, defaultTenant, "202012345678", sendPrice); err != nil {
+		t.Fatalf("updateRanking failed: %v", err)
+	}
+
+	details := newTestUserDetails(t, app)
+	details.Set("college_department", ccs.Id)
+	details.Set("sex", "female")
+	if err := dao.SaveRecord(details); err != nil {
+		t.Fatalf("Failed to save user details: %v", err)
+	}
+
+	if err := syncRankingDetails(dao, details); err != nil {
+		t.Fatalf("syncRankingDetails failed: %v", err)
+	}
+
+	ranking, _ := dao.FindFirstRecordByData("rankings", "recipient", "202012345678")
+	if ranking.GetString("college_department") != ccs.Id || ranking.GetString("sex") != "female" {
+		t.Errorf("Expected ranking to be linked to the details, got department %q and sex %q",
+			ranking.GetString("college_department"), ranking.GetString("sex"))
+	}
+
+	// changed department later on
+	details.Set("college_department", cba.Id)
+	if err := syncRankingDetails(dao, details); err != nil {
+		t.Fatalf("syncRankingDetails failed: %v", err)
+	}
+
+	ranking, _ = dao.FindFirstRecordByData("rankings", "recipient", "202012345678")
+	if ranking.GetString("college_department") != cba.Id {
+		t.Errorf("Expected ranking department to be %q, got %q", cba.Id, ranking.GetString("college_department"))
+	}
+
+	// departments that do not exist are not copied
+	details.Set("college_department", "missing")
+	if err := updateRanking(dao, defaultTenant, "202012345678", sendPrice); err != nil {
+		t.Fatalf("updateRanking failed: %v", err)
+	}
+
+	if err := syncRankingDetails(dao, details); err != nil {
+		t.Fatalf("syncRankingDetails failed: %v", err)
+	}
+
+	ranking, _ = dao.FindFirstRecordByData("rankings", "recipient", "202012345678")
+	if ranking.GetString("college_department") != "unknown" {
+		t.Errorf("Expected unknown department, got %q", ranking.GetString("college_department"))
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v5"
+	"github.com/patrickmn/go-cache"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/models"
+)
+
+// RateLimit allows Burst requests at once which are then refilled
+// at Rate tokens per second.
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// parseRateLimit parses limits in the form of "<count>/<period>"
+// (e.g. "5/1m") where the count is also used as the burst size.
+func parseRateLimit(str string) (RateLimit, error) {
+	rawCount, rawPeriod, found := strings.Cut(str, "/")
+	if !found {
+		return RateLimit{}, fmt.Errorf("invalid rate limit '%s'", str)
+	}
+
+	count, err := strconv.Atoi(rawCount)
+	if err != nil {
+		return RateLimit{}, err
+	}
+
+	period, err := time.ParseDuration(rawPeriod)
+	if err != nil {
+		return RateLimit{}, err
+	} else if count <= 0 || period <= 0 {
+		return RateLimit{}, fmt.Errorf("invalid rate limit '%s'", str)
+	}
+
+	return RateLimit{Rate: float64(count) / period.Seconds(), Burst: count}, nil
+}
+
+// RateLimitStore keeps track of the token buckets. The in-memory store is
+// used by default but it can be swapped with a shared one (e.g. redis)
+// when running multiple instances.
+type RateLimitStore interface {
+	// Take consumes a token from each of the buckets identified by keys
+	// only if all of them have one. Otherwise nothing is consumed and it
+	// returns false and the time until every bucket has a token again.
+	Take(keys []string, limit RateLimit, now time.Time) (bool, time.Duration)
+}
+
+type tokenBucket struct {
+	tokens    float64
+	updatedAt time.Time
+}
+
+// refill adds the tokens gained since the last update. It returns the
+// time until the bucket has a token or 0 if it already has one.
+func (b *tokenBucket) refill(limit RateLimit, now time.Time) time.Duration {
+	elapsed := now.Sub(b.updatedAt).Seconds()
+	if elapsed > 0 {
+		b.tokens = math.Min(float64(limit.Burst), b.tokens+elapsed*limit.Rate)
+		b.updatedAt = now
+	}
+
+	if b.tokens >= 1 {
+		return 0
+	}
+
+	return time.Duration((1 - b.tokens) / limit.Rate * float64(time.Second))
+}
+
+type memoryRateLimitStore struct {
+	mu      sync.Mutex
+	buckets *cache.Cache
+}
+
+func newMemoryRateLimitStore() *memoryRateLimitStore {
+	return &memoryRateLimitStore{
+		buckets: cache.New(10*time.Minute, 5*time.Minute),
+	}
+}
+
+func (s *memoryRateLimitStore) Take(keys []string, limit RateLimit, now time.Time) (bool, time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	buckets := make([]*tokenBucket, len(keys))
+	retryAfter := time.Duration(0)
+	for i, key := range keys {
+		buckets[i] = &tokenBucket{tokens: float64(limit.Burst), updatedAt: now}
+		if cached, found := s.buckets.Get(key); found {
+			buckets[i] = cached.(*tokenBucket)
+		}
+
+		if wait := buckets[i].refill(limit, now); wait > retryAfter {
+			retryAfter = wait
+		}
+	}
+
+	allowed := retryAfter == 0
+
+	// idle buckets are full again after this duration so they can be dropped
+	refillDuration := time.Duration(float64(limit.Burst) / limit.Rate * float64(time.Second))
+	for i, key := range keys {
+		if allowed {
+			buckets[i].tokens--
+		}
+		s.buckets.Set(key, buckets[i], refillDuration+time.Minute)
+	}
+
+	return allowed, retryAfter
+}
+
+type RateLimiter struct {
+	Store  RateLimitStore
+	Limits map[string]RateLimit
+}
+
+// Allow takes a token from the bucket of each key for the given route if
+// every bucket has one. Routes without a configured limit are always
+// allowed.
+func (rl *RateLimiter) Allow(route string, keys ...string) (bool, time.Duration) {
+	limit, hasLimit := rl.Limits[route]
+	if !hasLimit || rl.Store == nil {
+		return true, 0
+	}
+
+	routeKeys := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if len(key) != 0 {
+			routeKeys = append(routeKeys, route+"/"+key)
+		}
+	}
+
+	if len(routeKeys) == 0 {
+		return true, 0
+	}
+
+	return rl.Store.Take(routeKeys, limit, time.Now())
+}
+
+// requestRateLimitKeys returns the keys of the client IP and the auth
+// record of the request.
+func requestRateLimitKeys(c echo.Context) []string {
+	if c == nil {
+		return nil
+	}
+
+	keys := []string{"ip:" + c.RealIP()}
+	if authRecord, _ := c.Get(apis.ContextAuthRecordKey).(*models.Record); authRecord != nil {
+		keys = append(keys, "auth:"+authRecord.Id)
+	}
+	return keys
+}
+
+func tooManyRequestsError(c echo.Context, retryAfter time.Duration) error {
+	if c != nil {
+		c.Response().Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	}
+	return apis.NewApiError(http.StatusTooManyRequests, "You are doing that too often. Please try again later.", nil)
+}
+
+// rateLimitRoute maps the write endpoints to their configured limit. record
+// creates are limited by CheckRecord instead so that the sender is checked
+// along with the IP and auth record.
+func rateLimitRoute(method, path string) string {
+	switch {
+	case method == http.MethodGet && path == "/user_messages/archive":
+		return "archive"
+	default:
+		return ""
+	}
+}
+
+// Middleware limits the write endpoints by client IP and auth record
+func (rl *RateLimiter) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			route := rateLimitRoute(c.Request().Method, c.Request().URL.Path)
+			if len(route) == 0 {
+				return next(c)
+			}
+
+			if allowed, retryAfter := rl.Allow(route, requestRateLimitKeys(c)...); !allowed {
+				return tooManyRequestsError(c, retryAfter)
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// CheckRecord limits record creation by the client IP, auth record and the
+// sender's student ID at once so that no token is spent unless all of them
+// allow it. This also covers create requests made through the collection
+// ID instead of its name.
+func (rl *RateLimiter) CheckRecord(e *core.RecordCreateEvent, studentId string) error {
+	keys := requestRateLimitKeys(e.HttpContext)
+	if len(studentId) != 0 {
+		keys = append(keys, "student:"+studentId)
+	}
+
+	if allowed, retryAfter := rl.Allow(e.Record.Collection().Name, keys...); !allowed {
+		return tooManyRequestsError(e.HttpContext, retryAfter)
+	}
+
+	return nil
+}
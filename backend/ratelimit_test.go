@@ -0,0 +1,203 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v5"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/models"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	limit, err := parseRateLimit("5/1m")
+	if err != nil {
+		t.Fatalf("parseRateLimit failed: %v", err)
+	}
+
+	if limit.Burst != 5 {
+		t.Errorf("Expected burst 5, got %d", limit.Burst)
+	}
+
+	if expected := 5.0 / 60; limit.Rate != expected {
+		t.Errorf("Expected rate %f, got %f", expected, limit.Rate)
+	}
+
+	for _, invalid := range []string{"5", "a/1m", "5/x", "0/1m"} {
+		if _, err := parseRateLimit(invalid); err == nil {
+			t.Errorf("Expected error for '%s', got nil", invalid)
+		}
+	}
+}
+
+func TestMemoryRateLimitStore_TakeAndRefill(t *testing.T) {
+	store := newMemoryRateLimitStore()
+	limit := RateLimit{Rate: 1, Burst: 2}
+	now := time.Now()
+
+	for i := 0; i < 2; i++ {
+		if allowed, _ := store.Take([]string{"key"}, limit, now); !allowed {
+			t.Fatalf("Expected request %d to be allowed", i+1)
+		}
+	}
+
+	allowed, retryAfter := store.Take([]string{"key"}, limit, now)
+	if allowed {
+		t.Fatal("Expected request over the burst to be rejected")
+	}
+
+	if retryAfter <= 0 || retryAfter > time.Second {
+		t.Errorf("Expected retry after within 1s, got %s", retryAfter)
+	}
+
+	if allowed, _ := store.Take([]string{"other"}, limit, now); !allowed {
+		t.Error("Expected separate keys to have separate buckets")
+	}
+
+	if allowed, _ := store.Take([]string{"key"}, limit, now.Add(time.Second)); !allowed {
+		t.Error("Expected bucket to refill after a second")
+	}
+}
+
+func TestMemoryRateLimitStore_TakeAllOrNothing(t *testing.T) {
+	store := newMemoryRateLimitStore()
+	limit := RateLimit{Rate: 1, Burst: 1}
+	now := time.Now()
+
+	if allowed, _ := store.Take([]string{"student"}, limit, now); !allowed {
+		t.Fatal("Expected first request to be allowed")
+	}
+
+	if allowed, _ := store.Take([]string{"ip", "student"}, limit, now); allowed {
+		t.Fatal("Expected request with an empty bucket to be rejected")
+	}
+
+	// the ip bucket was left untouched by the rejected request
+	if allowed, _ := store.Take([]string{"ip"}, limit, now); !allowed {
+		t.Error("Expected the other buckets not to be consumed by a rejected request")
+	}
+}
+
+func TestRateLimiterMiddleware(t *testing.T) {
+	limiter := &RateLimiter{
+		Store:  newMemoryRateLimitStore(),
+		Limits: map[string]RateLimit{"archive": {Rate: 0.1, Burst: 1}},
+	}
+
+	handler := limiter.Middleware()(func(c echo.Context) error {
+		return c.NoContent(http.StatusNoContent)
+	})
+
+	e := echo.New()
+	newRequest := func(method, path string) (echo.Context, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(method, path, nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		rec := httptest.NewRecorder()
+		return e.NewContext(req, rec), rec
+	}
+
+	c, _ := newRequest(http.MethodGet, "/user_messages/archive")
+	if err := handler(c); err != nil {
+		t.Fatalf("Expected first request to pass, got: %v", err)
+	}
+
+	c, rec := newRequest(http.MethodGet, "/user_messages/archive")
+	if err := handler(c); err == nil {
+		t.Fatal("Expected second request to be rate limited, got nil")
+	}
+
+	if retryAfter := rec.Header().Get("Retry-After"); retryAfter != "10" {
+		t.Errorf("Expected Retry-After of 10, got '%s'", retryAfter)
+	}
+
+	c, _ = newRequest(http.MethodPost, "/api/collections/messages/records")
+	if err := handler(c); err != nil {
+		t.Errorf("Expected unlimited route to pass, got: %v", err)
+	}
+}
+
+func TestRateLimiterCheckRecord(t *testing.T) {
+	limiter := &RateLimiter{
+		Store:  newMemoryRateLimitStore(),
+		Limits: map[string]RateLimit{"messages": {Rate: 0.1, Burst: 1}},
+	}
+
+	e := echo.New()
+	newEvent := func() *core.RecordCreateEvent {
+		req := httptest.NewRequest(http.MethodPost, "/api/collections/messages/records", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		return &core.RecordCreateEvent{
+			HttpContext: e.NewContext(req, httptest.NewRecorder()),
+			Record:      models.NewRecord(&models.Collection{Name: "messages"}),
+		}
+	}
+
+	if err := limiter.CheckRecord(newEvent(), "202012345678"); err != nil {
+		t.Fatalf("Expected first message to pass, got: %v", err)
+	}
+
+	if err := limiter.CheckRecord(newEvent(), "202012345678"); err == nil {
+		t.Fatal("Expected second message from the same sender to be rate limited, got nil")
+	}
+
+	// another sender from the same IP is limited by the IP bucket
+	if err := limiter.CheckRecord(newEvent(), "202087654321"); err == nil {
+		t.Fatal("Expected message from the same IP to be rate limited, got nil")
+	}
+
+	// the rejected message should not have spent the token of the sender
+	limiter.Store.(*memoryRateLimitStore).buckets.Delete("messages/ip:10.0.0.1")
+	if err := limiter.CheckRecord(newEvent(), "202087654321"); err != nil {
+		t.Errorf("Expected message from the other sender to pass, got: %v", err)
+	}
+}
+
+func TestOnBeforeAddMessage_RateLimitedFirst(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Cleanup()
+
+	defer func(limiter *RateLimiter) { rateLimiter = limiter }(rateLimiter)
+	rateLimiter = &RateLimiter{
+		Store:  newMemoryRateLimitStore(),
+		Limits: map[string]RateLimit{"messages": {Rate: 0.1, Burst: 1}},
+	}
+
+	detailsCollection, _ := app.Dao().FindCollectionByNameOrId("user_details")
+	details := models.NewRecord(detailsCollection)
+	details.Set("student_id", "202012345678")
+	if err := app.Dao().SaveRecord(details); err != nil {
+		t.Fatal(err)
+	}
+
+	saveTestMessage(t, app, details.Id, "202087654321", "See you at the library later!")
+
+	e := echo.New()
+	newEvent := func() *core.RecordCreateEvent {
+		req := httptest.NewRequest(http.MethodPost, "/api/collections/messages/records", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+
+		collection, _ := app.Dao().FindCollectionByNameOrId("messages")
+		message := models.NewRecord(collection)
+		message.Set("user", details.Id)
+		message.Set("recipient", "202087654321")
+		message.Set("content", "See you at the library later!")
+		return &core.RecordCreateEvent{HttpContext: e.NewContext(req, httptest.NewRecorder()), Record: message}
+	}
+
+	// the duplicate is turned down after it has taken the token
+	if err := onBeforeAddMessage(app.Dao(), newEvent()); err == nil {
+		t.Fatal("Expected the duplicate to be rejected, got nil")
+	}
+
+	err := onBeforeAddMessage(app.Dao(), newEvent())
+	if apiErr, ok := err.(*apis.ApiError); !ok || apiErr.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected the retry to be rate limited, got %v", err)
+	}
+
+	if _, ok := rateLimiter.Store.(*memoryRateLimitStore).buckets.Get("messages/student:202012345678"); !ok {
+		t.Error("Expected the sender's student id to be limited")
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+)
+
+const recipientTopGiftsLimit = 3
+
+// visibleMessagesQuery selects the messages of the recipient the same way
+// the messages list rule does, leaving out the hidden ones of shadow
+// banned senders.
+const visibleMessagesQuery = `
+	WITH visible AS (
+		SELECT m.id, CASE WHEN json_valid(m.gifts) THEN m.gifts ELSE '[]' END AS gifts, m.send_price
+		FROM messages m
+		WHERE m.tenant = {:tenant} AND m.recipient = {:recipient} AND COALESCE(m.hidden, FALSE) = FALSE
+	)
+`
+
+// queryRecipientStats aggregates the messages, replies, coins and gifts
+// received by the recipient within the tenant.
+func queryRecipientStats(dao *daos.Dao, tenantId string, recipientId string) (*RecipientStats, error) {
+	params := dbx.Params{
+		"tenant":    tenantId,
+		"recipient": recipientId,
+		"sendPrice": tenantSendPrice(findTenant(dao, tenantId)),
+		"limit":     recipientTopGiftsLimit,
+	}
+
+	stats := &RecipientStats{}
+	err := dao.DB().NewQuery(visibleMessagesQuery + `
+		SELECT {:recipient} AS recipient_id,
+			(SELECT COUNT(*) FROM visible) AS messages_count,
+			(SELECT COUNT(*) FROM visible WHERE json_array_length(gifts) > 0) AS gift_messages_count,
+			(SELECT COUNT(*) FROM message_replies r WHERE r.message IN (SELECT id FROM visible) AND COALESCE(r.hidden, FALSE) = FALSE) AS replies_count,
+			COALESCE((SELECT SUM(COALESCE(NULLIF(send_price, 0), {:sendPrice})) FROM visible), 0) + COALESCE((
+				SELECT SUM(g.price) FROM visible v, json_each(v.gifts) mg
+				INNER JOIN gifts g ON g.id = mg.value
+			), 0) AS coins_received
+	`).Bind(params).One(stats)
+	if err != nil {
+		return nil, err
+	}
+
+	stats.TopGifts = []*GiftStats{}
+	err = dao.DB().NewQuery(visibleMessagesQuery + `
+		SELECT g.id AS gift_id, g.uid AS uid, g.label AS label, COUNT(*) AS count
+		FROM visible v, json_each(v.gifts) mg
+		INNER JOIN gifts g ON g.id = mg.value
+		GROUP BY g.id
+		ORDER BY count DESC, g.price DESC
+		LIMIT {:limit}
+	`).Bind(params).All(&stats.TopGifts)
+	if err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// isRecipientListed reports whether the recipient appears on the public
+// leaderboards, in which case their coins are already public.
+func isRecipientListed(dao *daos.Dao, tenantId string, recipientId string) bool {
+	ranking, err := findRanking(dao, tenantId, recipientId)
+	return err == nil && !ranking.GetBool("hidden")
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/pocketbase/pocketbase/models"
+)
+
+func TestQueryRecipientStats(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Cleanup()
+
+	dao := app.Dao()
+	seedRankingMessages(t, app)
+
+	messages, _ := dao.FindRecordsByExpr("messages")
+	repliesCollection, _ := dao.FindCollectionByNameOrId("message_replies")
+	for _, message := range messages {
+		if message.GetString("recipient") != "202000000001" {
+			continue
+		}
+
+		reply := models.NewRecord(repliesCollection)
+		reply.Set("message", message.Id)
+		reply.Set("content", "Thank you!")
+		if err := dao.SaveRecord(reply); err != nil {
+			t.Fatalf("Failed to save reply: %v", err)
+		}
+		break
+	}
+
+	stats, err := queryRecipientStats(dao, defaultTenant, "202000000001")
+	if err != nil {
+		t.Fatalf("queryRecipientStats failed: %v", err)
+	}
+
+	if stats.MessagesCount != 2 || stats.GiftMessagesCount != 1 || stats.RepliesCount != 1 {
+		t.Errorf("Unexpected counts: %+v", stats)
+	}
+
+	if stats.CoinsReceived != 2*sendPrice+80 {
+		t.Errorf("Expected %f coins, got %f", 2*sendPrice+80, stats.CoinsReceived)
+	}
+
+	// messages count for the price paid when they were sent
+	for _, message := range messages {
+		if message.GetString("recipient") == "202000000001" {
+			message.Set("send_price", 100)
+			dao.SaveRecord(message)
+			break
+		}
+	}
+
+	if paid, _ := queryRecipientStats(dao, defaultTenant, "202000000001"); paid.CoinsReceived != 100+sendPrice+80 {
+		t.Errorf("Expected %f coins, got %f", 100+sendPrice+80, paid.CoinsReceived)
+	}
+
+	if len(stats.TopGifts) != 2 || stats.TopGifts[0].UID != "rose" || stats.TopGifts[0].Count != 1 {
+		t.Errorf("Unexpected top gifts: %+v", stats.TopGifts)
+	}
+
+	// not registered and never received anything
+	empty, err := queryRecipientStats(dao, defaultTenant, "202000000009")
+	if err != nil {
+		t.Fatalf("queryRecipientStats failed: %v", err)
+	}
+
+	if empty.MessagesCount != 0 || empty.CoinsReceived != 0 || len(empty.TopGifts) != 0 {
+		t.Errorf("Expected empty stats, got: %+v", empty)
+	}
+}
+
+func TestQueryRecipientStats_ShadowBannedSender(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Cleanup()
+
+	dao := app.Dao()
+	hidden := saveTestMessage(t, app, "sender1", "202000000001", "Hello there")
+	hidden.Set("hidden", true)
+	if err := dao.SaveRecord(hidden); err != nil {
+		t.Fatalf("Failed to save message: %v", err)
+	}
+
+	saveTestMessage(t, app, "sender2", "202000000001", "See you later")
+
+	stats, err := queryRecipientStats(dao, defaultTenant, "202000000001")
+	if err != nil {
+		t.Fatalf("queryRecipientStats failed: %v", err)
+	}
+
+	if stats.MessagesCount != 1 {
+		t.Errorf("Expected messages of shadow banned senders to be left out, got %d", stats.MessagesCount)
+	}
+}
+
+func TestRecipientStats_HideGifts(t *testing.T) {
+	stats := &RecipientStats{MessagesCount: 2, GiftMessagesCount: 1, CoinsReceived: 380, TopGifts: []*GiftStats{{UID: "rose", Count: 1}}}
+	stats.HideGifts()
+
+	if !stats.GiftsHidden || stats.GiftMessagesCount != 0 || stats.CoinsReceived != 0 || len(stats.TopGifts) != 0 {
+		t.Errorf("Expected gift stats to be hidden, got: %+v", stats)
+	}
+
+	if stats.MessagesCount != 2 {
+		t.Errorf("Expected messages count to be kept, got %d", stats.MessagesCount)
+	}
+}
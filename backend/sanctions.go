@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/daos"
+	"github.com/pocketbase/pocketbase/models"
+)
+
+// account sanctions are stored in the admin-only user_sanctions collection
+// as the date they expire so that they are lifted automatically once the
+// date has passed.
+const (
+	sanctionSendBan   = "send_banned_until"
+	sanctionReplyOnly = "reply_only_until"
+	sanctionShadowBan = "shadow_banned_until"
+)
+
+const sanctionDateLayout = "January 2, 2006 3:04 PM MST"
+
+// findUserSanctions returns the sanctions of the user details or nil if the
+// user has never been sanctioned.
+func findUserSanctions(dao *daos.Dao, userDetailsId string) *models.Record {
+	sanctions, err := dao.FindFirstRecordByData("user_sanctions", "user", userDetailsId)
+	if err != nil {
+		return nil
+	}
+	return sanctions
+}
+
+func isSanctionActive(sanctions *models.Record, sanction string) bool {
+	if sanctions == nil {
+		return false
+	}
+
+	until := sanctions.GetDateTime(sanction)
+	return !until.IsZero() && until.Time().After(time.Now())
+}
+
+func isShadowBanned(sanctions *models.Record) bool {
+	return isSanctionActive(sanctions, sanctionShadowBan)
+}
+
+// checkSendSanctions returns an error if the sender is not allowed to post
+// a message (or a reply if isReply is set). shadow-banned users are allowed
+// to post as their submissions are hidden instead.
+func checkSendSanctions(sanctions *models.Record, isReply bool) error {
+	if isSanctionActive(sanctions, sanctionSendBan) {
+		return apis.NewForbiddenError(
+			fmt.Sprintf("You are not allowed to send messages until %s.", sanctions.GetDateTime(sanctionSendBan).Time().Format(sanctionDateLayout)), nil)
+	}
+
+	if !isReply && isSanctionActive(sanctions, sanctionReplyOnly) {
+		return apis.NewForbiddenError(
+			fmt.Sprintf("You can only reply to messages until %s.", sanctions.GetDateTime(sanctionReplyOnly).Time().Format(sanctionDateLayout)), nil)
+	}
+
+	return nil
+}
+
+// isHideableCollection tells whether the posts of the collection are
+// hidden while their author is shadow-banned
+func isHideableCollection(collection *models.Collection) bool {
+	return collection.Name == "messages" || collection.Name == "message_replies"
+}
+
+// concealHiddenPost makes a hidden post look like any other so that its
+// author does not find out about the shadow-ban. only the copy in memory
+// is changed.
+func concealHiddenPost(record *models.Record) {
+	if isHideableCollection(record.Collection()) {
+		record.Set("hidden", false)
+	}
+}
+
+// isHiddenPost reads whether the post is hidden from the database since
+// the record itself may have been concealed already
+func isHiddenPost(dao *daos.Dao, record *models.Record) bool {
+	hidden := false
+	err := dao.DB().Select("hidden").From(record.Collection().Name).Where(dbx.HashExp{"id": record.Id}).Row(&hidden)
+	return err == nil && hidden
+}
+
+// keepHiddenUnchanged keeps the author from revealing their hidden posts.
+// the change is dropped instead of rejected since the author is not
+// supposed to know that the post is hidden.
+func keepHiddenUnchanged(e *core.RecordUpdateEvent) {
+	if e.HttpContext != nil {
+		if admin, _ := e.HttpContext.Get(apis.ContextAdminKey).(*models.Admin); admin != nil {
+			return
+		}
+	}
+
+	e.Record.Set("hidden", e.Record.OriginalCopy().GetBool("hidden"))
+}
+
+// registerHiddenPostHooks conceals hidden posts in the responses and
+// realtime events sent to non-admins
+func registerHiddenPostHooks(app core.App) {
+	// the record is concealed after it was written but before it is sent
+	// back or broadcasted, which includes the responses to admins. the
+	// realtime hooks are bound once the api is set up so these have to be
+	// put in front of them afterwards.
+	concealModel := func(e *core.ModelEvent) error {
+		if record, ok := e.Model.(*models.Record); ok {
+			concealHiddenPost(record)
+		}
+		return nil
+	}
+
+	app.OnBeforeServe().Add(func(e *core.ServeEvent) error {
+		app.OnModelAfterCreate().PreAdd(concealModel)
+		app.OnModelAfterUpdate().PreAdd(concealModel)
+		return nil
+	})
+
+	app.OnRecordsListRequest().Add(func(e *core.RecordsListEvent) error {
+		if admin, _ := e.HttpContext.Get(apis.ContextAdminKey).(*models.Admin); admin == nil {
+			for _, record := range e.Records {
+				concealHiddenPost(record)
+			}
+		}
+		return nil
+	})
+
+	app.OnRecordViewRequest().Add(func(e *core.RecordViewEvent) error {
+		if admin, _ := e.HttpContext.Get(apis.ContextAdminKey).(*models.Admin); admin == nil {
+			concealHiddenPost(e.Record)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func newTestUserDetails(t *testing.T, app core.App) *models.Record {
+	t.Helper()
+
+	collection, err := app.Dao().FindCollectionByNameOrId("user_details")
+	if err != nil {
+		t.Fatalf("Failed to find user_details collection: %v", err)
+	}
+
+	details := models.NewRecord(collection)
+	details.Set("student_id", "202012345678")
+	details.Set("tenant", defaultTenant)
+	return details
+}
+
+func newTestUserSanctions(t *testing.T, app core.App, userDetailsId string) *models.Record {
+	t.Helper()
+
+	collection, err := app.Dao().FindCollectionByNameOrId("user_sanctions")
+	if err != nil {
+		t.Fatalf("Failed to find user_sanctions collection: %v", err)
+	}
+
+	sanctions := models.NewRecord(collection)
+	sanctions.Set("user", userDetailsId)
+	return sanctions
+}
+
+func TestCheckSendSanctions_NoSanctions(t *testing.T) {
+	if err := checkSendSanctions(nil, false); err != nil {
+		t.Errorf("Expected no error for unsanctioned user, got: %v", err)
+	}
+}
+
+func TestCheckSendSanctions_SendBan(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Cleanup()
+
+	sanctions := newTestUserSanctions(t, app, "user1")
+	until, _ := types.ParseDateTime(time.Now().Add(time.Hour))
+	sanctions.Set(sanctionSendBan, until)
+
+	if err := checkSendSanctions(sanctions, false); err == nil {
+		t.Error("Expected send ban to block messages, got nil")
+	}
+
+	if err := checkSendSanctions(sanctions, true); err == nil {
+		t.Error("Expected send ban to block replies, got nil")
+	}
+}
+
+func TestCheckSendSanctions_ReplyOnly(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Cleanup()
+
+	sanctions := newTestUserSanctions(t, app, "user1")
+	until, _ := types.ParseDateTime(time.Now().Add(time.Hour))
+	sanctions.Set(sanctionReplyOnly, until)
+
+	if err := checkSendSanctions(sanctions, false); err == nil {
+		t.Error("Expected reply-only mode to block messages, got nil")
+	}
+
+	if err := checkSendSanctions(sanctions, true); err != nil {
+		t.Errorf("Expected reply-only mode to allow replies, got: %v", err)
+	}
+}
+
+func TestCheckSendSanctions_Expired(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Cleanup()
+
+	sanctions := newTestUserSanctions(t, app, "user1")
+	until, _ := types.ParseDateTime(time.Now().Add(-time.Hour))
+	sanctions.Set(sanctionSendBan, until)
+	sanctions.Set(sanctionShadowBan, until)
+
+	if err := checkSendSanctions(sanctions, false); err != nil {
+		t.Errorf("Expected expired sanction to be lifted, got: %v", err)
+	}
+
+	if isShadowBanned(sanctions) {
+		t.Error("Expected expired shadow ban to be lifted")
+	}
+}
+
+func TestFindUserSanctions(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Cleanup()
+
+	if sanctions := findUserSanctions(app.Dao(), "user1"); sanctions != nil {
+		t.Errorf("Expected no sanctions for a user that was never sanctioned, got %v", sanctions)
+	}
+
+	sanctions := newTestUserSanctions(t, app, "user1")
+	until, _ := types.ParseDateTime(time.Now().Add(time.Hour))
+	sanctions.Set(sanctionShadowBan, until)
+	if err := app.Dao().SaveRecord(sanctions); err != nil {
+		t.Fatalf("Failed to save sanctions: %v", err)
+	}
+
+	if !isShadowBanned(findUserSanctions(app.Dao(), "user1")) {
+		t.Error("Expected the stored shadow ban to be found")
+	}
+
+	if isShadowBanned(findUserSanctions(app.Dao(), "user2")) {
+		t.Error("Expected other users not to be shadow banned")
+	}
+}
+
+func TestKeepHiddenUnchanged(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Cleanup()
+
+	message := saveTestMessage(t, app, "user1", "everyone", "Hello")
+	message.Set("hidden", true)
+	if err := app.Dao().SaveRecord(message); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := app.Dao().FindRecordById("messages", message.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored.Set("hidden", false)
+	keepHiddenUnchanged(&core.RecordUpdateEvent{Record: stored})
+	if !stored.GetBool("hidden") {
+		t.Error("Expected the author not to be able to reveal a hidden post")
+	}
+
+	if !isHiddenPost(app.Dao(), stored) {
+		t.Error("Expected the post to be hidden in the database")
+	}
+
+	concealHiddenPost(stored)
+	if stored.GetBool("hidden") || !isHiddenPost(app.Dao(), stored) {
+		t.Error("Expected only the copy in memory to be concealed")
+	}
+}
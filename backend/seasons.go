@@ -0,0 +1,249 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/daos"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/tools/types"
+	"github.com/spf13/cobra"
+)
+
+const (
+	balancePolicyKeep  = "keep"
+	balancePolicyReset = "reset"
+)
+
+// findSeason returns the season running at the given time which is the
+// latest one that has started. if none has started yet, the earliest
+// upcoming season is returned. it returns nil if there are no seasons.
+func findSeason(dao *daos.Dao, at time.Time) (*models.Record, error) {
+	seasons, err := dao.FindRecordsByExpr("seasons")
+	if err != nil || len(seasons) == 0 {
+		return nil, err
+	}
+
+	sort.Slice(seasons, func(i, j int) bool {
+		return seasons[i].GetDateTime("starts_at").Time().After(seasons[j].GetDateTime("starts_at").Time())
+	})
+
+	for _, season := range seasons {
+		if !season.GetDateTime("starts_at").Time().After(at) {
+			return season, nil
+		}
+	}
+
+	return seasons[len(seasons)-1], nil
+}
+
+// seasonBucketDays returns the first and the last bucket day of the season
+// with the uid. the last day is empty while the season is still running
+// and both are empty for the season of SEASON when none has been created.
+func seasonBucketDays(dao *daos.Dao, uid string) (string, string, error) {
+	seasons, err := dao.FindRecordsByExpr("seasons")
+	if err != nil {
+		return "", "", err
+	}
+
+	var season *models.Record
+	for _, record := range seasons {
+		if record.GetString("uid") == uid {
+			season = record
+			break
+		}
+	}
+
+	if season == nil {
+		if uid == currentSeason {
+			return "", "", nil
+		}
+		return "", "", fmt.Errorf("unknown season '%s'", uid)
+	}
+
+	startsAt := season.GetDateTime("starts_at").Time()
+
+	// a season without an end runs until the next one starts
+	endsAt := season.GetDateTime("ends_at").Time()
+	if endsAt.IsZero() {
+		for _, record := range seasons {
+			nextStartsAt := record.GetDateTime("starts_at").Time()
+			if nextStartsAt.After(startsAt) && (endsAt.IsZero() || nextStartsAt.Before(endsAt)) {
+				endsAt = nextStartsAt
+			}
+		}
+	}
+
+	if endsAt.IsZero() {
+		return bucketDay(startsAt), "", nil
+	}
+	return bucketDay(startsAt), bucketDay(endsAt.Add(-time.Millisecond)), nil
+}
+
+func findCurrentSeason(dao *daos.Dao) (*models.Record, error) {
+	return findSeason(dao, time.Now())
+}
+
+// currentSeasonId returns the uid of the current season. SEASON is used
+// when no season has been created yet.
+func currentSeasonId(dao *daos.Dao) string {
+	if season, err := findCurrentSeason(dao); err == nil && season != nil {
+		return season.GetString("uid")
+	}
+	return currentSeason
+}
+
+func currentSeasonName(dao *daos.Dao) string {
+	if season, err := findCurrentSeason(dao); err == nil && season != nil {
+		return season.GetString("name")
+	}
+	return defaultSiteName + " " + currentSeason
+}
+
+// checkSeasonOpen rejects submissions outside of the current season. once
+// the season has ended or has been archived, the wall becomes read-only.
+func checkSeasonOpen(dao *daos.Dao, at time.Time) error {
+	season, err := findSeason(dao, at)
+	if err != nil || season == nil {
+		return err
+	}
+
+	name := season.GetString("name")
+	if season.GetDateTime("starts_at").Time().After(at) {
+		return apis.NewForbiddenError(fmt.Sprintf("%s has not started yet.", name), nil)
+	}
+
+	endsAt := season.GetDateTime("ends_at")
+	if season.GetBool("archived") || (!endsAt.IsZero() && !endsAt.Time().After(at)) {
+		return apis.NewForbiddenError(fmt.Sprintf("%s has ended. The wall is now read-only.", name), nil)
+	}
+
+	return nil
+}
+
+// rolloverSeason archives the current season together with a snapshot of
+// its leaderboard, starts the next one and applies the balance policy to
+// every wallet.
+func rolloverSeason(dao *daos.Dao, next *models.Record, balancePolicy string, at time.Time) error {
+	if balancePolicy != balancePolicyKeep && balancePolicy != balancePolicyReset {
+		return fmt.Errorf("unknown balance policy '%s'", balancePolicy)
+	}
+
+	previous, err := findSeason(dao, at)
+	if err != nil {
+		return err
+	}
+
+	return dao.RunInTransaction(func(txDao *daos.Dao) error {
+		if previous != nil {
+			for _, tenantId := range tenantIds(txDao) {
+				if _, err := takeRankingSnapshot(txDao, tenantId, previous.GetString("uid"), at); err != nil {
+					return err
+				}
+			}
+
+			endsAt := previous.GetDateTime("ends_at")
+			if endsAt.IsZero() || endsAt.Time().After(at) {
+				endsAt, _ = types.ParseDateTime(at)
+				previous.Set("ends_at", endsAt)
+			}
+
+			previous.Set("archived", true)
+			if err := txDao.SaveRecord(previous); err != nil {
+				return err
+			}
+		}
+
+		next.Set("archived", false)
+		if err := txDao.SaveRecord(next); err != nil {
+			return err
+		}
+
+		wallets, err := txDao.FindRecordsByExpr("virtual_wallets")
+		if err != nil {
+			return err
+		}
+
+		description := fmt.Sprintf("Balance reset for %s", next.GetString("name"))
+		for _, wallet := range wallets {
+			wallet.Set("season", next.GetString("uid"))
+			if err := txDao.SaveRecord(wallet); err != nil {
+				return err
+			}
+
+			// the balance itself is updated by the transaction hook
+			amount := initialBalance - wallet.GetFloat("balance")
+			if balancePolicy != balancePolicyReset || amount == 0 {
+				continue
+			}
+
+			if err := createTransaction(txDao, wallet.Id, amount, description); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func newSeasonCommand(app core.App) *cobra.Command {
+	command := &cobra.Command{
+		Use:   "season",
+		Short: "Manage the wall seasons",
+	}
+
+	var name, startsAt, endsAt, balancePolicy string
+	rolloverCommand := &cobra.Command{
+		Use:   "rollover [season uid]",
+		Short: "Archive the current season and start the next one",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			collection, err := app.Dao().FindCollectionByNameOrId("seasons")
+			if err != nil {
+				return err
+			}
+
+			next := models.NewRecord(collection)
+			next.Set("uid", args[0])
+			next.Set("name", name)
+			if len(name) == 0 {
+				next.Set("name", defaultSiteName+" "+args[0])
+			}
+
+			now := time.Now()
+			nextStartsAt, _ := types.ParseDateTime(now)
+			if len(startsAt) != 0 {
+				if nextStartsAt, err = types.ParseDateTime(startsAt); err != nil {
+					return err
+				}
+			}
+			next.Set("starts_at", nextStartsAt)
+
+			if len(endsAt) != 0 {
+				nextEndsAt, err := types.ParseDateTime(endsAt)
+				if err != nil {
+					return err
+				}
+				next.Set("ends_at", nextEndsAt)
+			}
+
+			if err := rolloverSeason(app.Dao(), next, balancePolicy, now); err != nil {
+				return err
+			}
+
+			fmt.Printf("%s has started.\n", next.GetString("name"))
+			return nil
+		},
+	}
+
+	rolloverCommand.Flags().StringVar(&name, "name", "", "display name of the next season")
+	rolloverCommand.Flags().StringVar(&startsAt, "starts", "", "start of the next season (defaults to now)")
+	rolloverCommand.Flags().StringVar(&endsAt, "ends", "", "end of the next season")
+	rolloverCommand.Flags().StringVar(&balancePolicy, "balances", balancePolicyReset, "what to do with the wallet balances (keep or reset)")
+
+	command.AddCommand(rolloverCommand)
+	return command
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/tests"
+)
+
+func newTestSeason(t *testing.T, app *tests.TestApp, uid string, startsAt time.Time, endsAt time.Time) *models.Record {
+	t.Helper()
+
+	collection, _ := app.Dao().FindCollectionByNameOrId("seasons")
+	season := models.NewRecord(collection)
+	season.Set("uid", uid)
+	season.Set("name", "UIC Valentine Wall "+uid)
+	season.Set("starts_at", startsAt)
+	if !endsAt.IsZero() {
+		season.Set("ends_at", endsAt)
+	}
+
+	return season
+}
+
+func saveTestSeason(t *testing.T, app *tests.TestApp, uid string, startsAt time.Time, endsAt time.Time) *models.Record {
+	t.Helper()
+
+	season := newTestSeason(t, app, uid, startsAt, endsAt)
+	if err := app.Dao().SaveRecord(season); err != nil {
+		t.Fatalf("Failed to save season: %v", err)
+	}
+
+	return season
+}
+
+func TestFindSeason(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Cleanup()
+
+	dao := app.Dao()
+	now := time.Now()
+
+	if season, err := findCurrentSeason(dao); err != nil || season != nil {
+		t.Fatalf("Expected no season, got %v (err: %v)", season, err)
+	}
+
+	if id := currentSeasonId(dao); id != currentSeason {
+		t.Errorf("Expected fallback season %q, got %q", currentSeason, id)
+	}
+
+	saveTestSeason(t, app, "2023", now.AddDate(-1, 0, 0), now.AddDate(-1, 0, 14))
+	saveTestSeason(t, app, "2024", now.AddDate(0, 0, -1), time.Time{})
+	saveTestSeason(t, app, "2025", now.AddDate(1, 0, 0), time.Time{})
+
+	if id := currentSeasonId(dao); id != "2024" {
+		t.Errorf("Expected season 2024, got %q", id)
+	}
+
+	if season, _ := findSeason(dao, now.AddDate(-2, 0, 0)); season == nil || season.GetString("uid") != "2023" {
+		t.Errorf("Expected the earliest upcoming season before any has started, got %v", season)
+	}
+}
+
+func TestCheckSeasonOpen(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Cleanup()
+
+	dao := app.Dao()
+	now := time.Now()
+
+	if err := checkSeasonOpen(dao, now); err != nil {
+		t.Errorf("Expected the wall to be open without seasons, got: %v", err)
+	}
+
+	season := saveTestSeason(t, app, "2024", now.AddDate(0, 0, -7), now.AddDate(0, 0, 7))
+
+	testCases := []struct {
+		name   string
+		at     time.Time
+		isOpen bool
+	}{
+		{"before start", now.AddDate(0, 0, -8), false},
+		{"during season", now, true},
+		{"after end", now.AddDate(0, 0, 8), false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := checkSeasonOpen(dao, tc.at); (err == nil) != tc.isOpen {
+				t.Errorf("Expected open to be %v, got error: %v", tc.isOpen, err)
+			}
+		})
+	}
+
+	season.Set("archived", true)
+	dao.SaveRecord(season)
+
+	if err := checkSeasonOpen(dao, now); err == nil {
+		t.Errorf("Expected archived seasons to be read-only")
+	}
+}
+
+func TestRolloverSeason(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Cleanup()
+
+	dao := app.Dao()
+	now := time.Now()
+	previous := saveTestSeason(t, app, "2023", now.AddDate(0, 0, -14), time.Time{})
+
+	walletsCollection, _ := dao.FindCollectionByNameOrId("virtual_wallets")
+	wallet := models.NewRecord(walletsCollection)
+	wallet.Set("user", "user1")
+	wallet.Set("balance", 250)
+	wallet.Set("season", "2023")
+	if err := dao.SaveRecord(wallet); err != nil {
+		t.Fatalf("Failed to save wallet: %v", err)
+	}
+
+	saveTestRanking(t, app, "202000000001", 150)
+	addTestRankingBucket(t, dao, defaultTenant, "202000000001", now, 150)
+
+	next := newTestSeason(t, app, "2024", now, time.Time{})
+	if err := rolloverSeason(dao, next, "unknown", now); err == nil {
+		t.Fatalf("Expected unknown balance policies to be rejected")
+	}
+
+	if err := rolloverSeason(dao, next, balancePolicyReset, now); err != nil {
+		t.Fatalf("rolloverSeason failed: %v", err)
+	}
+
+	previous, _ = dao.FindRecordById("seasons", previous.Id)
+	if !previous.GetBool("archived") || previous.GetDateTime("ends_at").IsZero() {
+		t.Errorf("Expected previous season to be archived and closed")
+	}
+
+	if id := currentSeasonId(dao); id != "2024" {
+		t.Errorf("Expected season 2024 to be current, got %q", id)
+	}
+
+	snapshot, err := findRankingSnapshot(dao, defaultTenant, "latest", "2023")
+	if err != nil || len(snapshot.Entries) != 1 {
+		t.Errorf("Expected a snapshot of the previous season, got %v (err: %v)", snapshot, err)
+	}
+
+	transactions, _ := dao.FindRecordsByExpr("virtual_transactions", dbx.HashExp{"wallet": wallet.Id})
+	if len(transactions) != 1 || transactions[0].GetFloat("amount") != initialBalance-250 {
+		t.Errorf("Expected a transaction resetting the balance, got %d", len(transactions))
+	}
+
+	wallet, _ = dao.FindRecordById("virtual_wallets", wallet.Id)
+	if wallet.GetString("season") != "2024" {
+		t.Errorf("Expected wallet to move to season 2024, got %q", wallet.GetString("season"))
+	}
+
+	// rankings of the previous season are kept but not listed anymore
+	if _, err := findRanking(dao, defaultTenant, "202000000001"); err == nil {
+		t.Errorf("Expected no ranking in the new season")
+	}
+
+	if recipients, _ := queryLeaderboard(dao, defaultTenant, currentSeasonId(dao), ""); len(recipients) != 0 {
+		t.Errorf("Expected an empty leaderboard for the new season, got %+v", recipients)
+	}
+
+	// the previous season can still be snapshotted with its own leaderboard
+	record, err := takeRankingSnapshot(dao, defaultTenant, "2023", now)
+	if err != nil {
+		t.Fatalf("takeRankingSnapshot failed: %v", err)
+	}
+
+	if snapshot, _ := newRankingSnapshot(record); len(snapshot.Entries) != 1 || snapshot.Entries[0].TotalCoins != 150 {
+		t.Errorf("Expected the snapshot to show the previous season, got %+v", snapshot.Entries)
+	}
+
+	if _, err := takeRankingSnapshot(dao, defaultTenant, "1999", now); err == nil {
+		t.Errorf("Expected snapshots of unknown seasons to be rejected")
+	}
+}
+
+func TestRolloverSeason_KeepBalances(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Cleanup()
+
+	dao := app.Dao()
+	now := time.Now()
+	saveTestSeason(t, app, "2023", now.AddDate(0, 0, -14), time.Time{})
+
+	walletsCollection, _ := dao.FindCollectionByNameOrId("virtual_wallets")
+	wallet := models.NewRecord(walletsCollection)
+	wallet.Set("user", "user1")
+	wallet.Set("balance", 250)
+	if err := dao.SaveRecord(wallet); err != nil {
+		t.Fatalf("Failed to save wallet: %v", err)
+	}
+
+	next := newTestSeason(t, app, "2024", now, time.Time{})
+	if err := rolloverSeason(dao, next, balancePolicyKeep, now); err != nil {
+		t.Fatalf("rolloverSeason failed: %v", err)
+	}
+
+	if transactions, _ := dao.FindRecordsByExpr("virtual_transactions"); len(transactions) != 0 {
+		t.Errorf("Expected balances to be kept, got %d transactions", len(transactions))
+	}
+
+	if wallet, _ = dao.FindRecordById("virtual_wallets", wallet.Id); wallet.GetFloat("balance") != 250 {
+		t.Errorf("Expected balance to be kept, got %f", wallet.GetFloat("balance"))
+	}
+}
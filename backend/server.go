@@ -3,11 +3,14 @@ package main
 import (
 	"archive/zip"
 	"bytes"
+	"database/sql"
+	"errors"
 	"fmt"
 	htmlTemplate "html/template"
 	"log"
 	"net/http"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -44,18 +47,46 @@ var imageRenderer = &ImageRenderer{
 	},
 }
 
+// set up in main, nil if pre-rendering is disabled
+var imagePrerenderer *ImagePrerenderer
+
+var rateLimiter = &RateLimiter{
+	Store:  newMemoryRateLimitStore(),
+	Limits: rateLimits,
+}
+
+// setupImageRenderer loads the image templates and the disk cache. it is
+// shared by the server and the `images warmup` command.
+func setupImageRenderer(app core.App) error {
+	var err error
+	if htmlTemplates, err = htmlTemplate.New("").Funcs(imageRenderer.Funcs).ParseGlob("./templates/html/*.html.tpl"); err != nil {
+		log.Panicln(err)
+	} else {
+		log.Printf("%d html templates have been loaded\n", len(htmlTemplates.Templates()))
+	}
+
+	// load template
+	log.Println("loading image template...")
+	imageRenderer.Templates = htmlTemplates
+
+	if imageDiskCacheSize > 0 {
+		if imageRenderer.DiskCache, err = newDiskImageCache(filepath.Join(app.DataDir(), "image_cache"), imageDiskCacheSize); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func setupRoutes(app *pocketbase.PocketBase) hook.Handler[*core.ServeEvent] {
 	return func(e *core.ServeEvent) error {
-		var err error
-		if htmlTemplates, err = htmlTemplate.New("").Funcs(imageRenderer.Funcs).ParseGlob("./templates/html/*.html.tpl"); err != nil {
-			log.Panicln(err)
-		} else {
-			log.Printf("%d html templates have been loaded\n", len(htmlTemplates.Templates()))
+		if err := setupImageRenderer(app); err != nil {
+			return err
 		}
 
-		// load template
-		log.Println("loading image template...")
-		imageRenderer.Template = htmlTemplates.Lookup("message_image.html.tpl")
+		if imagePrerenderer != nil {
+			go imagePrerenderer.Run()
+		}
 
 		tac, err := getTermsAndConditions()
 		if err != nil {
@@ -63,6 +94,8 @@ func setupRoutes(app *pocketbase.PocketBase) hook.Handler[*core.ServeEvent] {
 		}
 
 		e.Router.Use(middleware.Recover())
+		e.Router.Use(rateLimiter.Middleware())
+		e.Router.Use(tenantMiddleware(app))
 
 		e.Router.Static("/renderer_assets", "renderer_assets")
 
@@ -73,7 +106,9 @@ func setupRoutes(app *pocketbase.PocketBase) hook.Handler[*core.ServeEvent] {
 
 		e.Router.GET("/departments", func(c echo.Context) error {
 			departments := []*vModels.CollegeDepartment{}
-			err := vModels.DepartmentQuery(app.Dao()).All(&departments)
+			err := vModels.DepartmentQuery(app.Dao()).
+				AndWhere(dbx.HashExp{"tenant": tenantId(tenantFromContext(c))}).
+				All(&departments)
 			if err != nil {
 				return internalError(err)
 			}
@@ -81,6 +116,14 @@ func setupRoutes(app *pocketbase.PocketBase) hook.Handler[*core.ServeEvent] {
 			return c.JSON(200, departments)
 		})
 
+		e.Router.GET("/themes", func(c echo.Context) error {
+			return c.JSON(200, imageThemes)
+		})
+
+		e.Router.GET("/tenant", func(c echo.Context) error {
+			return c.JSON(200, newTenantInfo(tenantFromContext(c)))
+		})
+
 		e.Router.GET("/gifts", func(c echo.Context) error {
 			gifts := vModels.Gifts{}
 			err := vModels.GiftQuery(app.Dao()).All(&gifts)
@@ -91,35 +134,165 @@ func setupRoutes(app *pocketbase.PocketBase) hook.Handler[*core.ServeEvent] {
 			return c.JSON(200, gifts)
 		})
 
-		e.Router.GET("/messages/:messageId/image", func(c echo.Context) error {
-			id := c.PathParam("messageId")
-			message, err := app.Dao().FindRecordById("messages", id)
+		e.Router.GET("/rankings", func(c echo.Context) error {
+			recipients, err := queryWindowLeaderboard(app.Dao(), tenantId(tenantFromContext(c)), c.QueryParam("window"), time.Now())
+			if errors.Is(err, errInvalidLeaderboardWindow) {
+				return apis.NewBadRequestError(err.Error(), nil)
+			} else if err != nil {
+				return internalError(err)
+			}
+
+			page, _ := strconv.Atoi(c.QueryParam("page"))
+			perPage, _ := strconv.Atoi(c.QueryParam("perPage"))
+			recipients = recipients.ByDepartment(c.QueryParam("department")).BySex(c.QueryParam("sex"))
+			return c.JSON(200, paginateRecipients(recipients, page, perPage))
+		})
+
+		e.Router.GET("/rankings/departments", func(c echo.Context) error {
+			stats, err := getDepartmentLeaderboard(app.Dao(), tenantId(tenantFromContext(c)))
 			if err != nil {
-				return apis.NewNotFoundError("Message not found", err)
+				return internalError(err)
+			}
+
+			return c.JSON(200, stats)
+		})
+
+		e.Router.GET("/rankings/snapshots/:snapshotId", func(c echo.Context) error {
+			snapshot, err := findRankingSnapshot(app.Dao(), tenantId(tenantFromContext(c)), c.PathParam("snapshotId"), c.QueryParam("season"))
+			if err != nil {
+				return apis.NewNotFoundError("Snapshot not found", err)
+			}
+
+			limit, _ := strconv.Atoi(c.QueryParam("limit"))
+			return c.JSON(200, snapshot.Top(limit))
+		})
+
+		e.Router.POST("/rankings/snapshots", func(c echo.Context) error {
+			record, err := takeRankingSnapshot(app.Dao(), tenantId(tenantFromContext(c)), currentSeasonId(app.Dao()), time.Now())
+			if err != nil {
+				return internalError(err)
+			}
+
+			snapshot, err := newRankingSnapshot(record)
+			if err != nil {
+				return internalError(err)
 			}
 
+			return c.JSON(200, snapshot)
+		}, apis.RequireAdminAuth())
+
+		e.Router.GET("/recipients/:studentId/stats", func(c echo.Context) error {
+			studentId := c.PathParam("studentId")
+			tenantId := tenantId(tenantFromContext(c))
+			stats, err := queryRecipientStats(app.Dao(), tenantId, studentId)
+			if err != nil {
+				return internalError(err)
+			}
+
+			// coins are public only when the recipient is listed on the
+			// leaderboards, otherwise only the recipient can see them.
+			isOwner := false
+			if authRecord, ok := c.Get(apis.ContextAuthRecordKey).(*models.Record); ok && authRecord != nil {
+				if details, err := app.Dao().FindRecordById("user_details", authRecord.GetString("details")); err == nil {
+					isOwner = details.GetString("student_id") == studentId
+				}
+			}
+
+			if !isOwner && !isRecipientListed(app.Dao(), tenantId, studentId) {
+				stats.HideGifts()
+			}
+
+			return c.JSON(200, stats)
+		})
+
+		e.Router.GET("/renderer/metrics", func(c echo.Context) error {
+			if imageRenderer.ChromePool == nil {
+				return apis.NewNotFoundError("Chrome renderer is not enabled.", nil)
+			}
+
+			return c.JSON(200, imageRenderer.ChromePool.Metrics())
+		}, apis.RequireAdminAuth())
+
+		e.Router.GET("/renderer/prerender/metrics", func(c echo.Context) error {
+			if imagePrerenderer == nil {
+				return apis.NewNotFoundError("Image pre-rendering is not enabled.", nil)
+			}
+
+			return c.JSON(200, imagePrerenderer.Metrics())
+		}, apis.RequireAdminAuth())
+
+		// HEAD is supported so that crawlers can check the image cheaply
+		e.Router.Match([]string{http.MethodGet, http.MethodHead}, "/messages/:messageId/image", func(c echo.Context) error {
+			id := c.PathParam("messageId")
 			query := c.QueryParams()
+
+			// signed share links skip the view rule and the campus of the
+			// message
+			if !verifyImageShare(imageShareSecretFor(app), id, query.Get("expires"), query.Get("signature"), time.Now()) {
+				if record, err := findViewableRecord(app.Dao(), "messages", id, apis.RequestData(c)); err != nil {
+					return apis.NewNotFoundError("Message not found", err)
+				} else if !isRecordOfRequestTenant(c, record) {
+					return apis.NewNotFoundError("Message not found", nil)
+				}
+			}
+
+			message, err := findImageMessage(app.Dao(), id)
+			if errors.Is(err, sql.ErrNoRows) {
+				return apis.NewNotFoundError("Message not found", err)
+			} else if err != nil {
+				return internalError(err)
+			}
+
+			itype, err := parseImageType(query.Get("type"))
+			if err != nil {
+				return apis.NewBadRequestError(err.Error(), nil)
+			}
+
 			if query.Has("template_image") {
+				tmpl, err := imageRenderer.TemplateFor(messageImageTheme(message))
+				if err != nil {
+					return internalError(err)
+				}
+
 				c.Response().Header().Set("Content-Type", "text/html")
-				if err := imageRenderer.Template.Execute(c.Response(), RendererContext{
-					RawMessage: message,
-					BackendURL: baseUrl,
-				}); err != nil {
+				if err := tmpl.Execute(c.Response(), newRendererContext(itype, message)); err != nil {
 					return err
 				}
 				return nil
 			}
 
-			buf, err := imageRenderer.Render(imageTypeTwitter, message)
+			// the format is picked from the Accept header unless requested
+			format, err := parseImageFormat(query.Get("format"))
 			if err != nil {
-				return err
+				return apis.NewBadRequestError(err.Error(), nil)
+			} else if !query.Has("format") {
+				c.Response().Header().Add("Vary", "Accept")
+				format = negotiateImageFormat(c.Request().Header.Get("Accept"))
 			}
 
-			c.Response().Header().Set("Content-Type", "image/png")
-			c.Response().Write(buf)
-			return nil
+			enc := imageEncodingFor(format)
+			return serveImage(c, app.Dao(), message, itype, enc, func() ([]byte, error) {
+				return imageRenderer.Render(itype, enc, message)
+			})
 		})
 
+		// share links let the sender or the recipient share the image of a
+		// private message until the link expires
+		e.Router.POST("/messages/:messageId/image/share", func(c echo.Context) error {
+			message, err := findViewableRecord(app.Dao(), "messages", c.PathParam("messageId"), apis.RequestData(c))
+			if err != nil {
+				return apis.NewNotFoundError("Message not found", err)
+			} else if !isRecordOfRequestTenant(c, message) {
+				return apis.NewNotFoundError("Message not found", nil)
+			}
+
+			expires := time.Now().Add(imageShareTTL).Truncate(time.Second)
+			return c.JSON(200, map[string]any{
+				"url":     imageShareURL(imageShareSecretFor(app), message.Id, expires),
+				"expires": expires.UTC(),
+			})
+		}, apis.RequireRecordAuth("users"))
+
 		e.Router.GET("/user_messages/archive", func(c echo.Context) error {
 			authRecord := c.Get(apis.ContextAuthRecordKey).(*models.Record)
 			authDetails, err := app.Dao().FindRecordById("user_details", authRecord.GetString("details"))
@@ -179,7 +352,7 @@ func setupRoutes(app *pocketbase.PocketBase) hook.Handler[*core.ServeEvent] {
 							"data":   map[string]int{"len": 1},
 						})
 
-						buf, err := imageRenderer.Render(imageTypeTwitter, msg)
+						buf, err := imageRenderer.Render(imageTypeTwitter, imageEncodingFor(imageFormatPNG), msg)
 						if err != nil {
 							errChan <- err
 							return
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"hash/fnv"
+	"math/bits"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/daos"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const simhashShingleSize = 3
+
+// normalizeContent lowercases the content, strips punctuation, collapses
+// whitespace and limits repeated characters to two ("heyyyy" -> "heyy") so
+// that trivial edits do not affect the similarity hash.
+func normalizeContent(content string) string {
+	sb := strings.Builder{}
+	lastChar := rune(0)
+	repeats := 0
+	pendingSpace := false
+
+	for _, char := range strings.ToLower(content) {
+		if !unicode.IsLetter(char) && !unicode.IsNumber(char) {
+			pendingSpace = true
+			lastChar = 0
+			continue
+		}
+
+		if char == lastChar {
+			repeats++
+		} else {
+			repeats = 0
+		}
+
+		lastChar = char
+		if repeats >= 2 {
+			continue
+		}
+
+		if pendingSpace && sb.Len() != 0 {
+			sb.WriteRune(' ')
+		}
+
+		pendingSpace = false
+		sb.WriteRune(char)
+	}
+
+	return sb.String()
+}
+
+// contentSimhash computes a 64-bit simhash from the character shingles of
+// the normalized content. similar contents produce hashes with a small
+// hamming distance.
+func contentSimhash(content string) uint64 {
+	chars := []rune(normalizeContent(content))
+	shingleSize := simhashShingleSize
+	if len(chars) < shingleSize {
+		shingleSize = len(chars)
+	}
+
+	weights := [64]int{}
+	for i := 0; shingleSize != 0 && i+shingleSize <= len(chars); i++ {
+		hasher := fnv.New64a()
+		hasher.Write([]byte(string(chars[i : i+shingleSize])))
+		shingleHash := hasher.Sum64()
+
+		for bit := 0; bit < 64; bit++ {
+			if shingleHash&(1<<bit) != 0 {
+				weights[bit]++
+			} else {
+				weights[bit]--
+			}
+		}
+	}
+
+	hash := uint64(0)
+	for bit, weight := range weights {
+		if weight > 0 {
+			hash |= 1 << bit
+		}
+	}
+
+	return hash
+}
+
+func isNearDuplicate(a, b uint64) bool {
+	return bits.OnesCount64(a^b) <= spamMaxDistance
+}
+
+// checkSpam rejects messages which are near-duplicates of the ones sent by
+// the same sender to the same recipient within the spam window. sending the
+// same content to too many recipients is rejected as well and the sender is
+// reported to the moderators.
+func checkSpam(dao *daos.Dao, record *models.Record) error {
+	userId := record.GetString("user")
+	if len(userId) == 0 {
+		return nil
+	}
+
+	since, err := types.ParseDateTime(time.Now().Add(-spamWindow))
+	if err != nil {
+		return err
+	}
+
+	recentMessages, err := dao.FindRecordsByExpr(
+		record.Collection().Name,
+		dbx.HashExp{"user": userId},
+		dbx.NewExp("created >= {:since}", dbx.Params{"since": since.String()}),
+	)
+	if err != nil {
+		passivePrintError(err)
+		return nil
+	}
+
+	recipient := record.GetString("recipient")
+	contentHash := contentSimhash(record.GetString("content"))
+	similarMessages := []*models.Record{}
+
+	for _, msg := range recentMessages {
+		if !isNearDuplicate(contentHash, contentSimhash(msg.GetString("content"))) {
+			continue
+		}
+
+		if msg.GetString("recipient") == recipient {
+			return apis.NewBadRequestError(
+				"You have posted a similar message to a similar recipient.", nil)
+		}
+
+		similarMessages = append(similarMessages, msg)
+	}
+
+	if len(similarMessages) >= spamMaxRecipients {
+		passivePrintError(reportSpamBurst(dao, userId, record, contentHash, similarMessages))
+
+		return apis.NewBadRequestError(
+			"You have sent a similar message to too many recipients. Please try again later.", nil)
+	}
+
+	return nil
+}
+
+// reportSpamBurst queues one of the similar messages for review since the
+// rejected message is never saved. the sender is only reported once
+// per similar content so that retries do not flood the queue.
+func reportSpamBurst(dao *daos.Dao, userId string, record *models.Record, contentHash uint64, similarMessages []*models.Record) error {
+	pending, err := dao.FindRecordsByExpr("moderation_queue", dbx.HashExp{
+		"user":   userId,
+		"reason": "spam_burst",
+		"status": "pending",
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range pending {
+		details := map[string]any{}
+		if err := entry.UnmarshalJSONField("details", &details); err != nil {
+			continue
+		}
+
+		if simhash, ok := details["simhash"].(string); ok {
+			if queuedHash, err := strconv.ParseUint(simhash, 16, 64); err == nil && isNearDuplicate(contentHash, queuedHash) {
+				return nil
+			}
+		}
+	}
+
+	messageIds := make([]string, len(similarMessages))
+	recipients := make([]string, len(similarMessages))
+	for i, msg := range similarMessages {
+		messageIds[i] = msg.Id
+		recipients[i] = msg.GetString("recipient")
+	}
+
+	return queueForModeration(dao, userId, similarMessages[len(similarMessages)-1], "spam_burst", map[string]any{
+		"simhash":            strconv.FormatUint(contentHash, 16),
+		"rejected_content":   record.GetString("content"),
+		"rejected_recipient": record.GetString("recipient"),
+		"similar_messages":   messageIds,
+		"similar_recipients": recipients,
+		"window":             spamWindow.String(),
+	})
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/tests"
+)
+
+func TestNormalizeContent(t *testing.T) {
+	cases := map[string]string{
+		"Hello,   World!!":      "hello world",
+		"heyyyyy crush":         "heyy crush",
+		"  I <3 you  ":          "i 3 you",
+		"See you @ the library": "see you the library",
+	}
+
+	for input, expected := range cases {
+		if got := normalizeContent(input); got != expected {
+			t.Errorf("normalizeContent(%q): expected %q, got %q", input, expected, got)
+		}
+	}
+}
+
+func TestIsNearDuplicate(t *testing.T) {
+	original := contentSimhash("I like you so much, see you at the library later!")
+
+	if !isNearDuplicate(original, contentSimhash("I like you so much, see you at the library laterr")) {
+		t.Error("Expected a one-character edit to be a near-duplicate")
+	}
+
+	if !isNearDuplicate(original, contentSimhash("I like u so much. See you at the library later")) {
+		t.Error("Expected a lightly edited message to be a near-duplicate")
+	}
+
+	if isNearDuplicate(original, contentSimhash("Happy valentines day to my favorite classmate")) {
+		t.Error("Expected unrelated messages not to be near-duplicates")
+	}
+}
+
+func saveTestMessage(t *testing.T, app *tests.TestApp, userId, recipient, content string) *models.Record {
+	t.Helper()
+
+	collection, _ := app.Dao().FindCollectionByNameOrId("messages")
+	message := models.NewRecord(collection)
+	message.Set("user", userId)
+	message.Set("recipient", recipient)
+	message.Set("content", content)
+	message.Set("season", currentSeason)
+	message.Set("tenant", defaultTenant)
+	if err := app.Dao().SaveRecord(message); err != nil {
+		t.Fatalf("Failed to save message: %v", err)
+	}
+
+	return message
+}
+
+func TestCheckSpam_SameRecipient(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Cleanup()
+
+	saveTestMessage(t, app, "sender1", "202087654321", "I like you so much, see you at the library later!")
+
+	collection, _ := app.Dao().FindCollectionByNameOrId("messages")
+	message := models.NewRecord(collection)
+	message.Set("user", "sender1")
+	message.Set("recipient", "202087654321")
+	message.Set("content", "I like you so much, see you at the library later!!!1")
+
+	if err := checkSpam(app.Dao(), message); err == nil {
+		t.Error("Expected near-duplicate to the same recipient to be rejected, got nil")
+	}
+
+	message.Set("user", "sender2")
+	if err := checkSpam(app.Dao(), message); err != nil {
+		t.Errorf("Expected near-duplicate from another sender to pass, got: %v", err)
+	}
+}
+
+func TestCheckSpam_BurstQueuedForModeration(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Cleanup()
+
+	content := "You are the love of my life, please be my valentine"
+	for _, recipient := range []string{"202000000001", "202000000002", "202000000003"} {
+		saveTestMessage(t, app, "sender1", recipient, content)
+	}
+
+	collection, _ := app.Dao().FindCollectionByNameOrId("messages")
+	message := models.NewRecord(collection)
+	message.Set("user", "sender1")
+	message.Set("recipient", "202000000004")
+	message.Set("content", content+"!")
+
+	if err := checkSpam(app.Dao(), message); err == nil {
+		t.Fatal("Expected burst to be rejected, got nil")
+	}
+
+	// retrying the same content should not queue it again
+	message.Set("content", content+"!!")
+	if err := checkSpam(app.Dao(), message); err == nil {
+		t.Fatal("Expected retried burst to be rejected, got nil")
+	}
+
+	queued, err := app.Dao().FindRecordsByExpr("moderation_queue", dbx.HashExp{"user": "sender1"})
+	if err != nil {
+		t.Fatalf("Failed to query moderation queue: %v", err)
+	}
+
+	if len(queued) != 1 {
+		t.Fatalf("Expected 1 moderation queue entry, got %d", len(queued))
+	}
+
+	if queued[0].GetString("reason") != "spam_burst" || queued[0].GetString("status") != "pending" {
+		t.Errorf("Unexpected moderation queue entry: reason=%s status=%s", queued[0].GetString("reason"), queued[0].GetString("status"))
+	}
+
+	if _, err := app.Dao().FindRecordById("messages", queued[0].GetString("record")); err != nil {
+		t.Errorf("Expected the entry to point to a saved message, got %q", queued[0].GetString("record"))
+	}
+}
@@ -2,20 +2,25 @@
   <head>
     <title>image</title>
     <style>
-      /* lato-regular - latin */
+      {{ range .Theme.Fonts }}
       @font-face {
-        font-family: 'Lato';
+        font-family: '{{ .Family }}';
         font-style: normal;
         font-weight: 400;
-        src: url('{{ .BackendURL }}/renderer_assets/fonts/lato/lato-v22-latin-regular.eot'); /* IE9 Compat Modes */
-        src: 
-            url('{{ .BackendURL }}/renderer_assets/fonts/lato/lato-v22-latin-regular.eot?#iefix') format('embedded-opentype'), /* IE6-IE8 */
-            url('{{ .BackendURL }}/renderer_assets/fonts/lato/lato-v22-latin-regular.woff2') format('woff2'), /* Super Modern Browsers */
-            url('{{ .BackendURL }}/renderer_assets/fonts/lato/lato-v22-latin-regular.woff') format('woff'), /* Modern Browsers */
-            url('{{ .BackendURL }}/renderer_assets/fonts/lato/lato-v22-latin-regular.ttf') format('truetype'), /* Safari, Android, iOS */
-            url('{{ .BackendURL }}/renderer_assets/fonts/lato/lato-v22-latin-regular.svg#Lato') format('svg'); /* Legacy iOS */
+        src:
+            url('{{ $.BackendURL }}/renderer_assets/fonts/{{ .Path }}.woff2') format('woff2'),
+            url('{{ $.BackendURL }}/renderer_assets/fonts/{{ .Path }}.ttf') format('truetype');
       }
-
+      {{ end }}
+    </style>
+    {{ if .Theme.BackgroundImage }}
+    <style>
+      .image-wrapper {
+        background-image: url('{{ .BackendURL }}/renderer_assets/images/{{ .Theme.BackgroundImage }}');
+      }
+    </style>
+    {{ end }}
+    <style>
       * {
         box-sizing: border-box;
       }
@@ -27,16 +32,21 @@
         margin: 0;
       }
       .image-wrapper {
-        width: 1200px;
-        height: 675px;
-        background-image: url({{ .BackendURL }}/renderer_assets/images/background.png);
+        width: {{ .Width }}px;
+        height: {{ .Height }}px;
+        background-color: {{ .Theme.Palette.Background }};
         background-size: cover;
         padding: 3rem 6rem;
         position: relative;
         overflow: hidden;
       }
       .image-wrapper .content-wrapper {
-        background: rgb(254, 243, 199);
+        background: {{ .Theme.Palette.Paper }};
+        {{ with .Theme.Palette.Lines }}
+        /* lined paper */
+        background: linear-gradient(to bottom, {{ $.Theme.Palette.Paper }} 3.35rem, {{ . }} 1px);
+        background-size: 100% 3.5rem;
+        {{ end }}
         height: 100%;
         border-radius: 2rem;
         padding-left:3rem;
@@ -50,7 +60,8 @@
       }
 
       .image-wrapper .content-wrapper .content {
-        font-family: 'Lato', 'Segoe UI', Tahoma, Geneva, Verdana, sans-serif;
+        font-family: '{{ .Theme.ContentFont.Family }}', 'Segoe UI', Tahoma, Geneva, Verdana, sans-serif;
+        color: {{ .Theme.Palette.Text }};
         text-align: center;
         justify-self: center;
         align-self: center;
@@ -64,8 +75,8 @@
         margin-bottom: auto;
       }
       .image-wrapper .content-wrapper .timestamp {
-        font-family: 'Lato', 'Segoe UI', Tahoma, Geneva, Verdana, sans-serif;
-        color: rgb(10, 10, 10);
+        font-family: '{{ .Theme.FooterFont.Family }}', 'Segoe UI', Tahoma, Geneva, Verdana, sans-serif;
+        color: {{ .Theme.Palette.Footer }};
         position: relative;
         top: 1rem;
       }
@@ -93,6 +104,33 @@
         filter: drop-shadow(1px 4px 8px rgba(128, 6, 42, 0.678));
       }
 
+      /* instagram story (9:16) */
+      .image-wrapper.story {
+        padding: 10rem 4rem 16rem;
+      }
+      .image-wrapper.story .content-wrapper .content {
+        font-size: 4.5rem;
+      }
+      .image-wrapper.story .logo {
+        bottom: 4%;
+        width: 55%;
+      }
+      .image-wrapper.story .gift-0, .image-wrapper.story .gift-1, .image-wrapper.story .gift-2 {
+        width: 24%;
+      }
+
+      /* instagram square (1:1) */
+      .image-wrapper.square {
+        padding: 4rem 4rem 9rem;
+      }
+      .image-wrapper.square .logo {
+        bottom: 2%;
+        width: 40%;
+      }
+      .image-wrapper.square .gift-0, .image-wrapper.square .gift-1, .image-wrapper.square .gift-2 {
+        width: 18%;
+      }
+
       .gift-0 {
         bottom: 5%;
         right: 5%;
@@ -113,7 +151,7 @@
     </style>
   </head>
   <body>
-    <div id="image-preview" class="image-wrapper">
+    <div id="image-preview" class="image-wrapper {{ .Type }}">
       <div class="content-wrapper">
         <div class="content">
           {{ range $i, $content := (split (.RawMessage.GetString "content")) }}
@@ -1,10 +1,12 @@
 Hello, {{ .Email }}!
 
-Welcome to UIC Valentine Wall! From here you can now do the following with your newly created account:
+Welcome to {{ .SiteName }}! From here you can now do the following with your newly created account:
 
-- Post, confess, or share your thoughts to your fellow ignacian anonymously!
+- Post, confess, or share your thoughts to your fellow {{ .CommunityName }} anonymously!
 - No money? No problem! You can also send virtual gifts alongside your message!
 - Receive gifts and messages from others. Reply them back to show your appreciation!
-
+{{ with .Stats }}{{ if .MessagesCount }}
+Prior to creating your account, your ID has received {{ .MessagesCount }} messages and {{ .GiftMessagesCount }} gifts.
+{{ end }}{{ end }}
 Make your valentines day well spent online! Good luck and have a nice day!
 - Mr. Kupido
\ No newline at end of file
@@ -0,0 +1,444 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/labstack/echo/v5"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/daos"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/resolvers"
+	"github.com/pocketbase/pocketbase/tools/hook"
+	"github.com/pocketbase/pocketbase/tools/search"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const (
+	tenantHeader     = "X-Tenant"
+	tenantContextKey = "tenant"
+)
+
+var defaultStudentIdPattern = regexp.MustCompile(`^[0-9]{6,12}$`)
+
+// TenantInfo is the public part of a tenant used by the frontend for its
+// branding and pricing.
+type TenantInfo struct {
+	UID       string         `json:"uid"`
+	Name      string         `json:"name"`
+	Branding  map[string]any `json:"branding"`
+	SendPrice float64        `json:"send_price"`
+}
+
+func newTenantInfo(tenant *models.Record) *TenantInfo {
+	info := &TenantInfo{
+		UID:       tenantId(tenant),
+		Name:      tenantId(tenant),
+		Branding:  map[string]any{},
+		SendPrice: tenantSendPrice(tenant),
+	}
+
+	if tenant != nil {
+		info.Name = tenant.GetString("name")
+		decodeTenantField(tenant, "branding", &info.Branding)
+	}
+
+	return info
+}
+
+// tenantSiteName returns the site name from the branding of the tenant
+func tenantSiteName(tenant *models.Record) string {
+	if name, _ := newTenantInfo(tenant).Branding["site_name"].(string); len(name) != 0 {
+		return name
+	}
+	return defaultSiteName
+}
+
+// tenantCommunityName returns what the students of the tenant are called
+// (e.g. "ignacians") from its branding
+func tenantCommunityName(tenant *models.Record) string {
+	if name, _ := newTenantInfo(tenant).Branding["community_name"].(string); len(name) != 0 {
+		return name
+	}
+	return "students"
+}
+
+func decodeTenantField(tenant *models.Record, field string, dst any) {
+	if raw, ok := tenant.Get(field).(types.JsonRaw); ok && len(raw) != 0 {
+		passivePrintError(json.Unmarshal(raw, dst))
+	}
+}
+
+// tenantId returns the uid of the tenant. defaultTenant is used when no
+// tenant has been resolved.
+func tenantId(tenant *models.Record) string {
+	if tenant == nil {
+		return defaultTenant
+	}
+	return tenant.GetString("uid")
+}
+
+func tenantSendPrice(tenant *models.Record) float64 {
+	if tenant != nil && tenant.GetFloat("send_price") > 0 {
+		return tenant.GetFloat("send_price")
+	}
+	return sendPrice
+}
+
+// findTenant finds a tenant by its uid. it returns nil if the tenant does
+// not exist so that deployments without tenants keep working.
+func findTenant(dao *daos.Dao, uid string) *models.Record {
+	tenants, err := dao.FindRecordsByExpr("tenants", dbx.HashExp{"uid": uid})
+	if err != nil || len(tenants) == 0 {
+		return nil
+	}
+	return tenants[0]
+}
+
+// tenantIds returns the uids of every tenant or only the default one if
+// no tenant has been created yet.
+func tenantIds(dao *daos.Dao) []string {
+	tenants, err := dao.FindRecordsByExpr("tenants")
+	if err != nil || len(tenants) == 0 {
+		return []string{defaultTenant}
+	}
+
+	ids := make([]string, len(tenants))
+	for i, tenant := range tenants {
+		ids[i] = tenant.GetString("uid")
+	}
+	return ids
+}
+
+// tenantsCache maps the host names and uids to their tenants so that the
+// tenant of a request is resolved without querying the database. it is
+// cleared whenever a tenant is saved or deleted.
+var tenantsCache = struct {
+	sync.RWMutex
+	loaded bool
+	byHost map[string]*models.Record
+	byUid  map[string]*models.Record
+}{}
+
+func loadTenantsCache(dao *daos.Dao) error {
+	tenantsCache.RLock()
+	loaded := tenantsCache.loaded
+	tenantsCache.RUnlock()
+	if loaded {
+		return nil
+	}
+
+	tenants, err := dao.FindRecordsByExpr("tenants")
+	if err != nil {
+		return err
+	}
+
+	byHost := map[string]*models.Record{}
+	byUid := map[string]*models.Record{}
+	for _, tenant := range tenants {
+		byUid[tenant.GetString("uid")] = tenant
+
+		hosts := []string{}
+		decodeTenantField(tenant, "hosts", &hosts)
+		for _, host := range hosts {
+			byHost[strings.ToLower(host)] = tenant
+		}
+	}
+
+	tenantsCache.Lock()
+	defer tenantsCache.Unlock()
+	tenantsCache.byHost = byHost
+	tenantsCache.byUid = byUid
+	tenantsCache.loaded = true
+	return nil
+}
+
+func invalidateTenantsCache() {
+	tenantsCache.Lock()
+	defer tenantsCache.Unlock()
+	tenantsCache.loaded = false
+}
+
+// resolveTenant finds the tenant from the tenant header first and then
+// from the host name of the request, falling back to the default tenant.
+func resolveTenant(dao *daos.Dao, host string, header string) (*models.Record, error) {
+	if err := loadTenantsCache(dao); err != nil {
+		return nil, err
+	}
+
+	tenantsCache.RLock()
+	defer tenantsCache.RUnlock()
+
+	if len(header) != 0 {
+		if tenant := tenantsCache.byUid[header]; tenant != nil {
+			return tenant, nil
+		}
+		return nil, fmt.Errorf("unknown tenant '%s'", header)
+	}
+
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+
+	if tenant := tenantsCache.byHost[strings.ToLower(host)]; tenant != nil {
+		return tenant, nil
+	}
+
+	return tenantsCache.byUid[defaultTenant], nil
+}
+
+func tenantMiddleware(app core.App) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			// the header lets admins manage the other campuses. users
+			// are bound to the campus of the site they are on.
+			header := ""
+			admin, _ := c.Get(apis.ContextAdminKey).(*models.Admin)
+			if admin != nil {
+				header = c.Request().Header.Get(tenantHeader)
+			}
+
+			tenant, err := resolveTenant(app.Dao(), c.Request().Host, header)
+			if err != nil {
+				return apis.NewNotFoundError("Tenant not found.", err)
+			}
+
+			c.Set(tenantContextKey, tenant)
+			if admin == nil {
+				if collection := tenantScopedListCollection(app.Dao(), c); collection != nil {
+					return apis.ActivityLogger(app)(func(c echo.Context) error {
+						return listTenantRecords(app, c, collection, tenant)
+					})(c)
+				}
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// isTenantScopedCollection tells whether users only see the records of
+// the collection that belong to their campus
+func isTenantScopedCollection(collection *models.Collection) bool {
+	return collection.Name == "messages" || collection.Name == "rankings" || collection.Name == "ranking_snapshots"
+}
+
+// isRecordOfRequestTenant tells whether the record can be shown on the
+// campus of the request. admins can see the records of every campus.
+func isRecordOfRequestTenant(c echo.Context, record *models.Record) bool {
+	if admin, _ := c.Get(apis.ContextAdminKey).(*models.Admin); admin != nil || !isTenantScopedCollection(record.Collection()) {
+		return true
+	}
+	return record.GetString("tenant") == tenantId(tenantFromContext(c))
+}
+
+// tenantScopedListCollection returns the collection of record list
+// requests of the tenant-scoped collections, nil for any other request.
+func tenantScopedListCollection(dao *daos.Dao, c echo.Context) *models.Collection {
+	req := c.Request()
+	if req.Method != http.MethodGet {
+		return nil
+	}
+
+	parts := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+	if len(parts) != 4 || parts[0] != "api" || parts[1] != "collections" || parts[3] != "records" {
+		return nil
+	}
+
+	collection, err := dao.FindCollectionByNameOrId(parts[2])
+	if err != nil || !isTenantScopedCollection(collection) {
+		return nil
+	}
+	return collection
+}
+
+// listTenantRecords lists the records the same way the collection API does
+// but only from the tenant. the collection rules can only scope signed-in
+// users by their own campus so the tenant is added to the query itself,
+// apart from the filter of the request.
+func listTenantRecords(app core.App, c echo.Context, collection *models.Collection, tenant *models.Record) error {
+	// same as the collection API, only admins can filter by these
+	decodedQuery := c.QueryParam(search.FilterQueryParam) + c.QueryParam(search.SortQueryParam)
+	if strings.Contains(decodedQuery, "@collection.") || strings.Contains(decodedQuery, "@request.") {
+		return apis.NewForbiddenError("Only admins can filter by @collection and @request query params", nil)
+	}
+
+	if collection.ListRule == nil {
+		return apis.NewForbiddenError("Only admins can perform this action.", nil)
+	}
+
+	c.Set(apis.ContextCollectionKey, collection)
+	requestData := apis.RequestData(c)
+	fieldsResolver := resolvers.NewRecordFieldResolver(app.Dao(), collection, requestData, false)
+
+	query := app.Dao().RecordQuery(collection).
+		AndWhere(dbx.HashExp{collection.Name + ".tenant": tenantId(tenant)})
+
+	searchProvider := search.NewProvider(fieldsResolver).Query(query)
+	searchProvider.AddFilter(search.FilterData(*collection.ListRule))
+
+	rawRecords := []dbx.NullStringMap{}
+	result, err := searchProvider.ParseAndExec(c.QueryParams().Encode(), &rawRecords)
+	if err != nil {
+		return apis.NewBadRequestError("Invalid filter parameters.", err)
+	}
+
+	records := models.NewRecordsFromNullStringMaps(collection, rawRecords)
+	result.Items = records
+
+	event := &core.RecordsListEvent{
+		HttpContext: c,
+		Collection:  collection,
+		Records:     records,
+		Result:      result,
+	}
+
+	return app.OnRecordsListRequest().Trigger(event, func(e *core.RecordsListEvent) error {
+		passivePrintError(apis.EnrichRecords(e.HttpContext, app.Dao(), e.Records))
+		return e.HttpContext.JSON(http.StatusOK, e.Result)
+	})
+}
+
+// isTenantScopedTopic tells whether the realtime subscription is for the
+// records of a tenant-scoped collection (e.g. "messages/*")
+func isTenantScopedTopic(dao *daos.Dao, topic string) bool {
+	collectionNameOrId, _, _ := strings.Cut(topic, "/")
+	collection, err := dao.FindCollectionByNameOrId(collectionNameOrId)
+	return err == nil && isTenantScopedCollection(collection)
+}
+
+// registerTenantHooks keeps the tenant cache fresh and hides the records
+// of other campuses from the view requests and realtime events sent to
+// non-admins
+func registerTenantHooks(app core.App) {
+	invalidate := func(e *core.ModelEvent) error {
+		if e.Model.TableName() == "tenants" {
+			invalidateTenantsCache()
+		}
+		return nil
+	}
+
+	app.OnModelAfterCreate().Add(invalidate)
+	app.OnModelAfterUpdate().Add(invalidate)
+	app.OnModelAfterDelete().Add(invalidate)
+
+	app.OnRecordViewRequest().Add(func(e *core.RecordViewEvent) error {
+		if !isRecordOfRequestTenant(e.HttpContext, e.Record) {
+			return apis.NewNotFoundError("", nil)
+		}
+		return nil
+	})
+
+	// the http context of realtime events is the one of the connection so
+	// it holds the tenant of the client
+	app.OnRealtimeBeforeMessageSend().Add(func(e *core.RealtimeMessageEvent) error {
+		if admin, _ := e.Client.Get(apis.ContextAdminKey).(*models.Admin); admin != nil || !isTenantScopedTopic(app.Dao(), e.Message.Name) {
+			return nil
+		}
+
+		data := struct {
+			Record struct {
+				Tenant string `json:"tenant"`
+			} `json:"record"`
+		}{}
+		if err := json.Unmarshal([]byte(e.Message.Data), &data); err != nil {
+			return err
+		}
+
+		if data.Record.Tenant != tenantId(tenantFromContext(e.HttpContext)) {
+			// skips sending the message without closing the connection
+			return hook.StopPropagation
+		}
+		return nil
+	})
+}
+
+func tenantFromContext(c echo.Context) *models.Record {
+	if c == nil {
+		return nil
+	}
+
+	tenant, _ := c.Get(tenantContextKey).(*models.Record)
+	return tenant
+}
+
+// checkStudentId validates the student id against the pattern of the
+// tenant.
+func checkStudentId(tenant *models.Record, studentId string) error {
+	pattern := defaultStudentIdPattern
+	if tenant != nil && len(tenant.GetString("student_id_pattern")) != 0 {
+		var err error
+		if pattern, err = regexp.Compile(tenant.GetString("student_id_pattern")); err != nil {
+			return err
+		}
+	}
+
+	if !pattern.MatchString(studentId) {
+		return apis.NewBadRequestError("Invalid student ID.", nil)
+	}
+
+	return nil
+}
+
+// checkEmailDomain only allows emails from the domains of the tenant. any
+// email is allowed if the tenant does not list its domains.
+func checkEmailDomain(tenant *models.Record, email string) error {
+	if tenant == nil {
+		return nil
+	}
+
+	domains := []string{}
+	decodeTenantField(tenant, "email_domains", &domains)
+	if len(domains) == 0 {
+		return nil
+	}
+
+	_, domain, _ := strings.Cut(email, "@")
+	for _, allowed := range domains {
+		if strings.EqualFold(domain, allowed) {
+			return nil
+		}
+	}
+
+	return apis.NewForbiddenError(fmt.Sprintf("Only emails from %s can sign up on %s.", strings.Join(domains, ", "), tenant.GetString("name")), nil)
+}
+
+// onBeforeAddUserDetails links the details to the tenant of the request
+func onBeforeAddUserDetails(dao *daos.Dao, e *core.RecordCreateEvent) error {
+	tenant := tenantFromContext(e.HttpContext)
+	e.Record.Set("tenant", tenantId(tenant))
+
+	if err := checkStudentId(tenant, e.Record.GetString("student_id")); err != nil {
+		return err
+	}
+
+	user, err := dao.FindRecordById("users", e.Record.GetString("user"))
+	if err != nil {
+		return err
+	}
+
+	return checkEmailDomain(tenant, user.Email())
+}
+
+// checkTenantUnchanged prevents users from moving their details to
+// another tenant.
+func checkTenantUnchanged(e *core.RecordUpdateEvent) error {
+	if e.HttpContext != nil {
+		if admin, _ := e.HttpContext.Get(apis.ContextAdminKey).(*models.Admin); admin != nil {
+			return nil
+		}
+	}
+
+	if e.Record.GetString("tenant") != e.Record.OriginalCopy().GetString("tenant") {
+		return apis.NewForbiddenError("You are not allowed to change your campus.", nil)
+	}
+
+	return nil
+}
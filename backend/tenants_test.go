@@ -0,0 +1,279 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v5"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/tests"
+	"github.com/pocketbase/pocketbase/tools/subscriptions"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func saveTestTenant(t *testing.T, app *tests.TestApp, uid string, hosts []string, emailDomains []string) *models.Record {
+	t.Helper()
+
+	collection, _ := app.Dao().FindCollectionByNameOrId("tenants")
+	tenant := models.NewRecord(collection)
+	tenant.Set("uid", uid)
+	tenant.Set("name", uid)
+	tenant.Set("hosts", hosts)
+	tenant.Set("email_domains", emailDomains)
+	if err := app.Dao().SaveRecord(tenant); err != nil {
+		t.Fatalf("Failed to save tenant: %v", err)
+	}
+
+	// the hooks that clear the cache are not bound in the tests
+	invalidateTenantsCache()
+	return tenant
+}
+
+func TestResolveTenant(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Cleanup()
+
+	dao := app.Dao()
+	saveTestTenant(t, app, defaultTenant, []string{"valentines.uic.edu.ph"}, nil)
+	saveTestTenant(t, app, "addu", []string{"valentines.addu.edu.ph"}, nil)
+
+	cases := []struct {
+		host     string
+		header   string
+		expected string
+	}{
+		{"valentines.addu.edu.ph", "", "addu"},
+		{"VALENTINES.ADDU.EDU.PH:443", "", "addu"},
+		{"valentines.addu.edu.ph", defaultTenant, defaultTenant},
+		{"localhost:8090", "", defaultTenant},
+	}
+
+	for _, c := range cases {
+		tenant, err := resolveTenant(dao, c.host, c.header)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", c.host, err)
+		} else if got := tenantId(tenant); got != c.expected {
+			t.Errorf("%s: expected tenant %q, got %q", c.host, c.expected, got)
+		}
+	}
+
+	if _, err := resolveTenant(dao, "localhost", "unknown"); err == nil {
+		t.Error("Expected error for unknown tenant header, got nil")
+	}
+}
+
+func TestTenantMiddleware(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Cleanup()
+
+	saveTestTenant(t, app, defaultTenant, []string{"valentines.uic.edu.ph"}, nil)
+	saveTestTenant(t, app, "addu", []string{"valentines.addu.edu.ph"}, nil)
+
+	messages, _ := app.Dao().FindCollectionByNameOrId("messages")
+	messages.ListRule = types.Pointer("")
+	if err := app.Dao().SaveCollection(messages); err != nil {
+		t.Fatalf("Failed to update messages collection: %v", err)
+	}
+
+	uicMessage := saveTestMessage(t, app, "user1", "everyone", "Happy valentines!")
+	adduMessage := saveTestMessage(t, app, "user2", "everyone", "Happy valentines from Davao!")
+	adduMessage.Set("tenant", "addu")
+	if err := app.Dao().SaveRecord(adduMessage); err != nil {
+		t.Fatalf("Failed to save message: %v", err)
+	}
+
+	nextCalled := false
+	serve := func(target string, admin *models.Admin) (echo.Context, *httptest.ResponseRecorder, error) {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Host = "valentines.uic.edu.ph"
+		req.Header.Set(tenantHeader, "addu")
+
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		if admin != nil {
+			c.Set(apis.ContextAdminKey, admin)
+		}
+
+		nextCalled = false
+		return c, rec, tenantMiddleware(app)(func(c echo.Context) error {
+			nextCalled = true
+			return nil
+		})(c)
+	}
+
+	listedIds := func(rec *httptest.ResponseRecorder) []string {
+		result := struct {
+			Items []struct {
+				Id string `json:"id"`
+			} `json:"items"`
+		}{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+			t.Fatalf("Failed to decode list response: %v", err)
+		}
+
+		ids := []string{}
+		for _, item := range result.Items {
+			ids = append(ids, item.Id)
+		}
+		return ids
+	}
+
+	// the filter tries to close the parenthesis around itself to get out
+	// of the tenant condition
+	for _, filter := range []string{`recipient="everyone"`, `id != "") || (id != ""`, `id != ""`} {
+		c, rec, err := serve("/api/collections/messages/records?filter="+url.QueryEscape(filter), nil)
+		if err != nil {
+			// the filter is parsed on its own so the payload is invalid
+			if apiErr, ok := err.(*apis.ApiError); ok && apiErr.Code == http.StatusBadRequest {
+				continue
+			}
+			t.Fatalf("%s: unexpected error: %v", filter, err)
+		}
+
+		if got := tenantId(tenantFromContext(c)); got != defaultTenant {
+			t.Errorf("%s: expected the tenant header to be ignored for users, got %q", filter, got)
+		}
+
+		if nextCalled {
+			t.Fatalf("%s: expected the list to be served by the tenant-scoped handler", filter)
+		}
+
+		if ids := listedIds(rec); !reflect.DeepEqual(ids, []string{uicMessage.Id}) {
+			t.Errorf("%s: expected only the messages of the tenant, got %v", filter, ids)
+		}
+	}
+
+	c, _, _ := serve("/api/collections/messages/records", &models.Admin{})
+	if got := tenantId(tenantFromContext(c)); got != "addu" {
+		t.Errorf("Expected the tenant header to be used for admins, got %q", got)
+	}
+
+	if !nextCalled {
+		t.Error("Expected admin lists not to be scoped")
+	}
+
+	serve("/api/collections/message_replies/records", nil)
+	if !nextCalled {
+		t.Error("Expected other collections not to be scoped")
+	}
+}
+
+func TestTenantRealtimeMessages(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Cleanup()
+
+	registerTenantHooks(app)
+
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/api/realtime", nil), httptest.NewRecorder())
+	c.Set(tenantContextKey, saveTestTenant(t, app, defaultTenant, nil, nil))
+
+	cases := []struct {
+		topic    string
+		tenant   string
+		expected bool
+	}{
+		{"messages/*", defaultTenant, true},
+		{"messages/*", "addu", false},
+		{"message_replies/*", "addu", true},
+		{"PB_CONNECT", "", true},
+	}
+
+	for _, tc := range cases {
+		sent := false
+		event := &core.RealtimeMessageEvent{
+			HttpContext: c,
+			Client:      subscriptions.NewDefaultClient(),
+			Message: &subscriptions.Message{
+				Name: tc.topic,
+				Data: `{"action":"create","record":{"tenant":"` + tc.tenant + `"}}`,
+			},
+		}
+
+		err := app.OnRealtimeBeforeMessageSend().Trigger(event, func(e *core.RealtimeMessageEvent) error {
+			sent = true
+			return nil
+		})
+		if err != nil {
+			t.Errorf("%s (%s): unexpected error: %v", tc.topic, tc.tenant, err)
+		}
+
+		if sent != tc.expected {
+			t.Errorf("%s (%s): expected sent to be %v, got %v", tc.topic, tc.tenant, tc.expected, sent)
+		}
+	}
+}
+
+func TestCheckStudentId(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Cleanup()
+
+	if err := checkStudentId(nil, "202012345678"); err != nil {
+		t.Errorf("Expected default pattern to accept student ID, got: %v", err)
+	}
+
+	if err := checkStudentId(nil, "A-2020-001"); err == nil {
+		t.Error("Expected default pattern to reject student ID, got nil")
+	}
+
+	tenant := saveTestTenant(t, app, "addu", nil, nil)
+	tenant.Set("student_id_pattern", `^[A-Z]-[0-9]{4}-[0-9]{3}$`)
+
+	if err := checkStudentId(tenant, "A-2020-001"); err != nil {
+		t.Errorf("Expected tenant pattern to accept student ID, got: %v", err)
+	}
+
+	if err := checkStudentId(tenant, "202012345678"); err == nil {
+		t.Error("Expected tenant pattern to reject student ID, got nil")
+	}
+}
+
+func TestCheckEmailDomain(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Cleanup()
+
+	tenant := saveTestTenant(t, app, defaultTenant, nil, []string{"uic.edu.ph"})
+
+	if err := checkEmailDomain(tenant, "student@UIC.edu.ph"); err != nil {
+		t.Errorf("Expected email to be allowed, got: %v", err)
+	}
+
+	if err := checkEmailDomain(tenant, "student@gmail.com"); err == nil {
+		t.Error("Expected email from another domain to be rejected, got nil")
+	}
+
+	if err := checkEmailDomain(saveTestTenant(t, app, "open", nil, nil), "student@gmail.com"); err != nil {
+		t.Errorf("Expected any email to be allowed without domains, got: %v", err)
+	}
+}
+
+func TestQueryLeaderboard_TenantIsolation(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Cleanup()
+
+	dao := app.Dao()
+	saveTestRanking(t, app, "202000000001", 150)
+	other := saveTestRanking(t, app, "202000000002", 300)
+	other.Set("tenant", "addu")
+	dao.SaveRecord(other)
+
+	addTestRankingBucket(t, dao, defaultTenant, "202000000001", time.Now(), 150)
+	addTestRankingBucket(t, dao, "addu", "202000000002", time.Now(), 300)
+
+	for tenantId, expected := range map[string]string{defaultTenant: "202000000001", "addu": "202000000002"} {
+		recipients, err := queryLeaderboard(dao, tenantId, currentSeasonId(dao), "")
+		if err != nil {
+			t.Fatalf("queryLeaderboard failed: %v", err)
+		}
+
+		if len(recipients) != 1 || recipients[0].RecipientID != expected {
+			t.Errorf("%s: expected only %s on the leaderboard, got %+v", tenantId, expected, recipients)
+		}
+	}
+}
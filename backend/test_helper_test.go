@@ -29,6 +29,11 @@ func newTestApp(t *testing.T) *tests.TestApp {
 		&schema.SchemaField{Name: "user", Type: schema.FieldTypeText},
 		&schema.SchemaField{Name: "replies_count", Type: schema.FieldTypeNumber},
 		&schema.SchemaField{Name: "gifts", Type: schema.FieldTypeJson},
+		&schema.SchemaField{Name: "season", Type: schema.FieldTypeText},
+		&schema.SchemaField{Name: "theme", Type: schema.FieldTypeText},
+		&schema.SchemaField{Name: "tenant", Type: schema.FieldTypeText},
+		&schema.SchemaField{Name: "hidden", Type: schema.FieldTypeBool},
+		&schema.SchemaField{Name: "send_price", Type: schema.FieldTypeNumber},
 	)
 	if err := dao.SaveCollection(messages); err != nil {
 		app.Cleanup()
@@ -44,6 +49,10 @@ func newTestApp(t *testing.T) *tests.TestApp {
 		&schema.SchemaField{Name: "student_id", Type: schema.FieldTypeText},
 		&schema.SchemaField{Name: "email", Type: schema.FieldTypeText},
 		&schema.SchemaField{Name: "last_active", Type: schema.FieldTypeDate},
+		&schema.SchemaField{Name: "college_department", Type: schema.FieldTypeText},
+		&schema.SchemaField{Name: "sex", Type: schema.FieldTypeText},
+		&schema.SchemaField{Name: "hide_from_leaderboards", Type: schema.FieldTypeBool},
+		&schema.SchemaField{Name: "tenant", Type: schema.FieldTypeText},
 	)
 	if err := dao.SaveCollection(userDetails); err != nil {
 		app.Cleanup()
@@ -57,6 +66,8 @@ func newTestApp(t *testing.T) *tests.TestApp {
 	wallets.Schema = schema.NewSchema(
 		&schema.SchemaField{Name: "user", Type: schema.FieldTypeText},
 		&schema.SchemaField{Name: "balance", Type: schema.FieldTypeNumber},
+		&schema.SchemaField{Name: "season", Type: schema.FieldTypeText},
+		&schema.SchemaField{Name: "tenant", Type: schema.FieldTypeText},
 	)
 	if err := dao.SaveCollection(wallets); err != nil {
 		app.Cleanup()
@@ -92,12 +103,158 @@ func newTestApp(t *testing.T) *tests.TestApp {
 			MaxSelect:    ptrInt(1),
 		}},
 		&schema.SchemaField{Name: "liked", Type: schema.FieldTypeBool},
+		&schema.SchemaField{Name: "hidden", Type: schema.FieldTypeBool},
 	)
 	if err := dao.SaveCollection(replies); err != nil {
 		app.Cleanup()
 		t.Fatalf("Failed to create message_replies collection: %v", err)
 	}
 
+	// Create "college_departments" collection
+	departments := &models.Collection{}
+	departments.Name = "college_departments"
+	departments.Type = models.CollectionTypeBase
+	departments.Schema = schema.NewSchema(
+		&schema.SchemaField{Name: "uid", Type: schema.FieldTypeText},
+		&schema.SchemaField{Name: "label", Type: schema.FieldTypeText},
+		&schema.SchemaField{Name: "tenant", Type: schema.FieldTypeText},
+	)
+	if err := dao.SaveCollection(departments); err != nil {
+		app.Cleanup()
+		t.Fatalf("Failed to create college_departments collection: %v", err)
+	}
+
+	// Create "gifts" collection
+	gifts := &models.Collection{}
+	gifts.Name = "gifts"
+	gifts.Type = models.CollectionTypeBase
+	gifts.Schema = schema.NewSchema(
+		&schema.SchemaField{Name: "uid", Type: schema.FieldTypeText},
+		&schema.SchemaField{Name: "label", Type: schema.FieldTypeText},
+		&schema.SchemaField{Name: "price", Type: schema.FieldTypeNumber},
+		&schema.SchemaField{Name: "is_remittable", Type: schema.FieldTypeBool},
+	)
+	if err := dao.SaveCollection(gifts); err != nil {
+		app.Cleanup()
+		t.Fatalf("Failed to create gifts collection: %v", err)
+	}
+
+	// Create "rankings" collection
+	rankings := &models.Collection{}
+	rankings.Name = "rankings"
+	rankings.Type = models.CollectionTypeBase
+	rankings.Schema = schema.NewSchema(
+		&schema.SchemaField{Name: "recipient", Type: schema.FieldTypeText},
+		&schema.SchemaField{Name: "total_coins", Type: schema.FieldTypeText},
+		&schema.SchemaField{Name: "college_department", Type: schema.FieldTypeText},
+		&schema.SchemaField{Name: "sex", Type: schema.FieldTypeText},
+		&schema.SchemaField{Name: "hidden", Type: schema.FieldTypeBool},
+		&schema.SchemaField{Name: "season", Type: schema.FieldTypeText},
+		&schema.SchemaField{Name: "tenant", Type: schema.FieldTypeText},
+	)
+	if err := dao.SaveCollection(rankings); err != nil {
+		app.Cleanup()
+		t.Fatalf("Failed to create rankings collection: %v", err)
+	}
+
+	// Create "ranking_buckets" collection
+	rankingBuckets := &models.Collection{}
+	rankingBuckets.Name = "ranking_buckets"
+	rankingBuckets.Type = models.CollectionTypeBase
+	rankingBuckets.Schema = schema.NewSchema(
+		&schema.SchemaField{Name: "recipient", Type: schema.FieldTypeText},
+		&schema.SchemaField{Name: "day", Type: schema.FieldTypeText},
+		&schema.SchemaField{Name: "total_coins", Type: schema.FieldTypeNumber},
+		&schema.SchemaField{Name: "messages_count", Type: schema.FieldTypeNumber},
+		&schema.SchemaField{Name: "tenant", Type: schema.FieldTypeText},
+	)
+	if err := dao.SaveCollection(rankingBuckets); err != nil {
+		app.Cleanup()
+		t.Fatalf("Failed to create ranking_buckets collection: %v", err)
+	}
+
+	// Create "moderation_queue" collection
+	moderationQueue := &models.Collection{}
+	moderationQueue.Name = "moderation_queue"
+	moderationQueue.Type = models.CollectionTypeBase
+	moderationQueue.Schema = schema.NewSchema(
+		&schema.SchemaField{Name: "user", Type: schema.FieldTypeText},
+		&schema.SchemaField{Name: "collection", Type: schema.FieldTypeText},
+		&schema.SchemaField{Name: "record", Type: schema.FieldTypeText},
+		&schema.SchemaField{Name: "reason", Type: schema.FieldTypeText},
+		&schema.SchemaField{Name: "payload", Type: schema.FieldTypeJson},
+		&schema.SchemaField{Name: "details", Type: schema.FieldTypeJson},
+		&schema.SchemaField{Name: "status", Type: schema.FieldTypeText},
+	)
+	if err := dao.SaveCollection(moderationQueue); err != nil {
+		app.Cleanup()
+		t.Fatalf("Failed to create moderation_queue collection: %v", err)
+	}
+
+	// Create "ranking_snapshots" collection
+	rankingSnapshots := &models.Collection{}
+	rankingSnapshots.Name = "ranking_snapshots"
+	rankingSnapshots.Type = models.CollectionTypeBase
+	rankingSnapshots.Schema = schema.NewSchema(
+		&schema.SchemaField{Name: "season", Type: schema.FieldTypeText},
+		&schema.SchemaField{Name: "tenant", Type: schema.FieldTypeText},
+		&schema.SchemaField{Name: "taken_at", Type: schema.FieldTypeDate},
+		&schema.SchemaField{Name: "entries", Type: schema.FieldTypeJson},
+	)
+	if err := dao.SaveCollection(rankingSnapshots); err != nil {
+		app.Cleanup()
+		t.Fatalf("Failed to create ranking_snapshots collection: %v", err)
+	}
+
+	// Create "seasons" collection
+	seasons := &models.Collection{}
+	seasons.Name = "seasons"
+	seasons.Type = models.CollectionTypeBase
+	seasons.Schema = schema.NewSchema(
+		&schema.SchemaField{Name: "uid", Type: schema.FieldTypeText},
+		&schema.SchemaField{Name: "name", Type: schema.FieldTypeText},
+		&schema.SchemaField{Name: "starts_at", Type: schema.FieldTypeDate},
+		&schema.SchemaField{Name: "ends_at", Type: schema.FieldTypeDate},
+		&schema.SchemaField{Name: "archived", Type: schema.FieldTypeBool},
+	)
+	if err := dao.SaveCollection(seasons); err != nil {
+		app.Cleanup()
+		t.Fatalf("Failed to create seasons collection: %v", err)
+	}
+
+	// Create "tenants" collection
+	tenants := &models.Collection{}
+	tenants.Name = "tenants"
+	tenants.Type = models.CollectionTypeBase
+	tenants.Schema = schema.NewSchema(
+		&schema.SchemaField{Name: "uid", Type: schema.FieldTypeText},
+		&schema.SchemaField{Name: "name", Type: schema.FieldTypeText},
+		&schema.SchemaField{Name: "hosts", Type: schema.FieldTypeJson},
+		&schema.SchemaField{Name: "email_domains", Type: schema.FieldTypeJson},
+		&schema.SchemaField{Name: "branding", Type: schema.FieldTypeJson},
+		&schema.SchemaField{Name: "send_price", Type: schema.FieldTypeNumber},
+		&schema.SchemaField{Name: "student_id_pattern", Type: schema.FieldTypeText},
+	)
+	if err := dao.SaveCollection(tenants); err != nil {
+		app.Cleanup()
+		t.Fatalf("Failed to create tenants collection: %v", err)
+	}
+
+	// Create "user_sanctions" collection
+	sanctions := &models.Collection{}
+	sanctions.Name = "user_sanctions"
+	sanctions.Type = models.CollectionTypeBase
+	sanctions.Schema = schema.NewSchema(
+		&schema.SchemaField{Name: "user", Type: schema.FieldTypeText},
+		&schema.SchemaField{Name: "send_banned_until", Type: schema.FieldTypeDate},
+		&schema.SchemaField{Name: "reply_only_until", Type: schema.FieldTypeDate},
+		&schema.SchemaField{Name: "shadow_banned_until", Type: schema.FieldTypeDate},
+	)
+	if err := dao.SaveCollection(sanctions); err != nil {
+		app.Cleanup()
+		t.Fatalf("Failed to create user_sanctions collection: %v", err)
+	}
+
 	return app
 }
 
@@ -29,30 +29,54 @@ func onAddUserDetails(app core.App, e *core.RecordCreateEvent) error {
 
 	user.Set("details", e.Record.Id)
 	passivePrintError(dao.SaveRecord(user))
+	passivePrintError(syncRankingDetails(dao, e.Record))
+	invalidateDepartmentLeaderboard()
 
-	// TODO: build message count
-	// messageCount, giftMessagesCount := 0, 0
-
-	// if res, err := dao.FindRecordsByExpr("messages", dbx.HashExp{"recipient": e.Record.GetString("student_id")}); err == nil {
-	// 	for _, row := range res {
+	// wallets are created with the user, before its tenant is known
+	if wallet, err := dao.FindFirstRecordByData("virtual_wallets", "user", user.Id); err == nil {
+		wallet.Set("tenant", e.Record.GetString("tenant"))
+		passivePrintError(dao.SaveRecord(wallet))
+	}
 
-	// 	}
-	// }
+	stats, err := queryRecipientStats(dao, e.Record.GetString("tenant"), e.Record.GetString("student_id"))
+	if err != nil {
+		passivePrintError(err)
+		stats = &RecipientStats{}
+	}
 
-	// TODO: add message count
+	tenant := findTenant(dao, e.Record.GetString("tenant"))
 	email := e.Record.Email()
 	if msg, err := emailTemplates.welcome.With(map[string]any{
-		"Email": email,
-	}).Message(app.Settings().Meta, email); err == nil {
+		"Email":         email,
+		"Stats":         stats,
+		"SeasonName":    currentSeasonName(dao),
+		"SiteName":      tenantSiteName(tenant),
+		"CommunityName": tenantCommunityName(tenant),
+	}).From(tenantSiteName(tenant)).Message(app.Settings().Meta, email); err == nil {
 		passivePrintError(app.NewMailClient().Send(msg))
 	}
 
 	return nil
 }
 
+func onUpdateUserDetails(app core.App, e *core.RecordUpdateEvent) error {
+	defer invalidateDepartmentLeaderboard()
+	return syncRankingDetails(app.Dao(), e.Record)
+}
+
 func onUserVerified(app core.App, e *core.RecordConfirmVerificationEvent) error {
 	// TODO: add message count
-	msg, err := emailTemplates.welcome.Message(app.Settings().Meta, e.Record.Email())
+	var tenant *models.Record
+	if details, err := app.Dao().FindRecordById("user_details", e.Record.GetString("details")); err == nil {
+		tenant = findTenant(app.Dao(), details.GetString("tenant"))
+	}
+
+	msg, err := emailTemplates.welcome.With(map[string]any{
+		"Email":         e.Record.Email(),
+		"SeasonName":    currentSeasonName(app.Dao()),
+		"SiteName":      tenantSiteName(tenant),
+		"CommunityName": tenantCommunityName(tenant),
+	}).From(tenantSiteName(tenant)).Message(app.Settings().Meta, e.Record.Email())
 	if err != nil {
 		// TODO: add error
 		// return err
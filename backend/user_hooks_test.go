@@ -1,10 +1,12 @@
 package main
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/pocketbase/pocketbase/core"
 	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/models/settings"
 	"github.com/pocketbase/pocketbase/tests"
 )
 
@@ -103,3 +105,20 @@ func TestOnRemoveUser(t *testing.T) {
 		t.Error("User details were not deleted")
 	}
 }
+
+func TestWelcomeEmail_Stats(t *testing.T) {
+	msg, err := emailTemplates.welcome.With(map[string]any{
+		"Email":         "juan@example.com",
+		"Stats":         &RecipientStats{MessagesCount: 2, GiftMessagesCount: 1},
+		"SeasonName":    "UIC Valentine Wall 2023",
+		"SiteName":      "UIC Valentine Wall",
+		"CommunityName": "ignacians",
+	}).Message(settings.MetaConfig{}, "juan@example.com")
+	if err != nil {
+		t.Fatalf("Failed to render the welcome email: %v", err)
+	}
+
+	if expected := "your ID has received 2 messages and 1 gifts."; !strings.Contains(msg.HTML, expected) {
+		t.Errorf("Expected %q in the welcome email, got:\n%s", expected, msg.HTML)
+	}
+}
@@ -40,14 +40,3 @@ func writeResponseDataSSE(rw http.ResponseWriter, buf *bytes.Buffer) {
 		f.Flush()
 	}
 }
-
-func checkProfanity(content string) *ResponseError {
-	if profanityDetector.IsProfane(content) {
-		return &ResponseError{
-			StatusCode: http.StatusBadRequest,
-			Message:    "Your submission contains inappropriate content.",
-		}
-	}
-
-	return nil
-}
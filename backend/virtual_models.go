@@ -8,9 +8,29 @@ type UserConnection struct {
 }
 
 type RecipientStats struct {
-	RecipientID       string `db:"recipient_id" json:"recipient_id"`
-	MessagesCount     int    `db:"messages_count" json:"messages_count"`
-	GiftMessagesCount int    `db:"gift_messages_count" json:"gift_messages_count"`
+	RecipientID       string       `db:"recipient_id" json:"recipient_id"`
+	MessagesCount     int          `db:"messages_count" json:"messages_count"`
+	GiftMessagesCount int          `db:"gift_messages_count" json:"gift_messages_count"`
+	RepliesCount      int          `db:"replies_count" json:"replies_count"`
+	CoinsReceived     float64      `db:"coins_received" json:"coins_received"`
+	TopGifts          []*GiftStats `db:"-" json:"top_gifts"`
+	GiftsHidden       bool         `db:"-" json:"gifts_hidden"`
+}
+
+// HideGifts removes the stats that can only be seen by the recipient
+// since gift messages are private.
+func (s *RecipientStats) HideGifts() {
+	s.GiftMessagesCount = 0
+	s.CoinsReceived = 0
+	s.TopGifts = []*GiftStats{}
+	s.GiftsHidden = true
+}
+
+type GiftStats struct {
+	GiftID string `db:"gift_id" json:"gift_id"`
+	UID    string `db:"uid" json:"uid"`
+	Label  string `db:"label" json:"label"`
+	Count  int    `db:"count" json:"count"`
 }
 
 type RecipientStats2 struct {
@@ -22,6 +42,25 @@ type RecipientStats2 struct {
 
 type Recipients []*RecipientStats2
 
+type DepartmentStats struct {
+	DepartmentID       string  `db:"department_id" json:"department_id"`
+	UID                string  `db:"uid" json:"uid"`
+	Label              string  `db:"label" json:"label"`
+	TotalCoins         float64 `db:"total_coins" json:"total_coins"`
+	MessagesCount      int     `db:"messages_count" json:"messages_count"`
+	UniqueRecipients   int     `db:"unique_recipients" json:"unique_recipients"`
+	RegisteredStudents int     `db:"registered_students" json:"registered_students"`
+	NormalizedCoins    float64 `db:"-" json:"normalized_coins"`
+}
+
+type DepartmentStatsList []*DepartmentStats
+
+func (a DepartmentStatsList) Len() int      { return len(a) }
+func (a DepartmentStatsList) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a DepartmentStatsList) Less(i, j int) bool {
+	return a[i].NormalizedCoins > a[j].NormalizedCoins
+}
+
 func (a Recipients) Len() int           { return len(a) }
 func (a Recipients) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
 func (a Recipients) Less(i, j int) bool { return a[i].TotalCoins > a[j].TotalCoins }
@@ -38,3 +77,16 @@ func (a Recipients) BySex(sex string) Recipients {
 	}
 	return res
 }
+
+func (a Recipients) ByDepartment(department string) Recipients {
+	if len(department) == 0 || department == "all" {
+		return a
+	}
+	res := make(Recipients, 0, len(a))
+	for _, v := range a {
+		if v.Department == department {
+			res = append(res, v)
+		}
+	}
+	return res
+}
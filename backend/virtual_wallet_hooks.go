@@ -5,9 +5,11 @@ import (
 	"github.com/pocketbase/pocketbase/daos"
 )
 
+const initialBalance = float64(1000)
+
 func onAddWallet(dao *daos.Dao, e *core.ModelEvent) error {
 	// add initial balance
-	return createTransaction(dao, e.Model.GetId(), 1000, "Initial balance")
+	return createTransaction(dao, e.Model.GetId(), initialBalance, "Initial balance")
 }
 
 func onAddWalletTransaction(dao *daos.Dao, e *core.ModelEvent) error {